@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
@@ -20,7 +22,8 @@ var version = "3.4.0"
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		// A failed sync exits with the code of its kind (see README).
+		os.Exit(syncsvc.ExitCode(err))
 	}
 }
 
@@ -28,15 +31,26 @@ var (
 	flagConf  string
 	flagNoTUI bool
 	flagDry   bool
+
+	flagForceUnlock bool
+	flagPlan        bool
+	flagResume      bool
+	flagSteps       string
+	flagSkip        string
+	flagOutput      string
+	flagOnError     string
+	flagAll         bool
+	flagTag         string
+	flagJobs        int
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "sitesync [sql|files]",
+	Use:   "sitesync [sql|files|push]",
 	Short: "Sync a remote website to your local environment",
 	Long: `sitesync synchronises a remote website (database + files) to your local
 development environment. Running without arguments opens the interactive TUI.`,
 	Args:      cobra.MaximumNArgs(1),
-	ValidArgs: []string{"sql", "files"},
+	ValidArgs: []string{"sql", "files", "push"},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		notice := latestUpdateNotice()
 
@@ -45,18 +59,56 @@ development environment. Running without arguments opens the interactive TUI.`,
 			opStr = args[0]
 		}
 		op := tui.ParseOp(opStr)
+		steps, err := selectSteps(op)
+		if err != nil {
+			return err
+		}
+		if flagOutput != "text" && flagOutput != "json" {
+			return fmt.Errorf("--output must be text or json, not %q", flagOutput)
+		}
+		onError, err := syncsvc.ParseErrorPolicy(flagOnError)
+		if err != nil {
+			return fmt.Errorf("--on-error: %w", err)
+		}
+		opts := syncsvc.Options{Resume: flagResume, Steps: steps, OnError: onError}
+
+		sites, batch, err := batchSites()
+		if err != nil {
+			return err
+		}
+		if batch {
+			return runBatch(sites, op, opts)
+		}
+
+		if flagPlan {
+			return printPlan(flagConf, op, steps)
+		}
+
+		if flagForceUnlock {
+			if err := forceUnlock(flagConf); err != nil {
+				return err
+			}
+		}
 
-		if flagNoTUI || flagConf != "" && len(args) > 0 {
-			if notice != "" {
+		if headless(args, opts) {
+			if notice != "" && flagOutput == "text" {
 				fmt.Fprintln(os.Stderr, notice)
 			}
-			return runHeadless(flagConf, op)
+			return runHeadless(flagConf, op, opts)
 		}
 
-		return runTUI(flagConf, notice)
+		return runTUI(flagConf, notice, flagJobs)
 	},
 }
 
+// headless reports whether a sync runs without the TUI: when asked to, for
+// JSON output, or when --conf comes with an op, steps, an error policy or
+// --resume, which the TUI would not apply.
+func headless(args []string, opts syncsvc.Options) bool {
+	return flagNoTUI || flagOutput == "json" ||
+		flagConf != "" && (len(args) > 0 || opts.Steps != 0 || opts.OnError != nil || opts.Resume)
+}
+
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print version",
@@ -66,22 +118,233 @@ var versionCmd = &cobra.Command{
 }
 
 var replaceCmd = &cobra.Command{
-	Use:   "replace [-i] <search> <replace> <file>",
+	Use:   "replace [-i] <search> <replace> [<search> <replace>...] <file>",
 	Short: "PHP serialize-aware find/replace on a file",
+	Long: `PHP serialize-aware find/replace on a file. Several search/replace pairs
+may be given; they are applied in order in a single pass over the file.
+The file is always rewritten in place; -i is accepted for compatibility.
+
+Literal pairs also rewrite their JSON-escaped (https:\/\/...) and
+URL-encoded (https%3A%2F%2F...) forms unless --skip-encoded is given.
+--regex, --ignore-case, --only-serialized, --skip-encoded, --tables and
+--exclude-tables apply to every pair.`,
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) == 3 {
+		if len(args) >= 3 && len(args)%2 == 1 {
 			return nil
 		}
-		if len(args) == 4 && args[0] == "-i" {
-			return nil
+		return fmt.Errorf("expected <search> <replace> pairs followed by <file>, got %d arg(s)", len(args))
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		regex, _ := cmd.Flags().GetBool("regex")
+		ignoreCase, _ := cmd.Flags().GetBool("ignore-case")
+		onlySerialized, _ := cmd.Flags().GetBool("only-serialized")
+		skipEncoded, _ := cmd.Flags().GetBool("skip-encoded")
+		tables, _ := cmd.Flags().GetStringSlice("tables")
+		excludeTables, _ := cmd.Flags().GetStringSlice("exclude-tables")
+
+		file := args[len(args)-1]
+		var pairs []config.ReplacePair
+		for i := 0; i+1 < len(args)-1; i += 2 {
+			pairs = append(pairs, config.ReplacePair{
+				Search:         args[i],
+				Replace:        args[i+1],
+				Regex:          regex,
+				IgnoreCase:     ignoreCase,
+				OnlySerialized: onlySerialized,
+				SkipEncoded:    skipEncoded,
+				Tables:         tables,
+				ExcludeTables:  excludeTables,
+			})
+		}
+		if err := config.ValidateReplacePairs(pairs); err != nil {
+			return err
+		}
+		return syncsvc.ResilientReplaceAllFile(pairs, file)
+	},
+}
+
+var verifySerializedCmd = &cobra.Command{
+	Use:   "verify-serialized <file>",
+	Short: "Check PHP serialized values in a SQL dump",
+	Long: `Parse every PHP serialized value in a SQL dump (plain or .gz), including
+arrays, objects and serialized data nested inside strings, and report each
+value whose declared length does not match its contents.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count := 0
+		err := syncsvc.VerifySerializedFile(args[0], func(si syncsvc.SerialIssue) {
+			count++
+			fmt.Println(si)
+		})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%d corrupted serialized value(s)", count)
+		}
+		fmt.Println("serialized data OK")
+		return nil
+	},
+}
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "List pre-import database snapshots",
+	Long: `List the snapshots of the local database taken before each import, for
+--conf or for every site when --conf is not given.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := []string{flagConf}
+		if flagConf == "" {
+			entries, err := config.ListConfigs()
+			if err != nil {
+				return fmt.Errorf("listing configs: %w", err)
+			}
+			names = names[:0]
+			for _, e := range entries {
+				names = append(names, e.Name)
+			}
+		}
+		for _, name := range names {
+			snaps, err := syncsvc.ListSnapshots(name)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			syncsvc.PrintSnapshots(os.Stdout, name, snaps)
 		}
-		return cobra.ExactArgs(3)(cmd, args)
+		return nil
 	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history [--conf=NAME] [--json] [--limit=N]",
+	Short: "List past sync runs",
+	Long: `List the runs recorded for --conf, or for every site when --conf is not
+given, most recent first: when each started, the operation and steps, how
+long it took, whether it succeeded and why it stopped, the dump size, the
+bytes rsync transferred and who ran it. --json prints the full records,
+including the status and duration of every step.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) == 4 && args[0] == "-i" {
-			args = args[1:]
+		asJSON, _ := cmd.Flags().GetBool("json")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		names := []string{flagConf}
+		if flagConf == "" {
+			entries, err := config.ListConfigs()
+			if err != nil {
+				return fmt.Errorf("listing configs: %w", err)
+			}
+			names = names[:0]
+			for _, e := range entries {
+				names = append(names, e.Name)
+			}
+		}
+		all := []syncsvc.RunRecord{}
+		for _, name := range names {
+			recs, err := syncsvc.ReadHistory(name)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if limit > 0 && len(recs) > limit {
+				recs = recs[len(recs)-limit:]
+			}
+			if asJSON {
+				all = append(all, recs...)
+				continue
+			}
+			syncsvc.PrintHistory(os.Stdout, name, recs)
+		}
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(all)
 		}
-		return syncsvc.ResilientReplaceFile(args[0], args[1], args[2], syncsvc.ReplaceOptions{})
+		return nil
+	},
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback --conf=NAME [--snapshot=ID]",
+	Short: "Restore the local database from a snapshot",
+	Long: `Restore the local database of --conf from a snapshot taken before an
+import. Without --snapshot the most recent one is used. The database is
+dropped and recreated from the snapshot.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagConf == "" {
+			return fmt.Errorf("--conf is required for rollback")
+		}
+		cfg, err := config.Load(flagConf)
+		if err != nil {
+			return err
+		}
+		id, _ := cmd.Flags().GetString("snapshot")
+		snap, err := syncsvc.FindSnapshot(flagConf, id)
+		if err != nil {
+			return err
+		}
+		tmpDir := config.TmpDir()
+		if err := os.MkdirAll(tmpDir, 0700); err != nil {
+			return fmt.Errorf("cannot create tmp dir: %w", err)
+		}
+		unlock, err := syncsvc.AcquireLock(tmpDir, flagConf)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		fmt.Printf("Restoring %s from snapshot %s (taken %s)\n",
+			snap.DB, snap.ID, snap.Created.Format("2006-01-02 15:04:05"))
+		if err := syncsvc.RestoreSnapshot(context.Background(), cfg, snap); err != nil {
+			return fmt.Errorf("rollback failed: %w", err)
+		}
+		fmt.Println("\n  ✔ rollback complete")
+		return nil
+	},
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor --conf=NAME [--json]",
+	Short: "Diagnose a site config end to end",
+	Long: `Check everything a sync of --conf depends on without changing anything:
+which etc/ directory is used, the config itself, SSH access to the source
+server, the source database credentials, the [[sync]] paths, the hook
+scripts and the log file. Each check passes, warns or fails; failures come
+with a hint on how to fix them.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagConf == "" {
+			return fmt.Errorf("--conf is required for doctor")
+		}
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		checks := syncsvc.Doctor(context.Background(), flagConf)
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(checks); err != nil {
+				return err
+			}
+		} else {
+			syncsvc.PrintChecks(os.Stdout, checks)
+		}
+
+		failed := 0
+		for _, c := range checks {
+			if c.Status == syncsvc.CheckFail {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d check(s) failed", failed)
+		}
+		return nil
 	},
 }
 
@@ -119,22 +382,48 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&flagConf, "conf", "", "Config name (etc/{name}/config.toml)")
 	rootCmd.PersistentFlags().BoolVar(&flagNoTUI, "no-tui", false, "Run headlessly (no interactive interface)")
 
+	rootCmd.Flags().BoolVar(&flagForceUnlock, "force-unlock", false, "Remove the lock left by another run of --conf before syncing")
+	rootCmd.Flags().BoolVar(&flagResume, "resume", false, "Skip the steps an interrupted run of the same operation completed")
+	rootCmd.Flags().StringVar(&flagSteps, "steps", "", "Run only these steps, e.g. 2,4 or 1-3")
+	rootCmd.Flags().StringVar(&flagSkip, "skip", "", "Do not run these steps, e.g. 1")
+	rootCmd.Flags().StringVar(&flagOutput, "output", "text", "Output format of a headless run or --plan: text or json (one event per line, replies read from stdin)")
+	rootCmd.Flags().StringVar(&flagOnError, "on-error", "", `What to do when a step fails instead of asking, e.g. "retry=3/30s,abort; 3,5,7:continue"`)
+	rootCmd.Flags().BoolVar(&flagAll, "all", false, "Sync every site in etc/, one batch run")
+	rootCmd.Flags().StringVar(&flagTag, "tag", "", "Sync the sites with one of these tags, e.g. wordpress or wordpress,shop")
+	rootCmd.Flags().IntVar(&flagJobs, "jobs", 2, "How many sites of a batch run sync at a time")
+	rootCmd.Flags().BoolVar(&flagPlan, "plan", false, "Print the commands, hooks, replacements and files of a sync without running it")
+
+	replaceCmd.Flags().BoolP("in-place", "i", true, "Rewrite the file in place (always on)")
+	replaceCmd.Flags().Bool("regex", false, "Treat each search as a Go regular expression")
+	replaceCmd.Flags().Bool("ignore-case", false, "Match searches case-insensitively")
+	replaceCmd.Flags().Bool("only-serialized", false, "Only replace inside PHP serialized strings")
+	replaceCmd.Flags().Bool("skip-encoded", false, "Do not also replace the JSON-escaped and URL-encoded forms")
+	replaceCmd.Flags().StringSlice("tables", nil, "Only replace in these tables (table or table.column, globs allowed)")
+	replaceCmd.Flags().StringSlice("exclude-tables", nil, "Do not replace in these tables (table or table.column, globs allowed)")
+
 	migrateCmd.Flags().Bool("all", false, "Migrate all shell configs found in etc/")
 	migrateCmd.Flags().BoolVar(&flagDry, "dry-run", false, "Preview migration without writing files")
 
-	rootCmd.AddCommand(versionCmd, replaceCmd, migrateCmd)
+	doctorCmd.Flags().Bool("json", false, "Print the checks as JSON")
+
+	historyCmd.Flags().Bool("json", false, "Print the records as JSON")
+	historyCmd.Flags().Int("limit", 20, "Show at most this many runs per site (0 for all)")
+
+	rollbackCmd.Flags().String("snapshot", "", "Snapshot ID to restore (default: the most recent)")
+
+	rootCmd.AddCommand(versionCmd, replaceCmd, verifySerializedCmd, snapshotsCmd, rollbackCmd, historyCmd, doctorCmd, migrateCmd)
 }
 
 // ── TUI runner ───────────────────────────────────────────────────────────────
 
-func runTUI(preselect, updateNotice string) error {
+func runTUI(preselect, updateNotice string, jobs int) error {
 	entries, err := config.ListConfigs()
 	if err != nil {
 		return fmt.Errorf("listing configs: %w", err)
 	}
 
 	log := logger.Discard()
-	m := tui.New(entries, preselect, log, updateNotice)
+	m := tui.New(entries, preselect, log, updateNotice, jobs)
 
 	p := tea.NewProgram(m,
 		tea.WithAltScreen(),
@@ -148,13 +437,13 @@ func runTUI(preselect, updateNotice string) error {
 
 // ── headless runner ──────────────────────────────────────────────────────────
 
-func runHeadless(confName string, op syncsvc.Op) error {
-	if confName == "" {
-		return fmt.Errorf("--conf is required for headless mode")
-	}
-
-	cfg, err := config.Load(confName)
+func runHeadless(confName string, op syncsvc.Op, opts syncsvc.Options) error {
+	cfg, err := loadHeadless(confName)
 	if err != nil {
+		err = &syncsvc.RunError{Kind: syncsvc.KindConfig, Err: err}
+		if flagOutput == "json" {
+			syncsvc.WriteJSONResult(os.Stdout, err)
+		}
 		return err
 	}
 
@@ -166,7 +455,145 @@ func runHeadless(confName string, op syncsvc.Op) error {
 	}
 	defer log.Close()
 
-	return syncsvc.RunHeadless(context.Background(), cfg, op, log)
+	if flagOutput == "json" {
+		return syncsvc.RunJSON(context.Background(), cfg, op, opts, log, os.Stdin, os.Stdout)
+	}
+	return syncsvc.RunHeadless(context.Background(), cfg, op, opts, log)
+}
+
+// batchSites returns the sites of a batch run, selected with --all, --tag
+// or several names in --conf. batch is false for a single-site run.
+func batchSites() (sites []string, batch bool, err error) {
+	names := splitList(flagConf)
+	if !flagAll && flagTag == "" && len(names) < 2 {
+		return nil, false, nil
+	}
+	if flagAll && len(names) > 0 {
+		return nil, true, fmt.Errorf("--all and --conf cannot be combined")
+	}
+	sites, err = config.SelectConfigs(names, flagAll, splitList(flagTag))
+	if err != nil {
+		return nil, true, &syncsvc.RunError{Kind: syncsvc.KindConfig, Err: err}
+	}
+	if len(sites) == 0 {
+		return nil, true, &syncsvc.RunError{Kind: syncsvc.KindConfig, Err: fmt.Errorf("no site to sync")}
+	}
+	return sites, true, nil
+}
+
+// runBatch syncs several sites headlessly, --jobs at a time.
+func runBatch(sites []string, op syncsvc.Op, opts syncsvc.Options) error {
+	if op == syncsvc.OpPush {
+		return fmt.Errorf("push cannot run in a batch: each push must be confirmed")
+	}
+	if flagJobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	if flagPlan {
+		for i, site := range sites {
+			if i > 0 && flagOutput == "text" {
+				fmt.Println()
+			}
+			if err := printPlan(site, op, opts.Steps); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if flagForceUnlock {
+		for _, site := range sites {
+			if err := forceUnlock(site); err != nil {
+				return err
+			}
+		}
+	}
+
+	ctx := context.Background()
+	if flagOutput == "json" {
+		return syncsvc.RunBatchJSON(ctx, sites, op, opts, flagJobs, os.Stdout)
+	}
+	fmt.Printf("  syncing %d sites, %d at a time: %s\n\n", len(sites), min(flagJobs, len(sites)), strings.Join(sites, ", "))
+	return syncsvc.RunBatchHeadless(ctx, sites, op, opts, flagJobs, os.Stdout)
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadHeadless loads the config of a headless run.
+func loadHeadless(confName string) (*config.Config, error) {
+	if confName == "" {
+		return nil, fmt.Errorf("--conf is required for headless mode")
+	}
+	return config.Load(confName)
+}
+
+// selectSteps turns --steps and --skip into the steps of op to run, or zero
+// when neither flag is given.
+func selectSteps(op syncsvc.Op) (syncsvc.Steps, error) {
+	if flagSteps == "" && flagSkip == "" {
+		return 0, nil
+	}
+	steps := syncsvc.AllSteps
+	if flagSteps != "" {
+		var err error
+		if steps, err = syncsvc.ParseSteps(flagSteps); err != nil {
+			return 0, fmt.Errorf("--steps: %w", err)
+		}
+	}
+	if flagSkip != "" {
+		skip, err := syncsvc.ParseSteps(flagSkip)
+		if err != nil {
+			return 0, fmt.Errorf("--skip: %w", err)
+		}
+		steps &^= skip
+	}
+	if steps&op.Steps() == 0 {
+		return 0, fmt.Errorf("no step left to run: %s has steps %s", op, op.Steps())
+	}
+	return op.Select(steps), nil
+}
+
+// printPlan prints what a sync of confName would do, without running it.
+func printPlan(confName string, op syncsvc.Op, steps syncsvc.Steps) error {
+	if confName == "" {
+		return fmt.Errorf("--plan requires --conf")
+	}
+	cfg, err := config.Load(confName)
+	if err != nil {
+		return err
+	}
+	plan, err := syncsvc.BuildPlan(context.Background(), cfg, op, steps)
+	if err != nil {
+		return err
+	}
+	if flagOutput == "json" {
+		return json.NewEncoder(os.Stdout).Encode(plan)
+	}
+	plan.Print(os.Stdout)
+	return nil
+}
+
+// forceUnlock removes the lock of a site so the next run can start.
+func forceUnlock(confName string) error {
+	if confName == "" {
+		return fmt.Errorf("--force-unlock requires --conf")
+	}
+	holder, err := syncsvc.ForceUnlock(config.TmpDir(), confName)
+	if err != nil {
+		return err
+	}
+	if holder != nil {
+		fmt.Fprintf(os.Stderr, "removed lock of %s held by %s\n", confName, holder)
+	}
+	return nil
 }
 
 // ── migrate helper ───────────────────────────────────────────────────────────
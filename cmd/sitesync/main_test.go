@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	syncsvc "github.com/carlosrgl/sitesync/internal/sync"
+)
+
+func TestHeadless(t *testing.T) {
+	defer func(conf, output string, noTUI bool) {
+		flagConf, flagOutput, flagNoTUI = conf, output, noTUI
+	}(flagConf, flagOutput, flagNoTUI)
+	flagOutput, flagNoTUI = "text", false
+
+	tests := []struct {
+		name string
+		conf string
+		args []string
+		opts syncsvc.Options
+		want bool
+	}{
+		{name: "picker", want: false},
+		{name: "site only", conf: "shop", want: false},
+		{name: "site and op", conf: "shop", args: []string{"sql"}, want: true},
+		{name: "site and steps", conf: "shop", opts: syncsvc.Options{Steps: syncsvc.StepsOf(4)}, want: true},
+		{name: "site and resume", conf: "shop", opts: syncsvc.Options{Resume: true}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flagConf = tt.conf
+			if got := headless(tt.args, tt.opts); got != tt.want {
+				t.Fatalf("headless() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
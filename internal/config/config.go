@@ -17,6 +17,8 @@ type Config struct {
 	Transport   TransportConfig `toml:"transport"`
 	Hooks       HooksConfig     `toml:"hooks"`
 	Logging     LoggingConfig   `toml:"logging"`
+	Safety      SafetyConfig    `toml:"safety"`
+	Run         RunConfig       `toml:"run"`
 
 	// configFilePath is set by the loader and not serialised.
 	configFilePath string
@@ -29,6 +31,8 @@ func (c *Config) ConfigFilePath() string { return c.configFilePath }
 type SiteConfig struct {
 	Name        string `toml:"name"`
 	Description string `toml:"description"`
+	// Tags group sites for batch runs, e.g. sitesync --tag=wordpress.
+	Tags []string `toml:"tags"`
 }
 
 // SourceConfig holds all settings for the remote (source) side.
@@ -89,12 +93,47 @@ type DatabaseConfig struct {
 	SQLOptionsStructure string   `toml:"sql_options_structure"`
 	SQLOptionsExtra     string   `toml:"sql_options_extra"`
 	IgnoreTables        []string `toml:"ignore_tables"`
+
+	// Stream pipes the dump straight from the source through find/replace
+	// into mysql without writing it to tmp/. Ignored when before hooks
+	// exist, since those need the dump file.
+	Stream bool `toml:"stream"`
+
+	// VerifySerialized parses every PHP serialized value in the dump after
+	// find/replace and fails Step 2 if any declared length is wrong.
+	VerifySerialized bool `toml:"verify_serialized"`
+
+	// ReplaceWorkers is the number of goroutines find/replace runs on.
+	// 0 uses every CPU (GOMAXPROCS); 1 keeps the sequential path.
+	ReplaceWorkers int `toml:"replace_workers"`
+
+	// SnapshotKeep is how many compressed dumps of the destination database
+	// are kept under etc/snapshots/{name}/. A snapshot is taken before every
+	// import; 0 turns snapshots off.
+	SnapshotKeep int `toml:"snapshot_keep"`
 }
 
 // ReplacePair is one find/replace entry applied to the SQL dump.
 type ReplacePair struct {
 	Search  string `toml:"search"`
 	Replace string `toml:"replace"`
+
+	// Regex treats Search as a Go regular expression; Replace may then use
+	// $1-style group references.
+	Regex bool `toml:"regex,omitempty"`
+	// IgnoreCase matches Search case-insensitively (e.g. host names).
+	IgnoreCase bool `toml:"ignore_case,omitempty"`
+	// OnlySerialized restricts the pair to PHP serialized s:N:"..." values.
+	OnlySerialized bool `toml:"only_serialized,omitempty"`
+	// SkipEncoded turns off the JSON-escaped (https:\/\/...) and URL-encoded
+	// forms that are otherwise replaced alongside a literal pair.
+	SkipEncoded bool `toml:"skip_encoded,omitempty"`
+
+	// Tables limits the pair to these tables; ExcludeTables keeps it out of
+	// them. Entries are table names, globs (wp_*_log) or "table.column";
+	// columns are only told apart in dumps made with --complete-insert.
+	Tables        []string `toml:"tables,omitempty"`
+	ExcludeTables []string `toml:"exclude_tables,omitempty"`
 }
 
 // SyncPair is one source→destination directory pair for file sync.
@@ -130,6 +169,28 @@ type LoggingConfig struct {
 	File string `toml:"file"`
 }
 
+// SafetyConfig guards against syncing into anything that does not look like
+// a local development environment. Violations must be confirmed before the
+// sync starts.
+type SafetyConfig struct {
+	// AllowedHosts lists non-local destination DB hosts that may be written
+	// to without confirmation, e.g. a docker-compose service. Globs allowed.
+	AllowedHosts []string `toml:"allowed_hosts"`
+	// ProtectedDBs are glob patterns of destination DB names that are never
+	// overwritten without confirmation.
+	ProtectedDBs []string `toml:"protected_dbs"`
+	// AllowPush enables sitesync push for this site, which overwrites the
+	// source database and files with the local ones.
+	AllowPush bool `toml:"allow_push"`
+}
+
+// RunConfig holds settings for unattended runs.
+type RunConfig struct {
+	// OnError is the policy applied when a step fails, instead of asking,
+	// e.g. "retry=3/30s,abort; 3,5,7:continue". --on-error adds to it.
+	OnError string `toml:"on_error"`
+}
+
 // DefaultConfig returns a Config populated with sensible defaults.
 func DefaultConfig() Config {
 	return Config{
@@ -150,6 +211,7 @@ func DefaultConfig() Config {
 		},
 		Database: DatabaseConfig{
 			SQLOptionsStructure: "--default-character-set=utf8",
+			SnapshotKeep:        3,
 		},
 		Transport: TransportConfig{
 			Type:         "rsync",
@@ -166,6 +228,9 @@ func DefaultConfig() Config {
 		Logging: LoggingConfig{
 			File: "log/sitesync.log",
 		},
+		Safety: SafetyConfig{
+			ProtectedDBs: []string{"*_prod", "*_production"},
+		},
 	}
 }
 
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -55,4 +57,104 @@ func TestValidateConfigName(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestValidateReplacePairs(t *testing.T) {
+	tests := []struct {
+		name    string
+		pair    ReplacePair
+		wantErr bool
+	}{
+		{name: "literal", pair: ReplacePair{Search: "(unbalanced", Replace: "x"}, wantErr: false},
+		{name: "regex", pair: ReplacePair{Search: `https?://(www\.)?a\.com`, Replace: "x", Regex: true}, wantErr: false},
+		{name: "bad regex", pair: ReplacePair{Search: "(unbalanced", Replace: "x", Regex: true}, wantErr: true},
+		{name: "ignore case literal", pair: ReplacePair{Search: "[", Replace: "x", IgnoreCase: true}, wantErr: false},
+		{name: "tables", pair: ReplacePair{Search: "a", Replace: "b", Tables: []string{"wp_*", "wp_users.user_email"}}, wantErr: false},
+		{name: "bad table glob", pair: ReplacePair{Search: "a", Replace: "b", ExcludeTables: []string{"wp_[log"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateReplacePairs([]ReplacePair{tt.pair})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateReplacePairs(%+v) error = %v, wantErr %v", tt.pair, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateColumnScopes(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Replace = []ReplacePair{{Search: "a", Replace: "b", ExcludeTables: []string{"wp_*_log", "wp_users.user_email"}}}
+	if err := validateColumnScopes(&cfg); err == nil || !strings.Contains(err.Error(), "wp_users.user_email") {
+		t.Fatalf("validateColumnScopes() = %v, want an error naming the column scope", err)
+	}
+	cfg.Database.SQLOptionsExtra = "--set-gtid-purged=OFF --complete-insert"
+	if err := validateColumnScopes(&cfg); err != nil {
+		t.Fatalf("validateColumnScopes() with --complete-insert = %v", err)
+	}
+	// The dump of a *_file source is not made by sitesync; step 2 checks it.
+	cfg.Database.SQLOptionsExtra, cfg.Source.Type = "", "local_file"
+	if err := validateColumnScopes(&cfg); err != nil {
+		t.Fatalf("validateColumnScopes() for local_file = %v", err)
+	}
+}
+
+func TestSelectConfigs(t *testing.T) {
+	etc := t.TempDir()
+	t.Setenv("SITESYNC_ETC", etc)
+	for name, site := range map[string]string{
+		"blog": "[site]\ntags = [\"wordpress\"]\n",
+		"shop": "[site]\ntags = [\"WooCommerce\", \"wordpress\"]\n",
+		"api":  "",
+	} {
+		if err := os.MkdirAll(filepath.Join(etc, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(etc, name, "config.toml"), []byte(site), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		names []string
+		all   bool
+		tags  []string
+		want  string
+	}{
+		{all: true, want: "api,blog,shop"},
+		{tags: []string{"wordpress"}, want: "blog,shop"},
+		{all: true, tags: []string{"woocommerce"}, want: "shop"},
+		{names: []string{"shop", "api", "shop"}, want: "shop,api"},
+		{names: []string{"api", "blog"}, tags: []string{"wordpress"}, want: "blog"},
+	}
+	for _, tt := range tests {
+		got, err := SelectConfigs(tt.names, tt.all, tt.tags)
+		if err != nil || strings.Join(got, ",") != tt.want {
+			t.Errorf("SelectConfigs(%v, %v, %v) = %v, %v, want %s", tt.names, tt.all, tt.tags, got, err, tt.want)
+		}
+	}
+	if _, err := SelectConfigs([]string{"missing"}, false, []string{"wordpress"}); err == nil {
+		t.Error("SelectConfigs of a missing config with a tag succeeded")
+	}
+}
+
+func TestSnapshotKeepDefault(t *testing.T) {
+	dir := t.TempDir()
+	for conf, want := range map[string]int{
+		"":                                3,
+		"[database]\nsnapshot_keep = 0\n": 0,
+	} {
+		path := filepath.Join(dir, "config.toml")
+		if err := os.WriteFile(path, []byte(conf), 0600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadFromPath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Database.SnapshotKeep != want {
+			t.Errorf("snapshot_keep of %q = %d, want %d", conf, cfg.Database.SnapshotKeep, want)
+		}
+	}
+}
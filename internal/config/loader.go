@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -17,9 +18,16 @@ type ConfigEntry struct {
 	Name         string
 	Path         string // absolute path to config.toml
 	LastModified time.Time
+	Tags         []string // from [site]; empty when the file does not parse
 }
 
 // etcDir returns the path to the etc/ directory.
+func etcDir() string {
+	dir, _ := EtcDir()
+	return dir
+}
+
+// EtcDir returns the path to the etc/ directory and how it was found.
 //
 // Resolution order:
 //  1. $SITESYNC_ETC environment variable (explicit override — recommended for global installs)
@@ -28,15 +36,15 @@ type ConfigEntry struct {
 //
 // The walk stops one level before the filesystem root to avoid matching the
 // system /etc directory.
-func etcDir() string {
+func EtcDir() (dir, source string) {
 	// 1. Explicit env override
 	if v := os.Getenv("SITESYNC_ETC"); v != "" {
-		return v
+		return v, "$SITESYNC_ETC"
 	}
 
 	// 2. Walk up from cwd — stop before root so we never match /etc
 	cwd, _ := os.Getwd()
-	dir := cwd
+	dir = cwd
 	for {
 		parent := filepath.Dir(dir)
 		if parent == dir {
@@ -45,13 +53,13 @@ func etcDir() string {
 		}
 		candidate := filepath.Join(dir, "etc")
 		if fi, err := os.Stat(candidate); err == nil && fi.IsDir() {
-			return candidate
+			return candidate, "found above the working directory"
 		}
 		dir = parent
 	}
 
 	// 3. Fallback
-	return filepath.Join(cwd, "etc")
+	return filepath.Join(cwd, "etc"), "default ./etc"
 }
 
 // ListConfigs returns all named configs found under etc/
@@ -76,10 +84,15 @@ func ListConfigs() ([]ConfigEntry, error) {
 		if err != nil {
 			continue // not a sitesync config dir
 		}
+		var meta struct {
+			Site SiteConfig `toml:"site"`
+		}
+		_, _ = toml.DecodeFile(cfgPath, &meta)
 		configs = append(configs, ConfigEntry{
 			Name:         e.Name(),
 			Path:         cfgPath,
 			LastModified: fi.ModTime(),
+			Tags:         meta.Site.Tags,
 		})
 	}
 	sort.Slice(configs, func(i, j int) bool {
@@ -88,6 +101,56 @@ func ListConfigs() ([]ConfigEntry, error) {
 	return configs, nil
 }
 
+// SelectConfigs returns the configs of a batch run: the named ones, or all
+// of them when all is set or names is empty, keeping only those with one of
+// tags when any are given. Duplicate names are dropped.
+func SelectConfigs(names []string, all bool, tags []string) ([]string, error) {
+	if all || len(names) == 0 {
+		entries, err := ListConfigs()
+		if err != nil {
+			return nil, err
+		}
+		names = nil
+		for _, e := range entries {
+			if len(tags) == 0 || hasAnyTag(e.Tags, tags) {
+				names = append(names, e.Name)
+			}
+		}
+		return names, nil
+	}
+
+	var selected []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if len(tags) > 0 {
+			cfg, err := Load(name)
+			if err != nil {
+				return nil, err
+			}
+			if !hasAnyTag(cfg.Site.Tags, tags) {
+				continue
+			}
+		}
+		selected = append(selected, name)
+	}
+	return selected, nil
+}
+
+func hasAnyTag(have, want []string) bool {
+	for _, t := range want {
+		for _, h := range have {
+			if strings.EqualFold(h, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func validateConfigName(name string) error {
 	trimmed := strings.TrimSpace(name)
 	if trimmed == "" {
@@ -124,9 +187,80 @@ func LoadFromPath(path string) (*Config, error) {
 	}
 	cfg.configFilePath = path
 	resolveConfigVariables(&cfg)
+	if err := ValidateReplacePairs(cfg.Replace); err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+	if err := validateColumnScopes(&cfg); err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+	if err := validateSafety(cfg.Safety); err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
 	return &cfg, nil
 }
 
+// validateSafety checks that the [safety] patterns are valid globs, so a
+// typo cannot silently disable a protection.
+func validateSafety(s SafetyConfig) error {
+	for _, p := range s.AllowedHosts {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("safety.allowed_hosts: invalid pattern %q", p)
+		}
+	}
+	for _, p := range s.ProtectedDBs {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("safety.protected_dbs: invalid pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// ValidateReplacePairs checks that every regex pair compiles and that table
+// scopes are valid patterns.
+func ValidateReplacePairs(pairs []ReplacePair) error {
+	for i, p := range pairs {
+		for _, t := range append(append([]string(nil), p.Tables...), p.ExcludeTables...) {
+			table, _, _ := strings.Cut(t, ".")
+			if _, err := path.Match(table, ""); err != nil || strings.TrimSpace(table) == "" {
+				return fmt.Errorf("replace #%d: invalid table %q", i+1, t)
+			}
+		}
+		if !p.Regex {
+			continue
+		}
+		pattern := p.Search
+		if p.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("replace #%d: invalid regex %q: %w", i+1, p.Search, err)
+		}
+	}
+	return nil
+}
+
+// validateColumnScopes checks that a dump made by sitesync has the column
+// names that "table.column" scopes need. Without them such a pair cannot
+// be told apart from the rest of the row, and step 2 would fail.
+func validateColumnScopes(cfg *Config) error {
+	if cfg.Source.Type != "remote_base" && cfg.Source.Type != "local_base" {
+		return nil
+	}
+	for _, opt := range strings.Fields(cfg.Database.SQLOptionsStructure + " " + cfg.Database.SQLOptionsExtra) {
+		if opt == "--complete-insert" || opt == "-c" {
+			return nil
+		}
+	}
+	for i, p := range cfg.Replace {
+		for _, t := range append(append([]string(nil), p.Tables...), p.ExcludeTables...) {
+			if strings.Contains(t, ".") {
+				return fmt.Errorf("replace #%d: column scope %q needs --complete-insert in database.sql_options_extra", i+1, t)
+			}
+		}
+	}
+	return nil
+}
+
 // resolveConfigVariables replaces $var / ${var} references in Replace and Sync
 // pairs with actual values from the config. This is a safety net for configs
 // migrated from the old shell format that still contain literal variable names.
@@ -230,3 +364,15 @@ func LogFile(cfg *Config) string {
 func TmpDir() string {
 	return filepath.Join(etcDir(), "tmp")
 }
+
+// SnapshotDir returns the absolute path to the directory holding the
+// pre-import database snapshots of the named config (inside the etc dir).
+func SnapshotDir(name string) string {
+	return filepath.Join(etcDir(), "snapshots", name)
+}
+
+// HistoryFile returns the absolute path to the run history of the named
+// config (inside the etc dir), one JSON record per line.
+func HistoryFile(name string) string {
+	return filepath.Join(etcDir(), "history", name+".jsonl")
+}
@@ -0,0 +1,196 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+	"github.com/carlosrgl/sitesync/internal/logger"
+)
+
+// BatchResult is the outcome of one site of a batch run.
+type BatchResult struct {
+	Site   string
+	Status RunStatus
+	Kind   ErrorKind // unless Status is RunOK
+	Err    string
+	Took   time.Duration
+}
+
+// errNeedsKeyAuth explains a failed batch run that asked for a password.
+const errNeedsKeyAuth = "an SSH password was asked: batch runs need key authentication"
+
+// RunBatch syncs sites, up to jobs at a time, and returns their results in
+// the order of sites. Each site runs like a headless sync of its own, with
+// its lock, log file and history; a site locked by another run fails
+// without waiting.
+//
+// Batch runs are unattended: a failed step follows the on-error policy and
+// otherwise stops its site, a password prompt is cancelled and confirmations
+// are refused, so a push cannot be batched. on receives every event of
+// every site, one at a time; the replies are sent by RunBatch.
+func RunBatch(ctx context.Context, sites []string, op Op, opts Options, jobs int, on func(site string, ev Event)) []BatchResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+	var mu sync.Mutex
+	emit := func(site string, ev Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		on(site, ev)
+	}
+
+	results := make([]BatchResult, len(sites))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	// Sites start in order, each as soon as one of the jobs slots is free.
+	for i, site := range sites {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = BatchResult{Site: site, Status: RunCancelled, Kind: KindCancelled, Err: "not started"}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = runBatchSite(ctx, site, op, opts, emit)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func runBatchSite(ctx context.Context, site string, op Op, opts Options, emit func(string, Event)) BatchResult {
+	start := time.Now()
+	res := BatchResult{Site: site, Status: RunOK}
+	fail := func(kind ErrorKind, msg string) {
+		res.Kind, res.Err = kind, msg
+		res.Status = RunFailed
+		if kind == KindCancelled {
+			res.Status = RunCancelled
+		}
+	}
+
+	cfg, err := config.Load(site)
+	if err != nil {
+		emit(site, Event{Type: EvStepFail, Step: 1, Kind: KindConfig, Message: err.Error()})
+		fail(KindConfig, err.Error())
+		res.Took = time.Since(start)
+		return res
+	}
+	log, err := logger.New(config.LogFile(cfg))
+	if err != nil {
+		log = logger.Discard()
+	}
+	defer log.Close()
+
+	eventCh := make(chan Event, 64)
+	go Run(ctx, cfg, op, opts, eventCh, log)
+
+	var lastErr string
+	var lastKind ErrorKind
+	askedPassword := false
+	for ev := range eventCh {
+		emit(site, ev)
+		switch {
+		case ev.Type == EvStepFail:
+			lastErr, lastKind = ev.Message, ev.Kind
+			if ev.ReplyCh != nil {
+				ev.ReplyCh <- ActionQuit
+			}
+		case ev.AuthReplyCh != nil:
+			askedPassword = true
+			ev.AuthReplyCh <- AuthReply{Cancel: true}
+		case ev.ConfirmCh != nil:
+			ev.ConfirmCh <- false
+		}
+	}
+	res.Took = time.Since(start)
+
+	switch {
+	case lastErr == "":
+	case ctx.Err() != nil:
+		fail(KindCancelled, lastErr)
+	case askedPassword && lastKind == KindCancelled:
+		fail(KindAuth, errNeedsKeyAuth)
+	default:
+		fail(lastKind, lastErr)
+	}
+	return res
+}
+
+// RunBatchHeadless runs a batch, printing the steps of every site to out
+// with the site name in front, then a summary table.
+func RunBatchHeadless(ctx context.Context, sites []string, op Op, opts Options, jobs int, out io.Writer) error {
+	width := 0
+	for _, site := range sites {
+		width = max(width, len(site))
+	}
+	results := RunBatch(ctx, sites, op, opts, jobs, func(site string, ev Event) {
+		switch ev.Type {
+		case EvStepStart:
+			fmt.Fprintf(out, "  %-*s  ◉ [%d/7] %s ...\n", width, site, ev.Step, op.StepName(ev.Step))
+		case EvStepDone:
+			fmt.Fprintf(out, "  %-*s  ✔ [%d/7] %s done\n", width, site, ev.Step, op.StepName(ev.Step))
+		case EvStepFail:
+			msg, _, _ := strings.Cut(ev.Message, "\n")
+			fmt.Fprintf(out, "  %-*s  ✘ [%d/7] %s FAILED: %s\n", width, site, ev.Step, op.StepName(ev.Step), msg)
+		case EvDone:
+			fmt.Fprintf(out, "  %-*s  ✔ sync complete\n", width, site)
+		}
+	})
+	PrintBatchSummary(out, results)
+	return BatchError(results)
+}
+
+// BatchError returns the error of a batch run, or nil when every site
+// succeeded. Its kind is that of the failures when they all share one.
+func BatchError(results []BatchResult) error {
+	var failed int
+	kind := KindOther
+	for _, r := range results {
+		if r.Status == RunOK {
+			continue
+		}
+		if failed == 0 {
+			kind = r.Kind
+		} else if r.Kind != kind {
+			kind = KindOther
+		}
+		failed++
+	}
+	if failed == 0 {
+		return nil
+	}
+	return &RunError{Kind: kind, Err: fmt.Errorf("%d of %d sites failed", failed, len(results))}
+}
+
+// PrintBatchSummary writes one line per site of a batch run.
+func PrintBatchSummary(w io.Writer, results []BatchResult) {
+	width := len("Site")
+	for _, r := range results {
+		width = max(width, len(r.Site))
+	}
+	fmt.Fprintf(w, "\n  %-*s  %-11s  %8s  %s\n", width, "Site", "Status", "Took", "Error")
+	for _, r := range results {
+		icon := "✔"
+		switch r.Status {
+		case RunFailed:
+			icon = "✘"
+		case RunCancelled:
+			icon = "⊘"
+		}
+		errText := ""
+		if r.Status != RunOK {
+			msg, _, _ := strings.Cut(r.Err, "\n")
+			errText = fmt.Sprintf("%s: %s", r.Kind, msg)
+		}
+		fmt.Fprintf(w, "  %-*s  %s %-9s  %8s  %s\n", width, r.Site, icon, r.Status, formatDuration(r.Took), errText)
+	}
+}
@@ -0,0 +1,55 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunBatch(t *testing.T) {
+	etc := t.TempDir()
+	t.Setenv("SITESYNC_ETC", etc)
+	for name, exit := range map[string]string{"blog": "0", "shop": "1"} {
+		hooks := filepath.Join(etc, name, "hook", "after")
+		if err := os.MkdirAll(hooks, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(hooks, "h.sh"), []byte("#!/bin/bash\nexit "+exit+"\n"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(etc, name, "config.toml"), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	err := RunBatchHeadless(context.Background(), []string{"shop", "blog", "gone"}, OpFiles, Options{Steps: StepsOf(7)}, 2, &out)
+	if ExitCode(err) != 1 || !strings.Contains(err.Error(), "2 of 3 sites failed") {
+		t.Fatalf("RunBatchHeadless = %v, want 2 of 3 sites failed with mixed kinds", err)
+	}
+	for _, want := range []string{
+		"blog  ✔ sync complete",
+		"shop  ✘ [7/7] After hooks FAILED",
+		"shop  ✘ failed",
+		"gone  ✘ failed",
+		"config: loading",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	results := RunBatch(context.Background(), []string{"shop", "blog"}, OpFiles, Options{Steps: StepsOf(7)}, 1, func(string, Event) {})
+	if results[0].Site != "shop" || results[0].Kind != KindHook || results[1].Status != RunOK {
+		t.Fatalf("RunBatch = %+v", results)
+	}
+	if got := ExitCode(BatchError(results)); got != KindHook.ExitCode() {
+		t.Fatalf("exit code = %d, want the hook code", got)
+	}
+	if last := LastRun("blog"); last == nil || last.Status != RunOK {
+		t.Fatalf("LastRun(blog) = %+v, want ok", last)
+	}
+}
@@ -71,3 +71,18 @@ func shellQuote(arg string) string {
 	}
 	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
 }
+
+// niceCommand prefixes bin and args with the nice/ionice wrapper parsed from
+// raw (e.g. "ionice -c3 nice"), returning the program to execute and its
+// arguments. An empty wrapper returns bin and args unchanged.
+func niceCommand(raw, bin string, args []string) (string, []string, error) {
+	wrapper, err := appendSplitArgs(nil, raw)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(wrapper) == 0 {
+		return bin, args, nil
+	}
+	full := append(wrapper[1:], bin)
+	return wrapper[0], append(full, args...), nil
+}
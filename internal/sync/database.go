@@ -61,11 +61,22 @@ func FetchDump(ctx context.Context, cfg *config.Config, dumpPath string, eventCh
 
 // ImportDump implements Step 4: import the SQL dump into the local database.
 func ImportDump(ctx context.Context, cfg *config.Config, dumpPath string, eventCh chan<- Event, step int) error {
+	return importDump(ctx, cfg, dumpPath, cfg.Destination.DBName, eventCh, step)
+}
+
+// importDump pipes dumpPath into mysql on the destination server, with db
+// as the default database. An empty db selects none, for dumps made with
+// --databases that create and select their database themselves.
+func importDump(ctx context.Context, cfg *config.Config, dumpPath, db string, eventCh chan<- Event, step int) error {
 	sendLog := func(msg string) {
 		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: msg})
 	}
 
-	sendLog(fmt.Sprintf("  target: %s@%s → %s", cfg.Destination.DBUser, cfg.Destination.DBHostname, cfg.Destination.DBName))
+	target := db
+	if target == "" {
+		target = "(database of the dump)"
+	}
+	sendLog(fmt.Sprintf("  target: %s@%s → %s", cfg.Destination.DBUser, cfg.Destination.DBHostname, target))
 
 	f, err := os.Open(dumpPath)
 	if err != nil {
@@ -97,8 +108,15 @@ func ImportDump(ctx context.Context, cfg *config.Config, dumpPath string, eventC
 		reader = newMariaDBStripper(reader, sendLog)
 	}
 
-	mysqlArgs := buildMySQLArgs(cfg)
-	mysql := exec.CommandContext(ctx, mysqlBin(cfg), mysqlArgs...)
+	mysqlArgs := destConnArgs(cfg)
+	if db != "" {
+		mysqlArgs = append(mysqlArgs, db)
+	}
+	bin, args, err := niceCommand(cfg.Destination.LocalNice, mysqlBin(cfg), mysqlArgs)
+	if err != nil {
+		return fmt.Errorf("parse local_nice: %w", err)
+	}
+	mysql := exec.CommandContext(ctx, bin, args...)
 	// Wrap reader with progress tracking.
 	if fileSize > 0 {
 		reader = &progressReader{
@@ -112,7 +130,7 @@ func ImportDump(ctx context.Context, cfg *config.Config, dumpPath string, eventC
 	mysql.Stdin = reader
 
 	// Log the command with password redacted.
-	sendLog(fmt.Sprintf("  $ %s %s", mysqlBin(cfg), redactArgs(mysqlArgs)))
+	sendLog(fmt.Sprintf("  $ %s %s", bin, redactArgs(args)))
 
 	if err := streamCmd(ctx, eventCh, step, mysql, true); err != nil {
 		return fmt.Errorf("mysql import failed for %s: %w", filepath.Base(dumpPath), err)
@@ -157,26 +175,54 @@ func dumpLocalDB(ctx context.Context, cfg *config.Config, dumpPath string, log f
 	if err != nil {
 		return err
 	}
-	return runDump(ctx, cfg, args, dumpPath, log)
+	return runDump(ctx, cfg, args, dumpPath, dumpCompressed(cfg), log)
 }
 
-func dumpRemoteDB(ctx context.Context, cfg *config.Config, dumpPath string, eventCh chan<- Event, log func(string)) error {
-	// Build the mysqldump command to run remotely over SSH.
+// buildRemoteDumpCommand returns the shell command run over SSH for a
+// remote_base dump, plus a log-safe version with the password redacted.
+// When compression is enabled the output is piped through gzip, with
+// pipefail set where the remote shell supports it so a failing mysqldump
+// is not masked by gzip's exit status.
+func buildRemoteDumpCommand(cfg *config.Config) (remoteCmd, logCmd string, err error) {
 	dumpBin := cfg.Source.PathToMysqldump
 	if dumpBin == "" {
 		dumpBin = "mysqldump"
 	}
-	remoteParts := []string{dumpBin}
 	remoteArgs, err := buildDumpArgs(cfg, true)
 	if err != nil {
-		return err
+		return "", "", err
+	}
+	niceBin, niceArgs, err := niceCommand(cfg.Source.RemoteNice, dumpBin, remoteArgs)
+	if err != nil {
+		return "", "", fmt.Errorf("parse remote_nice: %w", err)
+	}
+	remoteCmd = shellJoin(append([]string{niceBin}, niceArgs...))
+	logCmd = niceBin + " " + redactArgs(niceArgs)
+
+	if dumpCompressed(cfg) {
+		gzBin, gzArgs, _ := niceCommand(cfg.Source.RemoteNice, "gzip", []string{"-c"})
+		gzParts := append([]string{gzBin}, gzArgs...)
+		remoteCmd = "(set -o pipefail) 2>/dev/null && set -o pipefail; " + remoteCmd + " | " + shellJoin(gzParts)
+		logCmd += " | " + strings.Join(gzParts, " ")
 	}
-	remoteParts = append(remoteParts, remoteArgs...)
-	quoted := make([]string, len(remoteParts))
-	for i, part := range remoteParts {
+	return remoteCmd, logCmd, nil
+}
+
+// shellJoin quotes each part for a POSIX shell and joins them with spaces.
+func shellJoin(parts []string) string {
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
 		quoted[i] = shellQuote(part)
 	}
-	remoteCmd := strings.Join(quoted, " ")
+	return strings.Join(quoted, " ")
+}
+
+func dumpRemoteDB(ctx context.Context, cfg *config.Config, dumpPath string, eventCh chan<- Event, log func(string)) error {
+	// Build the mysqldump command to run remotely over SSH.
+	remoteCmd, logCmd, err := buildRemoteDumpCommand(cfg)
+	if err != nil {
+		return err
+	}
 
 	baseArgs := []string{
 		fmt.Sprintf("%s@%s", cfg.Source.User, cfg.Source.Server),
@@ -185,11 +231,10 @@ func dumpRemoteDB(ctx context.Context, cfg *config.Config, dumpPath string, even
 	target := fmt.Sprintf("%s@%s", cfg.Source.User, cfg.Source.Server)
 	return runSSHCommandWithPasswordPrompt(ctx, eventCh, 1, target, log, func(extraEnv []string, batchMode bool) error {
 		cmdArgs := append(sshArgs(cfg.Source.Port, batchMode), baseArgs...)
-		log(fmt.Sprintf("  $ ssh %s %s %s %s",
+		log(fmt.Sprintf("  $ ssh %s %s %s",
 			strings.Join(cmdArgs[:len(cmdArgs)-2], " "),
 			cfg.Source.User+"@"+cfg.Source.Server,
-			dumpBin,
-			redactArgs(remoteParts[1:])))
+			logCmd))
 
 		out, err := os.OpenFile(dumpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 		if err != nil {
@@ -222,12 +267,20 @@ func dumpRemoteDB(ctx context.Context, cfg *config.Config, dumpPath string, even
 	})
 }
 
-func runDump(ctx context.Context, cfg *config.Config, args []string, dumpPath string, log func(string)) error {
+func runDump(ctx context.Context, cfg *config.Config, args []string, dumpPath string, compress bool, log func(string)) error {
 	dumpBin := cfg.Destination.PathToMysqldump
 	if dumpBin == "" {
 		dumpBin = "mysqldump"
 	}
-	log(fmt.Sprintf("  $ %s %s", dumpBin, redactArgs(args)))
+	bin, args, err := niceCommand(cfg.Destination.LocalNice, dumpBin, args)
+	if err != nil {
+		return fmt.Errorf("parse local_nice: %w", err)
+	}
+	if compress {
+		log(fmt.Sprintf("  $ %s %s | gzip", bin, redactArgs(args)))
+	} else {
+		log(fmt.Sprintf("  $ %s %s", bin, redactArgs(args)))
+	}
 
 	out, err := os.OpenFile(dumpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
@@ -235,8 +288,14 @@ func runDump(ctx context.Context, cfg *config.Config, args []string, dumpPath st
 	}
 	defer out.Close()
 
-	cmd := exec.CommandContext(ctx, dumpBin, args...)
-	cmd.Stdout = out
+	cmd := exec.CommandContext(ctx, bin, args...)
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(out)
+		cmd.Stdout = gz
+	} else {
+		cmd.Stdout = out
+	}
 	stderrPipe, _ := cmd.StderrPipe()
 	if err := cmd.Start(); err != nil {
 		return err
@@ -256,7 +315,13 @@ func runDump(ctx context.Context, cfg *config.Config, args []string, dumpPath st
 	}
 	err = cmd.Wait()
 	wg.Wait()
-	return err
+	if err != nil {
+		return err
+	}
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
 }
 
 func buildDumpArgs(cfg *config.Config, remote bool) ([]string, error) {
@@ -278,6 +343,22 @@ func buildDumpArgs(cfg *config.Config, remote bool) ([]string, error) {
 	}
 
 	src := cfg.Source
+	args = append(args, srcConnArgs(cfg)...)
+	for _, tbl := range cfg.Database.IgnoreTables {
+		args = append(args, fmt.Sprintf("--ignore-table=%s.%s", src.DBName, tbl))
+	}
+	// Append DBName for both local and remote; guard against empty name.
+	if src.DBName != "" {
+		args = append(args, src.DBName)
+	}
+	_ = remote // reserved for future use (e.g. --compress flag differentiation)
+	return args, nil
+}
+
+// srcConnArgs returns the host and credential flags of the source database.
+func srcConnArgs(cfg *config.Config) []string {
+	src := cfg.Source
+	var args []string
 	args = append(args, "-h", src.DBHostname)
 	if src.DBPort != "" {
 		args = append(args, "-P", src.DBPort)
@@ -288,18 +369,16 @@ func buildDumpArgs(cfg *config.Config, remote bool) ([]string, error) {
 	if src.DBPassword != "" {
 		args = append(args, fmt.Sprintf("-p%s", src.DBPassword))
 	}
-	for _, tbl := range cfg.Database.IgnoreTables {
-		args = append(args, fmt.Sprintf("--ignore-table=%s.%s", src.DBName, tbl))
-	}
-	// Append DBName for both local and remote; guard against empty name.
-	if src.DBName != "" {
-		args = append(args, src.DBName)
-	}
-	_ = remote // reserved for future use (e.g. --compress flag differentiation)
-	return args, nil
+	return args
 }
 
 func buildMySQLArgs(cfg *config.Config) []string {
+	return append(destConnArgs(cfg), cfg.Destination.DBName)
+}
+
+// destConnArgs returns the host and credential flags of the destination
+// database, shared by mysql and the snapshot mysqldump.
+func destConnArgs(cfg *config.Config) []string {
 	dst := cfg.Destination
 	var args []string
 	args = append(args, "-h", dst.DBHostname)
@@ -312,7 +391,6 @@ func buildMySQLArgs(cfg *config.Config) []string {
 	if dst.DBPassword != "" {
 		args = append(args, fmt.Sprintf("-p%s", dst.DBPassword))
 	}
-	args = append(args, dst.DBName)
 	return args
 }
 
@@ -374,8 +452,10 @@ func streamCmd(ctx context.Context, eventCh chan<- Event, step int, cmd *exec.Cm
 		go scan(stdoutPipe)
 	}
 
+	// Drain the pipes before Wait, which closes them and could otherwise
+	// drop the last lines (the ones the error context needs most).
+	wg.Wait()
 	err := cmd.Wait()
-	wg.Wait() // drain all log lines before returning
 	if err != nil {
 		if lines := tail.Lines(); len(lines) > 0 {
 			return fmt.Errorf("%w\nlast output:\n%s", err, strings.Join(lines, "\n"))
@@ -419,6 +499,53 @@ func DumpFilePath(tmpDir, confName string) string {
 	return filepath.Join(tmpDir, fmt.Sprintf("%s.sql", confName))
 }
 
+// FetchFilePath returns the path Step 1 writes to. It is dumpPath with a
+// ".gz" suffix when the dump arrives gzip-compressed, either because
+// source.compress is set for a *_base source or because the *_file source
+// is already a .gz file.
+func FetchFilePath(cfg *config.Config, dumpPath string) string {
+	if dumpCompressed(cfg) {
+		return dumpPath + ".gz"
+	}
+	return dumpPath
+}
+
+// dumpCompressed reports whether Step 1 produces a gzip-compressed dump.
+func dumpCompressed(cfg *config.Config) bool {
+	switch cfg.Source.Type {
+	case "remote_base", "local_base":
+		return cfg.Source.Compress
+	case "remote_file", "local_file":
+		return strings.HasSuffix(cfg.Source.File, ".gz")
+	}
+	return false
+}
+
+// expandDump decompresses the gzip file at src into dst.
+func expandDump(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", filepath.Base(src), err)
+	}
+	defer in.Close()
+
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("open gzip reader: %w", err)
+	}
+	defer gr.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("create dump file: %w", err)
+	}
+	if _, err := io.Copy(out, gr); err != nil {
+		out.Close()
+		return fmt.Errorf("decompress %s: %w", filepath.Base(src), err)
+	}
+	return out.Close()
+}
+
 // progressReader wraps an io.Reader and emits EvProgress events as data is read.
 type progressReader struct {
 	r       io.Reader
@@ -452,30 +579,46 @@ var mariaDBCommentRe = regexp.MustCompile(`/\*M!.*?\*/`)
 var mariaDBLineRe = regexp.MustCompile(`(?m)^\s*/\*M!.*?\*/\s*;?\s*$`)
 
 // newMariaDBStripper returns an io.Reader that strips MariaDB-specific
-// comments line-by-line from r before passing data downstream.
+// comments line-by-line from r before passing data downstream. Lines longer
+// than maxLinePiece are streamed through in pieces.
 func newMariaDBStripper(r io.Reader, logFn func(string)) io.Reader {
 	pr, pw := io.Pipe()
 	go func() {
 		defer pw.Close()
-		sc := bufio.NewScanner(r)
-		sc.Buffer(make([]byte, 16*1024*1024), 16*1024*1024) // 16 MB line buffer
+		lr := newLineReader(r, maxLinePiece)
+		bw := bufio.NewWriter(pw)
 		stripped := 0
-		for sc.Scan() {
-			line := sc.Bytes()
-			// Skip full-line MariaDB comments entirely.
-			if mariaDBLineRe.Match(line) {
+		var buf []byte
+		for {
+			line, full, err := lr.next(buf)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			buf = line[:0]
+			switch {
+			case !full:
+				// Only INSERTs get this long; they can hold inline comments
+				// but are never comment lines.
+				err = stripLongLine(line, lr, bw)
+			case mariaDBLineRe.Match(line):
+				// Skip full-line MariaDB comments entirely.
 				stripped++
 				continue
+			default:
+				// Strip inline MariaDB comments within a line.
+				bw.Write(mariaDBCommentRe.ReplaceAll(line, nil))
+				err = bw.WriteByte('\n')
 			}
-			// Strip inline MariaDB comments within a line.
-			cleaned := mariaDBCommentRe.ReplaceAll(line, nil)
-			// Write the (possibly cleaned) line + newline.
-			if _, err := pw.Write(append(cleaned, '\n')); err != nil {
+			if err != nil {
 				pw.CloseWithError(err)
 				return
 			}
 		}
-		if err := sc.Err(); err != nil {
+		if err := bw.Flush(); err != nil {
 			pw.CloseWithError(err)
 			return
 		}
@@ -486,6 +629,55 @@ func newMariaDBStripper(r io.Reader, logFn func(string)) io.Reader {
 	return pr
 }
 
+// stripLongLine removes inline MariaDB comments from a line too long to
+// hold in memory: head is its start and the rest is read from lr. A comment
+// left open at the end of the line is dropped.
+func stripLongLine(head []byte, lr *lineReader, w *bufio.Writer) error {
+	const openMark, closeMark = "/*M!", "*/"
+	inComment := false
+	buf := head
+	for {
+		var (
+			eol bool
+			err error
+		)
+		if buf, eol, err = lr.more(buf, maxLinePiece); err != nil {
+			return err
+		}
+		// Until the line ends, hold back enough bytes for a marker that
+		// straddles the end of buf.
+		limit := len(buf) - (len(openMark) - 1)
+		if eol {
+			buf = trimCR(buf)
+			limit = len(buf)
+		}
+		i := 0
+		for i < limit {
+			if inComment {
+				j := bytes.Index(buf[i:], []byte(closeMark))
+				if j < 0 || i+j >= limit {
+					i = limit
+					break
+				}
+				i, inComment = i+j+len(closeMark), false
+				continue
+			}
+			j := bytes.Index(buf[i:], []byte(openMark))
+			if j < 0 || i+j >= limit {
+				w.Write(buf[i:limit])
+				i = limit
+				break
+			}
+			w.Write(buf[i : i+j])
+			i, inComment = i+j+len(openMark), true
+		}
+		if eol {
+			return w.WriteByte('\n')
+		}
+		buf = append(buf[:0], buf[i:]...)
+	}
+}
+
 // isMariaDBDump does a quick check on the first few KB of a file to detect
 // whether it contains MariaDB-specific /*M! comments that need stripping.
 func isMariaDBDump(path string) bool {
@@ -0,0 +1,256 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+	"github.com/carlosrgl/sitesync/internal/logger"
+)
+
+// Doctor checks the named site config end to end without changing
+// anything: where the config is found, SSH access, the source database
+// credentials, the [[sync]] paths, the hook scripts and the log file.
+// Unlike Preflight it never prompts, so SSH only tries key authentication.
+func Doctor(ctx context.Context, name string) []Check {
+	var checks []Check
+	add := func(c Check) { checks = append(checks, c) }
+
+	dir, how := config.EtcDir()
+	etc := Check{Name: "etc dir", Status: CheckPass}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		etc.Status, etc.Detail = CheckFail, fmt.Sprintf("%s (%s) does not exist", dir, how)
+		etc.Hint = "run sitesync setup, or set SITESYNC_ETC to the directory holding your site configs"
+	} else if entries, err := config.ListConfigs(); err != nil {
+		etc.Status, etc.Detail = CheckFail, err.Error()
+	} else {
+		etc.Detail = fmt.Sprintf("%s (%s), %d config(s)", dir, how, len(entries))
+	}
+	add(etc)
+
+	cfg, err := config.Load(name)
+	if err != nil {
+		add(Check{Name: "config", Status: CheckFail, Detail: err.Error(),
+			Hint: fmt.Sprintf("create it with sitesync setup or fix %s", filepath.Join(dir, name, "config.toml"))})
+		return checks
+	}
+	add(Check{Name: "config", Status: CheckPass, Detail: cfg.ConfigFilePath()})
+
+	rsyncOn := len(cfg.Sync) > 0 && cfg.Transport.Type != "lftp"
+	sshOn := cfg.Source.Type == "remote_base" || cfg.Source.Type == "remote_file" || rsyncOn
+	sshOK := false
+	if sshOn {
+		c := doctorSSH(ctx, cfg)
+		sshOK = c.Status == CheckPass
+		add(c)
+	}
+
+	switch cfg.Source.Type {
+	case "remote_base":
+		if sshOK {
+			add(doctorRemoteDB(ctx, cfg))
+		} else {
+			add(Check{Name: "source database", Status: CheckWarn, Detail: "not checked without SSH access"})
+		}
+	case "local_base":
+		add(doctorLocalSourceDB(ctx, cfg))
+	case "remote_file":
+		if sshOK {
+			add(doctorRemotePaths(ctx, cfg, "source file", []string{cfg.Source.File}, "check source.file"))
+		}
+	case "local_file":
+		c := Check{Name: "source file", Status: CheckPass, Detail: cfg.Source.File}
+		if _, err := os.Stat(cfg.Source.File); err != nil {
+			c.Status, c.Detail, c.Hint = CheckFail, err.Error(), "check source.file"
+		}
+		add(c)
+	}
+	add(checkLocalDB(ctx, cfg))
+
+	if len(cfg.Sync) > 0 {
+		if rsyncOn && sshOK {
+			srcs := make([]string, len(cfg.Sync))
+			for i, sp := range cfg.Sync {
+				srcs[i] = sp.Src
+			}
+			add(doctorRemotePaths(ctx, cfg, "sync src", srcs, "check the [[sync]] src paths on the server"))
+		}
+		for _, sp := range cfg.Sync {
+			add(doctorWritableDir("sync dst", sp.Dst))
+		}
+	}
+
+	checks = append(checks, doctorHooks(cfg)...)
+	add(doctorLogFile(cfg))
+	return checks
+}
+
+// sshBatch runs remoteCmd on the source server with key authentication only.
+func sshBatch(ctx context.Context, cfg *config.Config, remoteCmd string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	target := cfg.Source.User + "@" + cfg.Source.Server
+	cmd := exec.CommandContext(ctx, "ssh", append(sshArgs(cfg.Source.Port, true), target, remoteCmd)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("%w: %s", err, msg)
+		}
+		return stdout.String(), err
+	}
+	return stdout.String(), nil
+}
+
+func doctorSSH(ctx context.Context, cfg *config.Config) Check {
+	target := cfg.Source.User + "@" + cfg.Source.Server
+	c := Check{Name: "ssh", Status: CheckPass, Detail: fmt.Sprintf("%s (port %d)", target, cfg.Source.Port)}
+	_, err := sshBatch(ctx, cfg, "true")
+	switch {
+	case err == nil:
+	case shouldPromptForSSHPassword(err):
+		// A sync still works, it just asks for the password.
+		c.Status, c.Detail = CheckWarn, "key authentication failed; sitesync will ask for the password"
+		c.Hint = fmt.Sprintf("ssh-copy-id -p %d %s", cfg.Source.Port, target)
+	default:
+		c.Status, c.Detail = CheckFail, err.Error()
+		c.Hint = fmt.Sprintf("check source.server, source.user and source.port, then try: ssh -p %d %s", cfg.Source.Port, target)
+	}
+	return c
+}
+
+func doctorRemoteDB(ctx context.Context, cfg *config.Config) Check {
+	c := Check{Name: "source database", Status: CheckPass,
+		Detail: fmt.Sprintf("%s@%s/%s", cfg.Source.DBUser, cfg.Source.DBHostname, cfg.Source.DBName)}
+	args := append([]string{remoteMySQLBin(cfg), "-N", "-B", "--connect-timeout=5"}, srcConnArgs(cfg)...)
+	args = append(args, "-e", "SELECT 1", cfg.Source.DBName)
+	// mysql's error is the last line of its output, after any password
+	// warning.
+	if out, err := sshBatch(ctx, cfg, shellJoin(args)+" 2>&1"); err != nil {
+		c.Status, c.Detail = CheckFail, lastLine(out)
+		if c.Detail == "" {
+			c.Detail = err.Error()
+		}
+		c.Hint = "check the [source] db_* settings, and that mysql is installed on the server"
+	}
+	return c
+}
+
+func doctorLocalSourceDB(ctx context.Context, cfg *config.Config) Check {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	c := Check{Name: "source database", Status: CheckPass,
+		Detail: fmt.Sprintf("%s@%s/%s", cfg.Source.DBUser, cfg.Source.DBHostname, cfg.Source.DBName)}
+	args := append([]string{"--connect-timeout=5"}, srcConnArgs(cfg)...)
+	args = append(args, "-e", "SELECT 1", cfg.Source.DBName)
+	if out, err := exec.CommandContext(ctx, mysqlBin(cfg), args...).CombinedOutput(); err != nil {
+		c.Status, c.Detail = CheckFail, lastLine(string(out))
+		if c.Detail == "" {
+			c.Detail = err.Error()
+		}
+		c.Hint = "check the [source] db_* settings"
+	}
+	return c
+}
+
+// doctorRemotePaths checks that every path exists on the source server.
+func doctorRemotePaths(ctx context.Context, cfg *config.Config, name string, paths []string, hint string) Check {
+	var parts []string
+	for _, p := range paths {
+		parts = append(parts, fmt.Sprintf("test -e %s || echo %s", shellQuote(p), shellQuote(p)))
+	}
+	c := Check{Name: name, Status: CheckPass, Detail: strings.Join(paths, ", ")}
+	out, err := sshBatch(ctx, cfg, strings.Join(parts, "; "))
+	if err != nil {
+		c.Status, c.Detail = CheckFail, err.Error()
+		return c
+	}
+	var missing []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			missing = append(missing, line)
+		}
+	}
+	if len(missing) > 0 {
+		c.Status, c.Detail, c.Hint = CheckFail, "missing on "+cfg.Source.Server+": "+strings.Join(missing, ", "), hint
+	}
+	return c
+}
+
+// doctorWritableDir checks that files can be written to dir, or that it can
+// be created when it does not exist yet.
+func doctorWritableDir(name, dir string) Check {
+	c := Check{Name: name, Status: CheckPass, Detail: dir}
+	target := filepath.Clean(dir)
+	for {
+		if _, err := os.Stat(target); err == nil {
+			break
+		}
+		parent := filepath.Dir(target)
+		if parent == target {
+			break
+		}
+		target = parent
+	}
+	f, err := os.CreateTemp(target, ".sitesync-doctor-*")
+	if err != nil {
+		c.Status, c.Detail = CheckFail, fmt.Sprintf("%s is not writable", target)
+		c.Hint = "fix the permissions of " + target + " or change the [[sync]] dst"
+		return c
+	}
+	f.Close()
+	os.Remove(f.Name())
+	if target != filepath.Clean(dir) {
+		// rsync creates the destination directory itself.
+		c.Status, c.Detail = CheckWarn, dir+" does not exist yet; it will be created"
+	}
+	return c
+}
+
+// doctorHooks lists the hook scripts of each phase and checks their syntax
+// with bash -n.
+func doctorHooks(cfg *config.Config) []Check {
+	var checks []Check
+	var counts []string
+	for _, phase := range []string{"before", "between", "after"} {
+		scripts := hookScripts(cfg, phase)
+		counts = append(counts, fmt.Sprintf("%s: %d", phase, len(scripts)))
+		for _, script := range scripts {
+			out, err := exec.Command("bash", "-n", script).CombinedOutput()
+			if err != nil {
+				detail := lastLine(string(out))
+				if detail == "" {
+					detail = err.Error()
+				}
+				checks = append(checks, Check{Name: "hook " + phase + "/" + filepath.Base(script), Status: CheckFail,
+					Detail: detail, Hint: "fix the script, then check it with: bash -n " + script})
+			}
+		}
+	}
+	summary := Check{Name: "hooks", Status: CheckPass,
+		Detail: fmt.Sprintf("%s (%s)", filepath.Dir(config.HookDir(cfg, "before")), strings.Join(counts, ", "))}
+	return append([]Check{summary}, checks...)
+}
+
+func doctorLogFile(cfg *config.Config) Check {
+	path := config.LogFile(cfg)
+	c := Check{Name: "log file", Status: CheckPass, Detail: path}
+	log, err := logger.New(path)
+	if err != nil {
+		c.Status, c.Detail = CheckFail, err.Error()
+		c.Hint = "fix the permissions of " + filepath.Dir(path) + " or change logging.file"
+		return c
+	}
+	log.Close()
+	return c
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
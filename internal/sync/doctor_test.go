@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	root := t.TempDir()
+	etc := filepath.Join(root, "etc")
+	t.Setenv("SITESYNC_ETC", etc)
+
+	hookDir := filepath.Join(etc, "demo", "hook", "before")
+	if err := os.MkdirAll(hookDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hookDir, "bad.sh"), []byte("echo \"unterminated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hookDir, "good.sh"), []byte("echo ok\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mysql := filepath.Join(root, "mysql")
+	if err := os.WriteFile(mysql, []byte("#!/bin/sh\necho 1\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	dump := filepath.Join(root, "dump.sql")
+	if err := os.WriteFile(dump, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	conf := `[source]
+type = "local_file"
+file = "` + dump + `"
+[destination]
+db_name = "demo_local"
+path_to_mysql = "` + mysql + `"
+[[sync]]
+src = "/srv/demo/"
+dst = "` + filepath.Join(root, "site", "files") + `"
+[transport]
+type = "lftp"
+[logging]
+file = "` + filepath.Join(root, "log", "sitesync.log") + `"
+`
+	if err := os.WriteFile(filepath.Join(etc, "demo", "config.toml"), []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]CheckStatus{}
+	for _, c := range Doctor(context.Background(), "demo") {
+		got[c.Name] = c.Status
+	}
+	want := map[string]CheckStatus{
+		"etc dir":            CheckPass,
+		"config":             CheckPass,
+		"source file":        CheckPass,
+		"local database":     CheckPass,
+		"sync dst":           CheckWarn,
+		"hooks":              CheckPass,
+		"hook before/bad.sh": CheckFail,
+		"log file":           CheckPass,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Doctor() = %v, want %v", got, want)
+	}
+	for name, status := range want {
+		if s, ok := got[name]; !ok || s != status {
+			t.Fatalf("check %q = %v, want %v (all: %v)", name, s, status, got)
+		}
+	}
+
+	checks := Doctor(context.Background(), "missing")
+	if last := checks[len(checks)-1]; last.Name != "config" || last.Status != CheckFail || last.Hint == "" {
+		t.Fatalf("Doctor(missing) ends with %+v, want a failed config check with a hint", last)
+	}
+}
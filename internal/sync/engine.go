@@ -3,9 +3,12 @@ package sync
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -14,101 +17,255 @@ import (
 	term "github.com/charmbracelet/x/term"
 )
 
+// Options changes how Run goes through the steps.
+type Options struct {
+	// Resume skips the steps the previous run of the same op completed,
+	// when the config and the dump are unchanged since.
+	Resume bool
+
+	// Steps restricts the run to these steps of op; zero runs them all.
+	Steps Steps
+
+	// OnError is applied after the on_error policy of [run], so its rules
+	// take precedence.
+	OnError ErrorPolicy
+}
+
 // Run executes the full sync workflow in a goroutine, sending progress events
 // to eventCh. It closes eventCh when done (success or failure).
 //
-// Call as: go Run(ctx, cfg, op, eventCh, log)
-func Run(ctx context.Context, cfg *config.Config, op Op, eventCh chan<- Event, log logger.Logger) {
+// Call as: go Run(ctx, cfg, op, opts, eventCh, log)
+func Run(ctx context.Context, cfg *config.Config, op Op, opts Options, eventCh chan<- Event, log logger.Logger) {
 	defer close(eventCh)
 	ctx = withAuthState(ctx)
+	ctx = withTransferCount(ctx)
+
+	steps := op.Select(opts.Steps)
+	if steps == 0 {
+		sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: 1, Kind: KindConfig,
+			Message: fmt.Sprintf("none of steps %s is part of %s", opts.Steps, op)})
+		return
+	}
+
+	policy, err := ParseErrorPolicy(cfg.Run.OnError)
+	if err != nil {
+		sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: 1, Kind: KindConfig,
+			Message: fmt.Sprintf("run.on_error: %v", err)})
+		return
+	}
+	policy = append(policy, opts.OnError...)
 
 	tmpDir := config.TmpDir()
 	if err := os.MkdirAll(tmpDir, 0700); err != nil {
-		sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: 1,
+		sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: 1, Kind: KindConfig,
 			Message: fmt.Sprintf("cannot create tmp dir: %v", err)})
 		return
 	}
 
 	// Derive config name from file path for the dump file name.
 	confName := filepath.Base(filepath.Dir(cfg.ConfigFilePath()))
+
+	// Every run that gets this far is recorded in the site's history; the
+	// early returns below set the reason it stopped.
+	hist := newRunRecord(confName, op, steps)
+	hist.OnError = policy.String()
+	defer func() {
+		hist.End = time.Now()
+		hist.Transferred = transferred(ctx)
+		if hist.Status != RunOK && ctx.Err() != nil {
+			hist.Status = RunCancelled
+		}
+		if err := AppendHistory(hist); err != nil {
+			log.Logf("%s: cannot save history: %v", confName, err)
+		}
+	}()
+
+	// Two runs of one site would share the dump file and the database.
+	unlock, err := AcquireLock(tmpDir, confName)
+	if err != nil {
+		// Any other error is one of the tmp dir, like the one above.
+		kind := KindConfig
+		var locked *LockedError
+		if errors.As(err, &locked) {
+			kind = KindLocked
+		}
+		sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: 1, Kind: kind, Message: err.Error()})
+		log.Logf("%s: %v", confName, err)
+		hist.Reason = err.Error()
+		return
+	}
+	defer unlock()
+
 	dumpPath := DumpFilePath(tmpDir, confName)
+	// fetchPath differs from dumpPath only when Step 1 produces a gzip
+	// file; Step 2 then expands it so hooks and import see plain SQL.
+	fetchPath := FetchFilePath(cfg, dumpPath)
+	if op == OpPush {
+		// A push dumps the local database, which source.compress does not
+		// cover, so a .gz left by a pull is not its dump.
+		fetchPath = dumpPath
+	}
 
-	skipSQL := op == OpFiles
-	skipFiles := op == OpSQL
+	streaming := useStreaming(cfg, op, steps)
 
-	steps := []struct {
-		name string
-		fn   func() error
-	}{
+	// The destination database is snapshotted once per run, right before it
+	// is first written to, so a retried import does not replace the
+	// snapshot with a half-imported database.
+	snapshotted := !steps.Has(4) || cfg.Database.SnapshotKeep <= 0
+	snapshot := func(step int) error {
+		if snapshotted {
+			return nil
+		}
+		if err := TakeSnapshot(ctx, cfg, confName, eventCh, step); err != nil {
+			return err
+		}
+		snapshotted = true
+		return nil
+	}
+
+	runSteps := []runStep{
 		{"Fetch SQL dump", func() error {
-			if skipSQL {
-				return nil
+			if streaming {
+				if err := snapshot(1); err != nil {
+					return err
+				}
+				return StreamDump(ctx, cfg, eventCh, 1)
 			}
-			return FetchDump(ctx, cfg, dumpPath, eventCh)
+			return FetchDump(ctx, cfg, fetchPath, eventCh)
 		}},
-		{"Find / Replace", func() error {
-			if skipSQL {
+		{"Find / Replace", func() (err error) {
+			if streaming {
+				sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 2,
+					Message: "  applied while streaming (step 1)"})
+				if cfg.Database.VerifySerialized {
+					sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 2,
+						Message: "  ⚠ verify_serialized skipped: no dump file in streaming mode"})
+				}
 				return nil
 			}
-			if fi, err := os.Stat(dumpPath); err == nil {
+			// Without step 1 in this run, the fetch may have been expanded
+			// by an earlier one already.
+			if _, statErr := os.Stat(fetchPath); statErr == nil && fetchPath != dumpPath {
 				sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 2,
-					Message: fmt.Sprintf("  processing %s (%s)", filepath.Base(dumpPath), humanSize(fi.Size()))})
+					Message: fmt.Sprintf("  decompressing %s", filepath.Base(fetchPath))})
+				if err := expandDump(fetchPath, dumpPath); err != nil {
+					return err
+				}
+				// The fetch is kept until the step succeeds, so that a
+				// retried or resumed step starts again from it.
+				defer func() {
+					if err == nil {
+						_ = os.Remove(fetchPath)
+					}
+				}()
 			}
-			for i, pair := range cfg.Replace {
-				sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 2,
-					Message: fmt.Sprintf("  [%d/%d] %q → %q", i+1, len(cfg.Replace), pair.Search, pair.Replace)})
-				if err := ResilientReplaceFile(pair.Search, pair.Replace, dumpPath, ReplaceOptions{}); err != nil {
-					return fmt.Errorf("replace %q: %w", pair.Search, err)
+			if len(cfg.Replace) > 0 {
+				var size int64
+				if fi, err := os.Stat(dumpPath); err == nil {
+					size = fi.Size()
+					sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 2,
+						Message: fmt.Sprintf("  processing %s (%s)", filepath.Base(dumpPath), humanSize(size))})
+				}
+				for i, pair := range cfg.Replace {
+					sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 2,
+						Message: "  " + describePair(i, len(cfg.Replace), pair)})
 				}
-				p := float64(i+1) / float64(len(cfg.Replace))
-				sendEvent(ctx, eventCh, Event{Type: EvProgress, Step: 2, Progress: p})
+				replacer, err := NewMultiReplacer(cfg.Replace)
+				if err != nil {
+					return err
+				}
+				// All pairs are applied in a single pass over the dump,
+				// split into chunks across the worker pool.
+				workers := replaceWorkers(cfg)
+				if workers > 1 {
+					sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 2,
+						Message: fmt.Sprintf("  using %d workers", workers)})
+				}
+				err = rewriteFile(dumpPath, func(r io.Reader, w io.Writer) error {
+					if size > 0 {
+						r = &progressReader{r: r, total: size, eventCh: eventCh, step: 2, ctx: ctx}
+					}
+					return replacer.ReplaceStreamParallel(r, w, workers)
+				})
+				if err != nil {
+					return err
+				}
+				reportReplaceStats(ctx, eventCh, 2, cfg.Replace, replacer)
+			}
+			if cfg.Database.VerifySerialized {
+				return verifyDump(ctx, dumpPath, eventCh, 2)
 			}
 			return nil
 		}},
 		{"Before hooks", func() error {
-			if skipSQL {
-				return nil
-			}
 			return RunHooks(ctx, cfg, "before", dumpPath, eventCh, 3)
 		}},
 		{"Import SQL", func() error {
-			if skipSQL {
+			if streaming {
+				sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 4,
+					Message: "  imported while streaming (step 1)"})
 				return nil
 			}
-			return ImportDump(ctx, cfg, dumpPath, eventCh, 4)
+			importPath := dumpPath
+			if _, err := os.Stat(dumpPath); os.IsNotExist(err) {
+				// Step 2 was skipped; import the compressed fetch directly.
+				importPath = fetchPath
+			}
+			if err := snapshot(4); err != nil {
+				return err
+			}
+			return ImportDump(ctx, cfg, importPath, eventCh, 4)
 		}},
 		{"Between hooks", func() error {
-			if skipSQL {
-				return nil
-			}
 			return RunHooks(ctx, cfg, "between", dumpPath, eventCh, 5)
 		}},
 		{"Sync files", func() error {
-			if skipFiles {
-				return nil
-			}
 			return SyncFiles(ctx, cfg, eventCh, 6)
 		}},
 		{"After hooks", func() error {
-			if skipFiles {
-				return nil
-			}
 			return RunHooks(ctx, cfg, "after", dumpPath, eventCh, 7)
 		}},
 	}
+	if op == OpPush {
+		runSteps = pushSteps(ctx, cfg, dumpPath, eventCh)
+	}
 
 	// Emit connection info.
 	sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
 		Message: fmt.Sprintf("▸ site: %s", confName)})
-	if !skipSQL {
+	if op == OpPush {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+			Message: fmt.Sprintf("▸ push: local → %s@%s", cfg.Source.User, cfg.Source.Server)})
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+			Message: fmt.Sprintf("▸ database: %s → %s", cfg.Destination.DBName, cfg.Source.DBName)})
+		for _, sp := range cfg.Sync {
+			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+				Message: fmt.Sprintf("▸ files: %s → %s", sp.Dst, sp.Src)})
+		}
+	} else if steps.SQL() {
 		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
 			Message: fmt.Sprintf("▸ source: %s@%s (%s)", cfg.Source.User, cfg.Source.Server, cfg.Source.Type)})
 		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
 			Message: fmt.Sprintf("▸ database: %s → %s", cfg.Source.DBName, cfg.Destination.DBName)})
 		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
 			Message: fmt.Sprintf("▸ replacements: %d pairs", len(cfg.Replace))})
+		if streaming {
+			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+				Message: "▸ mode: streaming (no intermediate dump file)"})
+		} else if cfg.Database.Stream {
+			reason := "before hooks need the dump file"
+			if pipeline := StepsOf(1, 2, 4); steps&pipeline != pipeline {
+				reason = "steps 1, 2 and 4 do not all run"
+			}
+			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+				Message: "▸ mode: file (streaming disabled: " + reason + ")"})
+		}
+		if cfg.Database.SnapshotKeep > 0 && steps.Has(4) {
+			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+				Message: fmt.Sprintf("▸ snapshot: %s before import (keeping %d)", cfg.Destination.DBName, cfg.Database.SnapshotKeep)})
+		}
 	}
-	if !skipFiles {
+	if steps.Files() && op != OpPush {
 		for _, sp := range cfg.Sync {
 			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
 				Message: fmt.Sprintf("▸ files: %s → %s", sp.Src, sp.Dst)})
@@ -116,25 +273,165 @@ func Run(ctx context.Context, cfg *config.Config, op Op, eventCh chan<- Event, l
 		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
 			Message: fmt.Sprintf("▸ transport: %s", cfg.Transport.Type)})
 	}
+	if steps != op.Steps() {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+			Message: fmt.Sprintf("▸ steps: %s only", steps)})
+	}
+	if len(policy) > 0 {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+			Message: fmt.Sprintf("▸ on error: %s", policy)})
+	}
 	sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0, Message: ""})
 
-	log.Logf("=== sitesync start: %s (op=%v) ===", confName, op)
+	// A push writes to the server, so it must be enabled in the config and
+	// confirmed by typing the name of the database it overwrites.
+	if op == OpPush {
+		if err := checkPush(cfg); err != nil {
+			log.Logf("%s: %v", confName, err)
+			hist.Reason = err.Error()
+			sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: 1, Kind: KindConfig, Message: err.Error()})
+			return
+		}
+		if !confirmPush(ctx, cfg, eventCh) {
+			log.Logf("%s: push not confirmed", confName)
+			hist.Reason = "push not confirmed"
+			sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: 1, Kind: KindCancelled, Message: "push not confirmed"})
+			return
+		}
+		log.Logf("%s: push confirmed", confName)
+	}
+
+	if issues := CheckSafety(cfg, op, steps); len(issues) > 0 {
+		if !confirmUnsafe(ctx, eventCh, issues) {
+			log.Logf("%s: refused by safety check: %v", confName, issues)
+			hist.Reason = "refused by safety check"
+			sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: 1, Kind: KindCancelled,
+				Message: "refused by safety check (see [safety] in the config)"})
+			return
+		}
+		log.Logf("%s: safety check overridden: %v", confName, issues)
+	}
+
+	// Preflight stops the run before step 1 when something the enabled
+	// steps need is missing; a failure offers the usual retry / continue /
+	// quit choice.
+	for {
+		var failed []string
+		checks := Preflight(ctx, cfg, op, steps, streaming, eventCh)
+		for _, c := range checks {
+			if c.Status == CheckFail {
+				failed = append(failed, c.Name)
+			}
+		}
+		if len(failed) == 0 {
+			break
+		}
+		msg := "preflight failed: " + strings.Join(failed, ", ")
+		log.Logf("%s: %s", confName, msg)
+		replyCh := make(chan ErrorAction, 1)
+		sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: 1, Kind: preflightKind(checks), Message: msg, ReplyCh: replyCh})
+		action := ActionQuit
+		select {
+		case action = <-replyCh:
+		case <-ctx.Done():
+		}
+		if action == ActionQuit {
+			hist.Reason = msg
+			return
+		}
+		if action == ActionContinue {
+			log.Logf("%s: preflight failures ignored by user", confName)
+			break
+		}
+	}
+
+	// The run state is saved after every step so that an interrupted run
+	// can be resumed, along with the dump later steps read.
+	statePath := RunStatePath(tmpDir, confName)
+	state := &RunState{Op: op, Steps: steps}
+	state.ConfigHash, _ = configHash(cfg)
+	if opts.Resume {
+		prev, err := loadRunState(statePath)
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("no interrupted run")
+		} else if err == nil {
+			err = prev.check(cfg, op, steps, true)
+		}
+		if err != nil {
+			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+				Message: fmt.Sprintf("▸ resume: not possible (%v), starting from step 1", err)})
+			log.Logf("%s: cannot resume: %v", confName, err)
+		} else {
+			state = prev
+			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+				Message: fmt.Sprintf("▸ resume: from step %d (run of %s)", state.NextStep(), state.Updated.Format("2006-01-02 15:04"))})
+			log.Logf("%s: resuming from step %d", confName, state.NextStep())
+		}
+	}
+	markDone := func(step int) {
+		state.Done = append(state.Done, step)
+		path := ""
+		if !streaming && step < 4 {
+			// Step 1 leaves the fetch, which step 2 expands into the dump
+			// and removes only once it succeeds.
+			path = fetchPath
+			if _, err := os.Stat(dumpPath); err == nil && step > 1 {
+				path = dumpPath
+			}
+		}
+		state.noteDump(path)
+		if err := state.save(statePath); err != nil {
+			log.Logf("%s: cannot save run state: %v", confName, err)
+		}
+	}
+	// The dump is read in full only once, when the run stops with steps
+	// left, rather than after every step.
+	defer func() {
+		if hist.Status == RunOK || len(state.Done) == 0 || state.DumpPath == "" {
+			return
+		}
+		state.sealDump()
+		if err := state.save(statePath); err != nil {
+			log.Logf("%s: cannot save run state: %v", confName, err)
+		}
+	}()
+
+	log.Logf("=== sitesync start: %s (op=%v, steps=%v) ===", confName, op, steps)
 	syncStart := time.Now()
 
-	for i, step := range steps {
+	for i, step := range runSteps {
 		stepNum := i + 1
 		select {
 		case <-ctx.Done():
-			sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: stepNum, Message: "cancelled"})
+			sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: stepNum, Kind: KindCancelled, Message: "cancelled"})
 			log.Logf("Step %d cancelled", stepNum)
+			hist.Reason = fmt.Sprintf("cancelled before step %d", stepNum)
 			return
 		default:
 		}
 
+		if !steps.Has(stepNum) {
+			sendEvent(ctx, eventCh, Event{Type: EvStepSkip, Step: stepNum})
+			hist.step(stepNum, step.name, StepSkipped, 0, 0)
+			continue
+		}
+
+		if slices.Contains(state.Done, stepNum) {
+			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: stepNum, Message: "  ↷ done by the previous run"})
+			sendEvent(ctx, eventCh, Event{Type: EvStepDone, Step: stepNum})
+			log.Logf("Step %d done by the previous run", stepNum)
+			hist.step(stepNum, step.name, StepResumed, 0, 0)
+			continue
+		}
+
 		sendEvent(ctx, eventCh, Event{Type: EvStepStart, Step: stepNum})
-		log.Logf("Step %d/%d: %s", stepNum, len(steps), step.name)
+		log.Logf("Step %d/%d: %s", stepNum, len(runSteps), step.name)
 
 		// Inner loop replaces goto retry: continue = retry, break = advance.
+		// The on-error policy answers failures before the user is asked.
+		rule := policy.rule(stepNum)
+		firstStart := time.Now()
+		retries := 0
 		for {
 			stepStart := time.Now()
 			err := step.fn()
@@ -144,20 +441,50 @@ func Run(ctx context.Context, cfg *config.Config, op Op, eventCh chan<- Event, l
 					Message: fmt.Sprintf("  ⏱ %s", formatDuration(elapsed))})
 				sendEvent(ctx, eventCh, Event{Type: EvStepDone, Step: stepNum})
 				log.Logf("Step %d done (%s)", stepNum, elapsed)
+				markDone(stepNum)
+				hist.step(stepNum, step.name, StepDone, time.Since(firstStart), retries)
+				if stepNum <= 2 && !streaming {
+					hist.noteDump(dumpPath, fetchPath)
+				}
 				break
 			}
 
 			log.Logf("Step %d FAILED: %v", stepNum, err)
 
-			replyCh := make(chan ErrorAction, 1)
-			sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: stepNum, Message: err.Error(), ReplyCh: replyCh})
-
 			var action ErrorAction
-			select {
-			case a := <-replyCh:
-				action = a
-			case <-ctx.Done():
-				action = ActionQuit
+			by := "user"
+			switch {
+			case retries < rule.retries && ctx.Err() == nil:
+				retries++
+				delay := rule.retryDelay(retries)
+				sendEvent(ctx, eventCh, Event{Type: EvLog, Step: stepNum, Message: "  ✘ " + err.Error()})
+				sendEvent(ctx, eventCh, Event{Type: EvLog, Step: stepNum,
+					Message: fmt.Sprintf("  ↻ retry %d/%d in %s (on-error policy)", retries, rule.retries, formatDuration(delay))})
+				log.Logf("Step %d: retry %d/%d in %s", stepNum, retries, rule.retries, delay)
+				action = ActionRetry
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					action = ActionQuit
+				}
+			case !rule.ask:
+				action, by = rule.then, "on-error policy"
+				if action == ActionQuit {
+					sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: stepNum, Kind: classify(ctx, stepNum, err), Message: err.Error()})
+				} else {
+					sendEvent(ctx, eventCh, Event{Type: EvLog, Step: stepNum, Message: "  ✘ " + err.Error()})
+				}
+			default:
+				replyCh := make(chan ErrorAction, 1)
+				sendEvent(ctx, eventCh, Event{Type: EvStepFail, Step: stepNum, Kind: classify(ctx, stepNum, err), Message: err.Error(), ReplyCh: replyCh})
+				select {
+				case action = <-replyCh:
+				case <-ctx.Done():
+					action = ActionQuit
+				}
+				if action == ActionRetry {
+					retries++
+				}
 			}
 
 			switch action {
@@ -166,12 +493,17 @@ func Run(ctx context.Context, cfg *config.Config, op Op, eventCh chan<- Event, l
 				sendEvent(ctx, eventCh, Event{Type: EvStepStart, Step: stepNum})
 				continue // retry step.fn()
 			case ActionContinue:
-				log.Logf("Step %d: skipped by user", stepNum)
+				log.Logf("Step %d: skipped by %s", stepNum, by)
 				sendEvent(ctx, eventCh, Event{Type: EvLog, Step: stepNum,
-					Message: fmt.Sprintf("  ⚠ step %d skipped", stepNum)})
+					Message: fmt.Sprintf("  ⚠ step %d skipped (%s)", stepNum, by)})
 				sendEvent(ctx, eventCh, Event{Type: EvStepDone, Step: stepNum})
+				// A resumed run must not redo what the user chose to skip.
+				markDone(stepNum)
+				hist.step(stepNum, step.name, StepContinued, time.Since(firstStart), retries)
 			default: // ActionQuit
-				log.Logf("Step %d: aborted by user", stepNum)
+				log.Logf("Step %d: aborted by %s", stepNum, by)
+				hist.step(stepNum, step.name, StepFailed, time.Since(firstStart), retries)
+				hist.Reason = fmt.Sprintf("step %d (%s): %v", stepNum, step.name, err)
 				return
 			}
 			break // advance to next step (ActionContinue lands here)
@@ -182,67 +514,187 @@ func Run(ctx context.Context, cfg *config.Config, op Op, eventCh chan<- Event, l
 	sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
 		Message: fmt.Sprintf("\n✔ completed in %s", formatDuration(totalElapsed))})
 
-	// best-effort cleanup of dump file on success.
-	if !skipSQL {
+	// best-effort cleanup of dump file on success. A run that stops before
+	// the import keeps it for a later run of step 4.
+	if steps.Has(4) {
 		_ = os.Remove(dumpPath)
+		_ = os.Remove(fetchPath)
+	} else if steps.Has(1) && !streaming {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0,
+			Message: fmt.Sprintf("  dump kept in %s", tmpDir)})
 	}
+	_ = os.Remove(statePath)
 
+	hist.Status = RunOK
 	log.Logf("=== sitesync done: %s ===", confName)
 	sendEvent(ctx, eventCh, Event{Type: EvDone})
 }
 
+// runStep is one of the seven steps of a run.
+type runStep struct {
+	name string
+	fn   func() error
+}
+
+// pushSteps returns the steps of a push in the seven usual slots. The hook
+// slots only log that hooks are not run.
+func pushSteps(ctx context.Context, cfg *config.Config, dumpPath string, eventCh chan<- Event) []runStep {
+	noHooks := func(step int) func() error {
+		return func() error {
+			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: "  hooks are not run when pushing"})
+			return nil
+		}
+	}
+	return []runStep{
+		{OpPush.StepName(1), func() error { return DumpLocalDB(ctx, cfg, dumpPath, eventCh, 1) }},
+		{OpPush.StepName(2), func() error { return ReverseReplace(ctx, cfg, dumpPath, eventCh, 2) }},
+		{OpPush.StepName(3), noHooks(3)},
+		{OpPush.StepName(4), func() error { return ImportRemote(ctx, cfg, dumpPath, eventCh, 4) }},
+		{OpPush.StepName(5), noHooks(5)},
+		{OpPush.StepName(6), func() error { return PushFiles(ctx, cfg, eventCh, 6) }},
+		{OpPush.StepName(7), noHooks(7)},
+	}
+}
+
+// useStreaming reports whether steps 1, 2 and 4 of op run as one pipeline,
+// which needs all three selected. Before hooks edit the dump file in place,
+// so their presence forces the file mode when step 3 is selected too.
+func useStreaming(cfg *config.Config, op Op, steps Steps) bool {
+	pipeline := StepsOf(1, 2, 4)
+	return op != OpPush && steps&pipeline == pipeline && cfg.Database.Stream &&
+		(!steps.Has(3) || len(hookScripts(cfg, "before")) == 0)
+}
+
+// confirmUnsafe logs the safety issues and asks the consumer whether to sync
+// anyway. Cancellation counts as a refusal.
+func confirmUnsafe(ctx context.Context, eventCh chan<- Event, issues []SafetyIssue) bool {
+	lines := make([]string, len(issues))
+	for i, issue := range issues {
+		lines[i] = "  ⚠ " + issue.String()
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: 0, Message: lines[i]})
+	}
+	replyCh := make(chan bool, 1)
+	sendEvent(ctx, eventCh, Event{Type: EvConfirm, ConfirmCh: replyCh,
+		Message: "The destination does not look like a local dev environment:\n" + strings.Join(lines, "\n")})
+	select {
+	case ok := <-replyCh:
+		return ok
+	case <-ctx.Done():
+		return false
+	}
+}
+
 // RunHeadless runs the engine synchronously without a TUI, printing events
-// to stdout. Used with --no-tui flag.
-func RunHeadless(ctx context.Context, cfg *config.Config, op Op, log logger.Logger) error {
+// to stdout. Used with --no-tui flag. A failed sync returns a *RunError.
+func RunHeadless(ctx context.Context, cfg *config.Config, op Op, opts Options, log logger.Logger) error {
 	eventCh := make(chan Event, 64)
-	go Run(ctx, cfg, op, eventCh, log)
+	go Run(ctx, cfg, op, opts, eventCh, log)
 
 	reader := bufio.NewReader(os.Stdin)
 	var lastErr string
+	var lastKind ErrorKind
+	var replaceStats []PairStats
 	for ev := range eventCh {
 		switch ev.Type {
 		case EvStepStart:
-			fmt.Printf("  ◉ [%d/7] %s ...\n", ev.Step, StepName(ev.Step))
+			fmt.Printf("  ◉ [%d/7] %s ...\n", ev.Step, op.StepName(ev.Step))
 		case EvStepDone:
-			fmt.Printf("  ✔ [%d/7] %s done\n", ev.Step, StepName(ev.Step))
+			fmt.Printf("  ✔ [%d/7] %s done\n", ev.Step, op.StepName(ev.Step))
+		case EvStepSkip:
+			fmt.Printf("  · [%d/7] %s skipped\n", ev.Step, op.StepName(ev.Step))
 		case EvStepFail:
-			fmt.Printf("  ✘ [%d/7] %s FAILED: %s\n", ev.Step, StepName(ev.Step), ev.Message)
+			fmt.Printf("  ✘ [%d/7] %s FAILED: %s\n", ev.Step, op.StepName(ev.Step), ev.Message)
 			if ev.ReplyCh != nil {
 				action := promptErrorAction(reader)
 				ev.ReplyCh <- action
 				if action == ActionQuit {
-					lastErr = ev.Message
+					lastErr, lastKind = ev.Message, ev.Kind
 				}
 			} else {
-				lastErr = ev.Message
+				lastErr, lastKind = ev.Message, ev.Kind
 			}
 		case EvProgress:
-			fmt.Printf("\r       %3.0f%%", ev.Progress*100)
+			if ev.Message != "" {
+				fmt.Printf("\r       %s", ev.Message)
+			} else {
+				fmt.Printf("\r       %3.0f%%", ev.Progress*100)
+			}
 		case EvAuthRequest:
 			if ev.AuthReplyCh != nil {
 				reply, err := promptHiddenPassword(ev.Message)
 				if err != nil {
-					lastErr = err.Error()
+					lastErr, lastKind = err.Error(), KindCancelled
 					ev.AuthReplyCh <- AuthReply{Cancel: true}
 					break
 				}
 				ev.AuthReplyCh <- reply
 				if reply.Cancel {
-					lastErr = ev.Message
+					lastErr, lastKind = ev.Message, KindCancelled
 				}
 			}
+		case EvCheck:
+			PrintChecks(os.Stdout, []Check{ev.Check})
+		case EvConfirm:
+			fmt.Printf("\n  %s\n", strings.ReplaceAll(ev.Message, "\n", "\n  "))
+			if ev.Expect != "" {
+				ev.ConfirmCh <- promptExpect(reader, ev.Expect)
+				break
+			}
+			ev.ConfirmCh <- promptConfirm(reader, `Type "yes" to sync anyway, anything else aborts: `)
 		case EvLog:
 			fmt.Println("    " + ev.Message)
+		case EvReplaceStats:
+			replaceStats = ev.Stats
 		case EvDone:
 			fmt.Println("\n  ✔ sync complete")
 		}
 	}
+	printReplaceSummary(replaceStats)
 	if lastErr != "" {
-		return fmt.Errorf("sync failed: %s", lastErr)
+		return &RunError{Kind: lastKind, Err: fmt.Errorf("sync failed: %s", lastErr)}
 	}
 	return nil
 }
 
+// reportReplaceStats logs how many occurrences each pair replaced, warns
+// about pairs that matched nothing, and emits an EvReplaceStats event.
+func reportReplaceStats(ctx context.Context, eventCh chan<- Event, step int, pairs []config.ReplacePair, replacer *MultiReplacer) {
+	stats := replacer.Stats()
+	ps := make([]PairStats, len(pairs))
+	for i, pair := range pairs {
+		st := stats[i]
+		ps[i] = PairStats{Search: pair.Search, Replace: pair.Replace, ReplaceStats: st}
+		msg := fmt.Sprintf("  [%d/%d] %d plain + %d serialized match(es) on %d line(s)",
+			i+1, len(pairs), st.Plain, st.Serialized, st.Lines)
+		if st.Matches() == 0 {
+			msg = fmt.Sprintf("  ⚠ [%d/%d] %q matched nothing — check the pair for typos", i+1, len(pairs), pair.Search)
+		}
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: msg})
+	}
+	sendEvent(ctx, eventCh, Event{Type: EvReplaceStats, Step: step, Stats: ps})
+}
+
+// printReplaceSummary prints the per-pair match counts as a table.
+func printReplaceSummary(stats []PairStats) {
+	if len(stats) == 0 {
+		return
+	}
+	const maxSearch = 40
+	fmt.Println("\n  Find / Replace summary")
+	fmt.Printf("    %3s  %-*s  %10s  %10s  %8s\n", "#", maxSearch, "Search", "Plain", "Serialized", "Lines")
+	for i, ps := range stats {
+		search := ps.Search
+		if len(search) > maxSearch {
+			search = search[:maxSearch-1] + "…"
+		}
+		mark := ""
+		if ps.Matches() == 0 {
+			mark = "  ⚠ no match"
+		}
+		fmt.Printf("    %3d  %-*s  %10d  %10d  %8d%s\n", i+1, maxSearch, search, ps.Plain, ps.Serialized, ps.Lines, mark)
+	}
+}
+
 func promptHiddenPassword(prompt string) (AuthReply, error) {
 	fd := os.Stdin.Fd()
 	if !term.IsTerminal(fd) {
@@ -278,6 +730,21 @@ func promptErrorAction(reader *bufio.Reader) ErrorAction {
 	}
 }
 
+// promptConfirm asks a yes/no question in headless mode. Only an explicit
+// "yes" confirms; an empty answer or a closed stdin refuses.
+func promptConfirm(reader *bufio.Reader, prompt string) bool {
+	fmt.Print("\n  " + prompt)
+	input, _ := reader.ReadString('\n')
+	return strings.EqualFold(strings.TrimSpace(input), "yes")
+}
+
+// promptExpect asks the user to type want and reports whether they did.
+func promptExpect(reader *bufio.Reader, want string) bool {
+	fmt.Printf("\n  Type %q to go ahead, anything else aborts: ", want)
+	input, _ := reader.ReadString('\n')
+	return strings.TrimSpace(input) == want
+}
+
 // formatDuration returns a human-readable duration string.
 func formatDuration(d time.Duration) string {
 	switch {
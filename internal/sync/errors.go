@@ -0,0 +1,150 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorKind classifies why a sync failed. Each kind exits the process with
+// its own code, so that wrapper scripts can tell failures apart.
+type ErrorKind uint8
+
+const (
+	KindOther      ErrorKind = iota // exit 1
+	KindConfig                      // exit 2: invalid or missing config, disallowed op
+	KindConnection                  // exit 3: SSH or MySQL server unreachable
+	KindAuth                        // exit 4: SSH or MySQL credentials refused
+	KindDump                        // exit 5: step 1
+	KindReplace                     // exit 6: step 2
+	KindHook                        // exit 7: steps 3, 5 and 7
+	KindImport                      // exit 8: step 4
+	KindTransfer                    // exit 9: step 6
+	KindLocked                      // exit 10: another run of the site holds its lock
+	KindCancelled                   // exit 130: aborted or refused by the user
+)
+
+var kindNames = [...]string{"other", "config", "connection", "auth", "dump", "replace", "hook", "import", "transfer", "locked", "cancelled"}
+
+func (k ErrorKind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("ErrorKind(%d)", k)
+}
+
+// MarshalText encodes the kind by name, e.g. "auth".
+func (k ErrorKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ExitCode returns the process exit code for a failure of this kind.
+func (k ErrorKind) ExitCode() int {
+	switch k {
+	case KindOther:
+		return 1
+	case KindCancelled:
+		return 130
+	default:
+		return int(k) + 1
+	}
+}
+
+// RunError is the error RunHeadless and RunJSON return when a sync fails.
+type RunError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *RunError) Error() string { return e.Err.Error() }
+func (e *RunError) Unwrap() error { return e.Err }
+
+// ExitCode returns the process exit code for err: 0 when it is nil, the
+// code of its kind when it is a *RunError and 1 otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var re *RunError
+	if errors.As(err, &re) {
+		return re.Kind.ExitCode()
+	}
+	return 1
+}
+
+// Markers of SSH, rsync, lftp and mysql output that tell a refused login
+// or an unreachable server from a failure of the step itself.
+var (
+	authMarkers = []string{
+		"Permission denied (", "Access denied for user", "Authentication failed",
+		"Login incorrect", "Too many authentication failures",
+	}
+	connectionMarkers = []string{
+		"Could not resolve hostname", "Connection refused", "Connection timed out",
+		"No route to host", "Network is unreachable", "Connection closed by",
+		"Connection reset by peer", "Can't connect to MySQL server",
+		"Unknown MySQL server host", "Lost connection to MySQL server",
+		"Host key verification failed",
+	}
+)
+
+// kindOfMessage returns KindAuth or KindConnection when msg shows one,
+// and KindOther otherwise.
+func kindOfMessage(msg string) ErrorKind {
+	for _, m := range authMarkers {
+		if strings.Contains(msg, m) {
+			return KindAuth
+		}
+	}
+	for _, m := range connectionMarkers {
+		if strings.Contains(msg, m) {
+			return KindConnection
+		}
+	}
+	return KindOther
+}
+
+// classify returns the kind of a failure of step: cancelled when the run
+// was, auth or connection when the output shows one, and otherwise the
+// kind of the step.
+func classify(ctx context.Context, step int, err error) ErrorKind {
+	if ctx.Err() != nil || errors.Is(err, errSSHPasswordCancelled) {
+		return KindCancelled
+	}
+	if k := kindOfMessage(err.Error()); k != KindOther {
+		return k
+	}
+	switch step {
+	case 1:
+		return KindDump
+	case 2:
+		return KindReplace
+	case 4:
+		return KindImport
+	case 6:
+		return KindTransfer
+	default:
+		return KindHook
+	}
+}
+
+// preflightKind returns the kind of a failed preflight. A failed SSH or
+// database check is a connection or auth problem; anything else missing,
+// such as a binary or the dump of an earlier run, is one of the config.
+func preflightKind(checks []Check) ErrorKind {
+	kind := KindConfig
+	for _, c := range checks {
+		if c.Status != CheckFail {
+			continue
+		}
+		if !strings.HasPrefix(c.Name, "ssh ") && c.Name != "local database" {
+			continue
+		}
+		if k := kindOfMessage(c.Detail); k == KindAuth {
+			return KindAuth
+		}
+		kind = KindConnection
+	}
+	return kind
+}
@@ -0,0 +1,124 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+	"github.com/carlosrgl/sitesync/internal/logger"
+)
+
+func TestClassify(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		step int
+		err  string
+		want ErrorKind
+	}{
+		{1, "mysqldump: Got error: 1045: Access denied for user 'shop'@'localhost'", KindAuth},
+		{1, "exit status 255\nlast output:\ndeploy@example.com: Permission denied (publickey,password).", KindAuth},
+		{6, "ssh: Could not resolve hostname example.invalid: Name or service not known", KindConnection},
+		{4, "ERROR 2002 (HY000): Can't connect to MySQL server on 'db' (115)", KindConnection},
+		{1, "copy /srv/shop.sql: no such file or directory", KindDump},
+		{2, "invalid regex", KindReplace},
+		{5, "hook flush.sh failed: exit status 1", KindHook},
+		{4, "ERROR 1064 (42000) at line 12: You have an error in your SQL syntax", KindImport},
+		{6, "rsync: exit status 23", KindTransfer},
+	}
+	for _, tt := range tests {
+		if got := classify(ctx, tt.step, errors.New(tt.err)); got != tt.want {
+			t.Errorf("classify(%d, %q) = %v, want %v", tt.step, tt.err, got, tt.want)
+		}
+	}
+	if got := classify(ctx, 1, fmt.Errorf("fetch: %w", errSSHPasswordCancelled)); got != KindCancelled {
+		t.Errorf("cancelled password prompt = %v, want cancelled", got)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if got := classify(cancelled, 4, errors.New("signal: killed")); got != KindCancelled {
+		t.Errorf("cancelled run = %v, want cancelled", got)
+	}
+
+	checks := []Check{{Name: "mysqldump", Status: CheckFail}, {Name: "ssh deploy@example.com", Status: CheckPass}}
+	if got := preflightKind(checks); got != KindConfig {
+		t.Errorf("preflightKind(missing binary) = %v, want config", got)
+	}
+	checks[1] = Check{Name: "ssh deploy@example.com", Status: CheckFail, Detail: "Connection timed out"}
+	if got := preflightKind(checks); got != KindConnection {
+		t.Errorf("preflightKind(ssh timeout) = %v, want connection", got)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{errors.New("unknown flag"), 1},
+		{&RunError{Kind: KindConfig, Err: errors.New("no config")}, 2},
+		{fmt.Errorf("wrapped: %w", &RunError{Kind: KindAuth, Err: errors.New("denied")}), 4},
+		{&RunError{Kind: KindTransfer, Err: errors.New("rsync")}, 9},
+		{&RunError{Kind: KindLocked, Err: errors.New("locked")}, 10},
+		{&RunError{Kind: KindCancelled, Err: errors.New("refused")}, 130},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRunEarlyFailureKinds(t *testing.T) {
+	etc := t.TempDir()
+	t.Setenv("SITESYNC_ETC", etc)
+	if err := os.MkdirAll(filepath.Join(etc, "shop"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(etc, "shop", "config.toml"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failKind := func() ErrorKind {
+		eventCh := make(chan Event, 64)
+		go Run(context.Background(), cfg, OpFiles, Options{}, eventCh, logger.Discard())
+		kind := KindOther
+		for ev := range eventCh {
+			if ev.Type == EvStepFail {
+				kind = ev.Kind
+			}
+		}
+		return kind
+	}
+
+	// A site being synced by another run.
+	if err := os.MkdirAll(config.TmpDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := AcquireLock(config.TmpDir(), "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := failKind(); got != KindLocked {
+		t.Errorf("kind of a locked site = %v, want locked", got)
+	}
+	unlock()
+
+	// A tmp dir that cannot be created.
+	if err := os.RemoveAll(config.TmpDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config.TmpDir(), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := failKind(); got != KindConfig {
+		t.Errorf("kind of an unusable tmp dir = %v, want config", got)
+	}
+}
@@ -1,6 +1,11 @@
 package sync
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // EventType identifies what kind of engine event was emitted.
 type EventType uint8
@@ -15,18 +20,54 @@ const (
 	EvStepFail
 	// EvLog is a single line of output from a subprocess.
 	EvLog
-	// EvProgress is a progress update (Progress field is 0.0–1.0).
+	// EvProgress is a progress update (Progress field is 0.0–1.0). When the
+	// total is unknown (streaming), Progress is 0 and Message holds the
+	// amount of data received so far.
 	EvProgress
 	// EvAuthRequest asks the consumer to collect a password and reply.
 	EvAuthRequest
 	// EvDone signals that the entire sync run has finished.
 	EvDone
+	// EvReplaceStats reports per-pair match counts once find/replace has
+	// run over the whole dump; Stats holds one entry per configured pair.
+	EvReplaceStats
+	// EvConfirm asks the consumer to confirm a risky operation before the
+	// engine goes on; Message explains the risk. The engine blocks on
+	// ConfirmCh.
+	EvConfirm
+	// EvCheck reports one preflight check result in Check.
+	EvCheck
+	// EvStepSkip signals that a step is not part of the selected steps and
+	// does not run.
+	EvStepSkip
 )
 
+// eventNames name the event types in the JSON output.
+var eventNames = [...]string{
+	EvStepStart:    "step_start",
+	EvStepDone:     "step_done",
+	EvStepFail:     "step_fail",
+	EvLog:          "log",
+	EvProgress:     "progress",
+	EvAuthRequest:  "auth_request",
+	EvDone:         "done",
+	EvReplaceStats: "replace_stats",
+	EvConfirm:      "confirm",
+	EvCheck:        "check",
+	EvStepSkip:     "step_skip",
+}
+
+func (t EventType) String() string {
+	if int(t) < len(eventNames) {
+		return eventNames[t]
+	}
+	return fmt.Sprintf("event_%d", t)
+}
+
 // AuthReply carries the result of an interactive password prompt.
 type AuthReply struct {
-	Password string
-	Cancel   bool
+	Password string `json:"password,omitempty"`
+	Cancel   bool   `json:"cancel,omitempty"`
 }
 
 // ErrorAction tells the engine what to do after a step failure.
@@ -38,6 +79,27 @@ const (
 	ActionQuit                        // Abort the entire sync
 )
 
+var actionNames = [...]string{ActionRetry: "retry", ActionContinue: "continue", ActionQuit: "quit"}
+
+// MarshalText encodes a by its name, such as "retry".
+func (a ErrorAction) MarshalText() ([]byte, error) {
+	if int(a) >= len(actionNames) {
+		return nil, fmt.Errorf("unknown error action %d", a)
+	}
+	return []byte(actionNames[a]), nil
+}
+
+// UnmarshalText decodes an action encoded by MarshalText.
+func (a *ErrorAction) UnmarshalText(text []byte) error {
+	for i, name := range actionNames {
+		if string(text) == name {
+			*a = ErrorAction(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown error action %q (want retry, continue or quit)", text)
+}
+
 // Event is the message type passed from the sync engine to the TUI.
 type Event struct {
 	Type     EventType
@@ -45,6 +107,9 @@ type Event struct {
 	Message  string  // log text for EvLog; error text for EvStepFail
 	Progress float64 // 0.0–1.0 for EvProgress
 
+	// Kind classifies the failure of an EvStepFail.
+	Kind ErrorKind
+
 	// ReplyCh is set on EvStepFail events. The consumer must send exactly
 	// one ErrorAction to tell the engine how to proceed.
 	ReplyCh chan<- ErrorAction
@@ -52,6 +117,28 @@ type Event struct {
 	// AuthReplyCh is set on EvAuthRequest events. The consumer must send
 	// exactly one AuthReply containing either a password or a cancel signal.
 	AuthReplyCh chan<- AuthReply
+
+	// ConfirmCh is set on EvConfirm events. The consumer must send exactly
+	// one bool: true to go ahead anyway, false to abort.
+	ConfirmCh chan<- bool
+
+	// Expect is set on EvConfirm events that need the user to type a text,
+	// such as the remote database name before a push, rather than answer
+	// yes or no. The consumer sends true only for an exact match.
+	Expect string
+
+	// Stats is set on EvReplaceStats events.
+	Stats []PairStats
+
+	// Check is set on EvCheck events.
+	Check Check
+}
+
+// PairStats is the outcome of one configured find/replace pair.
+type PairStats struct {
+	Search  string `json:"search"`
+	Replace string `json:"replace"`
+	ReplaceStats
 }
 
 // Op describes which parts of the sync to run.
@@ -61,8 +148,156 @@ const (
 	OpAll   Op = iota // SQL + files
 	OpSQL             // database only
 	OpFiles           // files only
+	OpPush            // local database and files → remote
 )
 
+func (op Op) String() string {
+	switch op {
+	case OpSQL:
+		return "SQL only"
+	case OpFiles:
+		return "files only"
+	case OpPush:
+		return "push to remote"
+	default:
+		return "SQL + files"
+	}
+}
+
+// Steps is a set of steps, bit n-1 standing for step n.
+type Steps uint8
+
+// AllSteps holds the seven steps.
+const AllSteps Steps = 1<<7 - 1
+
+// StepsOf returns the set of the given steps; numbers outside 1–7 are
+// ignored.
+func StepsOf(steps ...int) Steps {
+	var s Steps
+	for _, step := range steps {
+		if step >= 1 && step <= 7 {
+			s |= 1 << (step - 1)
+		}
+	}
+	return s
+}
+
+// ParseSteps parses a comma-separated list of steps and ranges, such as
+// "2,4" or "1-3,6".
+func ParseSteps(str string) (Steps, error) {
+	var s Steps
+	for _, part := range strings.Split(str, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(lo))
+		last := first
+		if err == nil && isRange {
+			last, err = strconv.Atoi(strings.TrimSpace(hi))
+		}
+		if err != nil || first < 1 || last > 7 || first > last {
+			return 0, fmt.Errorf("invalid step %q: steps are numbered 1 to 7", part)
+		}
+		for step := first; step <= last; step++ {
+			s |= StepsOf(step)
+		}
+	}
+	if s == 0 {
+		return 0, fmt.Errorf("no step in %q", str)
+	}
+	return s, nil
+}
+
+// Has reports whether step is in s.
+func (s Steps) Has(step int) bool {
+	return s&StepsOf(step) != 0
+}
+
+// SQL reports whether s holds any of the database steps 1 to 5.
+func (s Steps) SQL() bool {
+	return s&StepsOf(1, 2, 3, 4, 5) != 0
+}
+
+// Files reports whether s holds step 6 or 7.
+func (s Steps) Files() bool {
+	return s&StepsOf(6, 7) != 0
+}
+
+// String lists the steps of s, such as "2,4".
+func (s Steps) String() string {
+	var nums []string
+	for step := 1; step <= 7; step++ {
+		if s.Has(step) {
+			nums = append(nums, strconv.Itoa(step))
+		}
+	}
+	return strings.Join(nums, ",")
+}
+
+// opNames are the names of the ops on the command line and in JSON.
+var opNames = [...]string{OpAll: "all", OpSQL: "sql", OpFiles: "files", OpPush: "push"}
+
+// MarshalText encodes op by its command-line name, such as "sql".
+func (op Op) MarshalText() ([]byte, error) {
+	if int(op) >= len(opNames) {
+		return nil, fmt.Errorf("unknown op %d", op)
+	}
+	return []byte(opNames[op]), nil
+}
+
+// UnmarshalText decodes an op encoded by MarshalText.
+func (op *Op) UnmarshalText(text []byte) error {
+	for i, name := range opNames {
+		if string(text) == name {
+			*op = Op(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown op %q", text)
+}
+
+// MarshalText encodes s as a list such as "2,4".
+func (s Steps) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a list of steps; an empty one is the empty set.
+func (s *Steps) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*s = 0
+		return nil
+	}
+	steps, err := ParseSteps(string(text))
+	if err != nil {
+		return err
+	}
+	*s = steps
+	return nil
+}
+
+// Steps returns the steps op runs when none are deselected.
+func (op Op) Steps() Steps {
+	switch op {
+	case OpSQL:
+		return StepsOf(1, 2, 3, 4, 5)
+	case OpFiles:
+		return StepsOf(6, 7)
+	default:
+		return AllSteps
+	}
+}
+
+// Select returns the steps of op that are also in steps; zero selects all
+// of them.
+func (op Op) Select(steps Steps) Steps {
+	if steps == 0 {
+		return op.Steps()
+	}
+	return op.Steps() & steps
+}
+
 // StepName returns a human-readable name for each step (1-indexed).
 func StepName(step int) string {
 	names := [...]string{
@@ -81,6 +316,25 @@ func StepName(step int) string {
 	return names[step]
 }
 
+// StepName returns the name of step for op: the push steps run in the
+// same seven slots but do different work.
+func (op Op) StepName(step int) string {
+	if op != OpPush {
+		return StepName(step)
+	}
+	switch step {
+	case 1:
+		return "Dump local DB"
+	case 2:
+		return "Reverse replace"
+	case 4:
+		return "Import remote SQL"
+	case 6:
+		return "Push files"
+	}
+	return StepName(step)
+}
+
 // sendEvent sends ev to ch, returning true on success.
 // It selects on ctx.Done() to avoid blocking forever when the consumer
 // has stopped draining the channel (e.g. the user quit the TUI mid-sync).
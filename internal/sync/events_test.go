@@ -0,0 +1,37 @@
+package sync
+
+import "testing"
+
+func TestParseSteps(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Steps
+		err  bool
+	}{
+		{in: "2,4", want: StepsOf(2, 4)},
+		{in: "1-3, 6", want: StepsOf(1, 2, 3, 6)},
+		{in: "7", want: StepsOf(7)},
+		{in: "0", err: true},
+		{in: "3-1", err: true},
+		{in: "2,x", err: true},
+		{in: "", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSteps(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseSteps(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSteps(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if got := OpSQL.Select(StepsOf(2, 4, 6)); got != StepsOf(2, 4) {
+		t.Errorf("OpSQL.Select(2,4,6) = %v, want 2,4", got)
+	}
+	if got := OpFiles.Select(0); got.String() != "6,7" {
+		t.Errorf("OpFiles.Select(0) = %v, want 6,7", got)
+	}
+}
@@ -25,11 +25,26 @@ func SyncFiles(ctx context.Context, cfg *config.Config, eventCh chan<- Event, st
 	case "lftp":
 		return syncLFTP(ctx, cfg, eventCh, step)
 	default:
-		return syncRsync(ctx, cfg, eventCh, step)
+		return syncRsync(ctx, cfg, eventCh, step, false)
 	}
 }
 
-func syncRsync(ctx context.Context, cfg *config.Config, eventCh chan<- Event, step int) error {
+// PushFiles implements step 6 of a push: rsync each [[sync]] pair from dst
+// back to src on the server.
+func PushFiles(ctx context.Context, cfg *config.Config, eventCh chan<- Event, step int) error {
+	if len(cfg.Sync) == 0 {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: "No sync pairs configured, skipping file push"})
+		return nil
+	}
+	if cfg.Transport.Type == "lftp" {
+		return fmt.Errorf("push needs the rsync transport")
+	}
+	return syncRsync(ctx, cfg, eventCh, step, true)
+}
+
+// syncRsync copies every [[sync]] pair from the server, or to it when push
+// is set.
+func syncRsync(ctx context.Context, cfg *config.Config, eventCh chan<- Event, step int, push bool) error {
 	rsyncBin := cfg.Destination.PathToRsync
 	if rsyncBin == "" {
 		rsyncBin = "rsync"
@@ -43,16 +58,23 @@ func syncRsync(ctx context.Context, cfg *config.Config, eventCh chan<- Event, st
 		runErr := runSSHCommandWithPasswordPrompt(ctx, eventCh, step, target, func(msg string) {
 			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: msg})
 		}, func(extraEnv []string, batchMode bool) error {
-			currentArgs, err := buildRsyncArgs(cfg, pair, batchMode)
+			currentArgs, err := buildRsyncArgs(cfg, pair, batchMode, push)
 			if err != nil {
 				return err
 			}
+			bin, args, err := niceCommand(cfg.Destination.LocalNice, rsyncBin, currentArgs)
+			if err != nil {
+				return fmt.Errorf("parse local_nice: %w", err)
+			}
 			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step,
-				Message: fmt.Sprintf("  $ %s %s", rsyncBin, strings.Join(currentArgs, " "))})
+				Message: fmt.Sprintf("  $ %s %s", bin, strings.Join(args, " "))})
 
-			cmd := exec.CommandContext(ctx, rsyncBin, currentArgs...)
+			cmd := exec.CommandContext(ctx, bin, args...)
 			cmd.Env = commandEnv(extraEnv)
 			if err := streamCmdWithProgress(ctx, eventCh, step, cmd, baseProgress, sliceSize); err != nil {
+				if push {
+					return fmt.Errorf("rsync %s → %s: %w", pair.Dst, pair.Src, err)
+				}
 				return fmt.Errorf("rsync %s → %s: %w", pair.Src, pair.Dst, err)
 			}
 			return nil
@@ -64,7 +86,9 @@ func syncRsync(ctx context.Context, cfg *config.Config, eventCh chan<- Event, st
 	return nil
 }
 
-func buildRsyncArgs(cfg *config.Config, pair config.SyncPair, batchMode bool) ([]string, error) {
+// buildRsyncArgs returns the rsync arguments copying pair.Src on the server
+// into pair.Dst, or pair.Dst into pair.Src when push is set.
+func buildRsyncArgs(cfg *config.Config, pair config.SyncPair, batchMode, push bool) ([]string, error) {
 	t := cfg.Transport
 	src := cfg.Source
 
@@ -81,8 +105,9 @@ func buildRsyncArgs(cfg *config.Config, pair config.SyncPair, batchMode bool) ([
 	sshOpt := rsyncSSHCommand(src.Port, batchMode)
 	args = append(args, "-e", sshOpt)
 
-	// Progress reporting.
-	args = append(args, "--info=progress2")
+	// Progress reporting, and the "sent N bytes  received M bytes" totals
+	// the history records, which rsync prints without -v only with stats1.
+	args = append(args, "--info=progress2,stats1")
 
 	// Exclusions.
 	for _, ex := range t.Exclude {
@@ -96,6 +121,9 @@ func buildRsyncArgs(cfg *config.Config, pair config.SyncPair, batchMode bool) ([
 
 	// source: user@host:path
 	remoteSrc := fmt.Sprintf("%s@%s:%s", src.User, src.Server, srcPath)
+	if push {
+		return append(args, dstPath, remoteSrc), nil
+	}
 	args = append(args, remoteSrc, dstPath)
 
 	return args, nil
@@ -252,6 +280,7 @@ func streamCmdWithProgress(ctx context.Context, eventCh chan<- Event, step int,
 					continue // don't log raw progress lines
 				}
 			}
+			countTransfer(ctx, trimmed)
 			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: trimmed})
 		}
 	}
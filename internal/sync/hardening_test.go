@@ -162,3 +162,108 @@ func TestStreamCmdReturnsTrailingOutputOnFailure(t *testing.T) {
 		t.Fatalf("expected stderr lines in error, got: %s", msg)
 	}
 }
+
+func TestBuildRemoteDumpCommandCompress(t *testing.T) {
+	cfg := &config.Config{
+		Source: config.SourceConfig{
+			Type:       "remote_base",
+			Compress:   true,
+			DBHostname: "localhost",
+			DBName:     "prod",
+			DBPassword: "secret",
+		},
+	}
+
+	remoteCmd, logCmd, err := buildRemoteDumpCommand(cfg)
+	if err != nil {
+		t.Fatalf("buildRemoteDumpCommand returned error: %v", err)
+	}
+	if !strings.HasSuffix(remoteCmd, " | 'gzip' '-c'") {
+		t.Fatalf("compressed remote command not piped through gzip: %s", remoteCmd)
+	}
+	if !strings.Contains(remoteCmd, "set -o pipefail") {
+		t.Fatalf("compressed remote command does not set pipefail: %s", remoteCmd)
+	}
+	if strings.Contains(logCmd, "secret") {
+		t.Fatalf("log command leaked password: %s", logCmd)
+	}
+	if got := FetchFilePath(cfg, "/tmp/site.sql"); got != "/tmp/site.sql.gz" {
+		t.Fatalf("FetchFilePath = %q, want /tmp/site.sql.gz", got)
+	}
+
+	cfg.Source.Compress = false
+	remoteCmd, _, err = buildRemoteDumpCommand(cfg)
+	if err != nil {
+		t.Fatalf("buildRemoteDumpCommand returned error: %v", err)
+	}
+	if strings.Contains(remoteCmd, "gzip") {
+		t.Fatalf("uncompressed remote command mentions gzip: %s", remoteCmd)
+	}
+	if got := FetchFilePath(cfg, "/tmp/site.sql"); got != "/tmp/site.sql" {
+		t.Fatalf("FetchFilePath = %q, want /tmp/site.sql", got)
+	}
+
+	// compress covers a local_base dump file too.
+	cfg.Source.Type, cfg.Source.Compress = "local_base", true
+	if got := FetchFilePath(cfg, "/tmp/site.sql"); got != "/tmp/site.sql.gz" {
+		t.Fatalf("local_base FetchFilePath = %q, want /tmp/site.sql.gz", got)
+	}
+}
+
+func TestNiceCommandWrapsLocalAndRemoteCommands(t *testing.T) {
+	bin, args, err := niceCommand(`ionice -c3 nice -n 19`, "mysql", []string{"-h", "localhost"})
+	if err != nil {
+		t.Fatalf("niceCommand returned error: %v", err)
+	}
+	if bin != "ionice" {
+		t.Fatalf("bin = %q, want ionice", bin)
+	}
+	want := []string{"-c3", "nice", "-n", "19", "mysql", "-h", "localhost"}
+	if strings.Join(args, " ") != strings.Join(want, " ") {
+		t.Fatalf("args = %#v, want %#v", args, want)
+	}
+
+	bin, args, err = niceCommand("", "mysql", []string{"db"})
+	if err != nil || bin != "mysql" || len(args) != 1 {
+		t.Fatalf("empty wrapper changed command: %q %#v %v", bin, args, err)
+	}
+
+	cfg := &config.Config{
+		Source: config.SourceConfig{
+			Type:       "remote_base",
+			DBHostname: "localhost",
+			DBName:     "prod",
+			RemoteNice: "nice -n 19",
+		},
+	}
+	remoteCmd, logCmd, err := buildRemoteDumpCommand(cfg)
+	if err != nil {
+		t.Fatalf("buildRemoteDumpCommand returned error: %v", err)
+	}
+	if !strings.HasPrefix(remoteCmd, "'nice' '-n' '19' 'mysqldump'") {
+		t.Fatalf("remote command not wrapped with remote_nice: %s", remoteCmd)
+	}
+	if !strings.HasPrefix(logCmd, "nice -n 19 mysqldump") {
+		t.Fatalf("log command not wrapped with remote_nice: %s", logCmd)
+	}
+}
+
+func TestStreamCmdKeepsLastOutputOnFailure(t *testing.T) {
+	eventCh := make(chan Event, 16)
+	go func() {
+		for range eventCh {
+		}
+	}()
+	defer close(eventCh)
+
+	for i := 0; i < 20; i++ {
+		cmd := exec.Command("sh", "-c", `for i in $(seq 1 500); do echo "line $i" >&2; done; exit 3`)
+		err := streamCmd(context.Background(), eventCh, 1, cmd, true)
+		if err == nil {
+			t.Fatal("streamCmd succeeded, want exit status 3")
+		}
+		if !strings.HasSuffix(err.Error(), "line 500") {
+			t.Fatalf("error does not end with the last line of output:\n%v", err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// RunStatus is the outcome of a run.
+type RunStatus string
+
+const (
+	RunOK        RunStatus = "ok"
+	RunFailed    RunStatus = "failed"
+	RunCancelled RunStatus = "cancelled"
+)
+
+// StepStatus is what became of one step in a run.
+type StepStatus string
+
+const (
+	StepDone      StepStatus = "done"
+	StepFailed    StepStatus = "failed"
+	StepContinued StepStatus = "continued" // failed, then skipped by the user or the on-error policy
+	StepSkipped   StepStatus = "skipped"   // not selected
+	StepResumed   StepStatus = "resumed"   // done by the interrupted run
+)
+
+// StepRecord is one step of a RunRecord.
+type StepRecord struct {
+	Step    int        `json:"step"`
+	Name    string     `json:"name"`
+	Status  StepStatus `json:"status"`
+	Seconds float64    `json:"seconds"`
+	Retries int        `json:"retries,omitempty"`
+}
+
+// RunRecord is one entry of a site's run history.
+type RunRecord struct {
+	Site        string       `json:"site"`
+	Op          Op           `json:"op"`
+	Steps       Steps        `json:"steps"`
+	Start       time.Time    `json:"start"`
+	End         time.Time    `json:"end"`
+	Status      RunStatus    `json:"status"`
+	Reason      string       `json:"reason,omitempty"` // why the run stopped, unless it succeeded
+	StepLog     []StepRecord `json:"step_log,omitempty"`
+	DumpBytes   int64        `json:"dump_bytes,omitempty"`
+	Transferred *int64       `json:"transferred_bytes,omitempty"` // sent and received by rsync, if known
+	OnError     string       `json:"on_error,omitempty"`          // the error policy in effect
+	User        string       `json:"user"`
+	Host        string       `json:"host"`
+}
+
+// Duration returns how long the run took.
+func (r *RunRecord) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+func newRunRecord(site string, op Op, steps Steps) *RunRecord {
+	me := currentLockInfo()
+	return &RunRecord{Site: site, Op: op, Steps: steps, Start: time.Now(), Status: RunFailed, User: me.User, Host: me.Host}
+}
+
+func (r *RunRecord) step(step int, name string, status StepStatus, took time.Duration, retries int) {
+	r.StepLog = append(r.StepLog, StepRecord{Step: step, Name: name, Status: status, Seconds: took.Seconds(), Retries: retries})
+}
+
+// noteDump records the size of the dump file, if there is one.
+func (r *RunRecord) noteDump(paths ...string) {
+	for _, p := range paths {
+		if fi, err := os.Stat(p); err == nil {
+			r.DumpBytes = fi.Size()
+			return
+		}
+	}
+}
+
+// The history of a site is trimmed to its last historyKeep records once the
+// file grows past historyMaxBytes, so it does not grow forever.
+var (
+	historyKeep     = 500
+	historyMaxBytes = int64(1 << 20)
+)
+
+// AppendHistory adds rec to the history of its site.
+func AppendHistory(rec *RunRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	path := config.HistoryFile(rec.Site)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Another process may append at the same time, such as a run refused
+	// by the lock, and must not do so while the file is being trimmed.
+	unlock, err := lockDir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, werr := f.Write(append(data, '\n'))
+	if cerr := f.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr != nil {
+		return werr
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Size() > historyMaxBytes {
+		return trimHistory(path, historyKeep)
+	}
+	return nil
+}
+
+// trimHistory rewrites the history file at path with its last keep lines.
+func trimHistory(path string, keep int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if n := len(lines); n > 0 && len(lines[n-1]) == 0 {
+		lines = lines[:n-1]
+	}
+	if len(lines) <= keep {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bytes.Join(lines[len(lines)-keep:], nil), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadHistory returns the run history of the named config, oldest first.
+// Lines that cannot be parsed, such as one cut short by a crash, are
+// skipped.
+func ReadHistory(name string) ([]RunRecord, error) {
+	f, err := os.Open(config.HistoryFile(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var recs []RunRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var rec RunRecord
+		if json.Unmarshal(sc.Bytes(), &rec) == nil {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, sc.Err()
+}
+
+// LastRun returns the most recent record of the named config, or nil. It
+// reads the history from the end, as the picker asks it of every site.
+func LastRun(name string) *RunRecord {
+	f, err := os.Open(config.HistoryFile(name))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	for chunk := int64(16 << 10); ; chunk *= 4 {
+		start := max(fi.Size()-chunk, 0)
+		buf := make([]byte, fi.Size()-start)
+		if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+			return nil
+		}
+		lines := bytes.Split(buf, []byte("\n"))
+		if start > 0 {
+			lines = lines[1:] // may be the end of a line
+		}
+		for i := len(lines) - 1; i >= 0; i-- {
+			var rec RunRecord
+			if json.Unmarshal(lines[i], &rec) == nil {
+				return &rec
+			}
+		}
+		if start == 0 {
+			return nil
+		}
+	}
+}
+
+// PrintHistory writes the records of a site as a table, most recent first.
+func PrintHistory(w io.Writer, name string, recs []RunRecord) {
+	fmt.Fprintf(w, "  %s\n", name)
+	if len(recs) == 0 {
+		fmt.Fprintln(w, "    (no runs)")
+		return
+	}
+	fmt.Fprintf(w, "    %-19s  %-14s  %-13s  %8s  %-9s  %10s  %10s  %s\n",
+		"Started", "Op", "Steps", "Took", "Status", "Dump", "Transfer", "By")
+	for i := len(recs) - 1; i >= 0; i-- {
+		r := recs[i]
+		steps := "all"
+		if r.Steps != r.Op.Steps() {
+			steps = r.Steps.String()
+		}
+		dump, transfer := "-", "-"
+		if r.DumpBytes > 0 {
+			dump = humanSize(r.DumpBytes)
+		}
+		if r.Transferred != nil {
+			transfer = humanSize(*r.Transferred)
+		}
+		fmt.Fprintf(w, "    %-19s  %-14s  %-13s  %8s  %-9s  %10s  %10s  %s@%s\n",
+			r.Start.Format("2006-01-02 15:04:05"), r.Op, steps, formatDuration(r.Duration()),
+			r.Status, dump, transfer, r.User, r.Host)
+		if r.Reason != "" {
+			fmt.Fprintf(w, "      ↳ %s\n", r.Reason)
+		}
+		for _, s := range r.StepLog {
+			if s.Retries > 0 {
+				fmt.Fprintf(w, "      ↻ step %d (%s) retried %d time(s), %s\n", s.Step, s.Name, s.Retries, s.Status)
+			}
+		}
+	}
+}
+
+// The bytes rsync moves during a run are added up in the run context, like
+// the SSH password.
+type transferKey struct{}
+
+// transferCount adds up the rsync totals of a run. Runs with no rsync
+// summary, such as lftp ones, leave it unseen.
+type transferCount struct {
+	bytes atomic.Int64
+	seen  atomic.Bool
+}
+
+func withTransferCount(ctx context.Context) context.Context {
+	return context.WithValue(ctx, transferKey{}, new(transferCount))
+}
+
+// transferred returns the bytes counted in ctx, or nil when no rsync
+// summary was seen.
+func transferred(ctx context.Context) *int64 {
+	c, _ := ctx.Value(transferKey{}).(*transferCount)
+	if c == nil || !c.seen.Load() {
+		return nil
+	}
+	n := c.bytes.Load()
+	return &n
+}
+
+// reRsyncTotals matches the summary rsync prints with --info=stats1:
+//
+//	sent 1,234 bytes  received 56,789 bytes  11,604.60 bytes/sec
+var reRsyncTotals = regexp.MustCompile(`^sent ([\d,.]+) bytes\s+received ([\d,.]+) bytes`)
+
+// countTransfer adds the totals of an rsync summary line to the run
+// context and reports whether line was one.
+func countTransfer(ctx context.Context, line string) bool {
+	m := reRsyncTotals.FindStringSubmatch(line)
+	if m == nil {
+		return false
+	}
+	c, _ := ctx.Value(transferKey{}).(*transferCount)
+	if c == nil {
+		return true
+	}
+	c.seen.Store(true)
+	for _, v := range m[1:] {
+		b, err := strconv.ParseInt(strings.NewReplacer(",", "", ".", "").Replace(v), 10, 64)
+		if err == nil {
+			c.bytes.Add(b)
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+func TestHistory(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+
+	start := time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)
+	ok := &RunRecord{Site: "shop", Op: OpAll, Steps: AllSteps, Start: start, End: start.Add(3 * time.Minute),
+		Status: RunOK, DumpBytes: 2048, User: "dev", Host: "laptop",
+		StepLog: []StepRecord{{Step: 1, Name: "Fetch SQL dump", Status: StepDone, Seconds: 42}}}
+	failed := &RunRecord{Site: "shop", Op: OpSQL, Steps: StepsOf(2, 4), Start: start.Add(time.Hour), End: start.Add(time.Hour + time.Minute),
+		Status: RunFailed, Reason: "step 4 (Import SQL): exit status 1", User: "dev", Host: "laptop"}
+	for _, rec := range []*RunRecord{ok, failed} {
+		if err := AppendHistory(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A line cut short by a crash is skipped.
+	f, err := os.OpenFile(config.HistoryFile("shop"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"site":"shop","op":"al`)
+	f.Close()
+
+	recs, err := ReadHistory("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].Op != OpAll || recs[0].StepLog[0].Status != StepDone || recs[1].Steps != StepsOf(2, 4) {
+		t.Fatalf("ReadHistory = %+v", recs)
+	}
+	if last := LastRun("shop"); last == nil || last.Status != RunFailed {
+		t.Fatalf("LastRun = %+v, want the failed run", last)
+	}
+	if LastRun("other") != nil {
+		t.Fatal("LastRun of a site without history is not nil")
+	}
+
+	var buf bytes.Buffer
+	PrintHistory(&buf, "shop", recs)
+	out := buf.String()
+	if strings.Index(out, "SQL only") > strings.Index(out, "SQL + files") {
+		t.Fatalf("most recent run not first:\n%s", out)
+	}
+	for _, want := range []string{"3m00s", "2.0 KB", "2,4", "↳ step 4 (Import SQL): exit status 1", "dev@laptop"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestCountTransfer(t *testing.T) {
+	ctx := withTransferCount(context.Background())
+	if countTransfer(ctx, "total size is 1,000  speedup is 1.00") {
+		t.Fatal("counted a line that is not the summary")
+	}
+	// Without a summary, as with lftp, the count is unknown rather than 0.
+	if got := transferred(ctx); got != nil {
+		t.Fatalf("transferred = %d before any summary, want nil", *got)
+	}
+	countTransfer(ctx, "sent 1,234 bytes  received 56,789 bytes  11,604.60 bytes/sec")
+	countTransfer(ctx, "sent 10 bytes  received 20 bytes  60.00 bytes/sec")
+	if got := transferred(ctx); got == nil || *got != 1234+56789+30 {
+		t.Fatalf("transferred = %v", got)
+	}
+}
+
+func TestHistoryIsTrimmed(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	defer func(keep int, maxBytes int64) { historyKeep, historyMaxBytes = keep, maxBytes }(historyKeep, historyMaxBytes)
+	historyKeep, historyMaxBytes = 3, 1
+
+	start := time.Date(2026, 3, 1, 2, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		rec := &RunRecord{Site: "shop", Op: OpAll, Start: start.Add(time.Duration(i) * time.Hour), Status: RunOK}
+		if err := AppendHistory(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs, err := ReadHistory("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 || !recs[0].Start.Equal(start.Add(2*time.Hour)) || !recs[2].Start.Equal(start.Add(4*time.Hour)) {
+		t.Fatalf("trimmed history = %+v, want the last 3 runs", recs)
+	}
+}
+
+func TestLastRunReadsTheEnd(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	// Records longer than the first chunk LastRun reads.
+	reason := strings.Repeat("x", 20<<10)
+	for i := range 4 {
+		rec := &RunRecord{Site: "shop", Op: OpAll, Status: RunFailed, Reason: reason, Steps: StepsOf(i + 1)}
+		if err := AppendHistory(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.OpenFile(config.HistoryFile("shop"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"site":"shop","op":"al`)
+	f.Close()
+
+	if last := LastRun("shop"); last == nil || last.Steps != StepsOf(4) {
+		t.Fatalf("LastRun = %+v, want the 4th run", last)
+	}
+}
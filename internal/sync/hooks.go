@@ -15,13 +15,10 @@ import (
 // RunHooks runs all *.sh scripts in etc/{conf}/hook/{phase}/ as subprocesses,
 // passing the full config as environment variables using original shell names.
 func RunHooks(ctx context.Context, cfg *config.Config, phase string, sqlFile string, eventCh chan<- Event, step int) error {
-	hookDir := config.HookDir(cfg, phase)
-
-	entries, err := filepath.Glob(filepath.Join(hookDir, "*.sh"))
-	if err != nil || len(entries) == 0 {
+	entries := hookScripts(cfg, phase)
+	if len(entries) == 0 {
 		return nil // no hooks is fine
 	}
-	sort.Strings(entries)
 
 	for _, script := range entries {
 		exposeSecrets, err := hookUsesDBSecrets(script)
@@ -46,6 +43,16 @@ func RunHooks(ctx context.Context, cfg *config.Config, phase string, sqlFile str
 	return nil
 }
 
+// hookScripts returns the sorted *.sh scripts for a hook phase.
+func hookScripts(cfg *config.Config, phase string) []string {
+	entries, err := filepath.Glob(filepath.Join(config.HookDir(cfg, phase), "*.sh"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(entries)
+	return entries
+}
+
 func hookUsesDBSecrets(script string) (bool, error) {
 	data, err := os.ReadFile(script)
 	if err != nil {
@@ -0,0 +1,205 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+	"github.com/carlosrgl/sitesync/internal/logger"
+)
+
+// JSONEvent is one line of the --output=json stream. Every engine event is
+// written as one, and a final "result" record tells how the run ended.
+//
+// Reply is set when the engine waits for an answer on stdin:
+//
+//	error_action  {"action": "retry"}, "continue" or "quit"
+//	auth          {"password": "..."} or {"cancel": true}
+//	confirm       {"confirm": true}, or {"text": "..."} when Expect is set
+type JSONEvent struct {
+	Time     time.Time   `json:"time"`
+	Site     string      `json:"site,omitempty"` // in batch runs
+	Type     string      `json:"type"`
+	Step     int         `json:"step,omitempty"`
+	StepName string      `json:"step_name,omitempty"`
+	Message  string      `json:"message,omitempty"`
+	Progress float64     `json:"progress,omitempty"`
+	Reply    string      `json:"reply,omitempty"`
+	Expect   string      `json:"expect,omitempty"`
+	Stats    []PairStats `json:"stats,omitempty"`
+	Check    *Check      `json:"check,omitempty"`
+	Kind     string      `json:"kind,omitempty"`      // on step_fail and a failed result
+	Status   RunStatus   `json:"status,omitempty"`    // on the result record
+	ExitCode int         `json:"exit_code,omitempty"` // on a failed result
+}
+
+// jsonReply is one line read from stdin in answer to a JSONEvent.
+type jsonReply struct {
+	Action  *ErrorAction `json:"action"`
+	Confirm bool         `json:"confirm"`
+	Text    string       `json:"text"`
+	AuthReply
+}
+
+// RunJSON runs the engine like RunHeadless but writes NDJSON to out and
+// reads the answers to failures, password prompts and confirmations as JSON
+// lines from in. A closed or unreadable in quits, cancels or refuses. A
+// failed sync returns a *RunError.
+func RunJSON(ctx context.Context, cfg *config.Config, op Op, opts Options, log logger.Logger, in io.Reader, out io.Writer) error {
+	eventCh := make(chan Event, 64)
+	go Run(ctx, cfg, op, opts, eventCh, log)
+
+	w := &jsonWriter{enc: json.NewEncoder(out)}
+	reader := bufio.NewReader(in)
+	var lastErr string
+	var lastKind ErrorKind
+	for ev := range eventCh {
+		if ev.Type == EvStepFail && ev.ReplyCh == nil {
+			lastErr, lastKind = ev.Message, ev.Kind
+		}
+		w.write(newJSONEvent(op, ev))
+
+		switch {
+		case ev.Type == EvStepFail && ev.ReplyCh != nil:
+			action := ActionQuit
+			if r, ok := w.readReply(reader, `{"action": ...}`, func(r jsonReply) bool { return r.Action != nil }); ok {
+				action = *r.Action
+			}
+			ev.ReplyCh <- action
+			if action == ActionQuit {
+				lastErr, lastKind = ev.Message, ev.Kind
+			}
+		case ev.Type == EvAuthRequest && ev.AuthReplyCh != nil:
+			reply := AuthReply{Cancel: true}
+			if r, ok := w.readReply(reader, `{"password": ...} or {"cancel": true}`, func(r jsonReply) bool { return r.Password != "" || r.Cancel }); ok {
+				reply = r.AuthReply
+			}
+			ev.AuthReplyCh <- reply
+			if reply.Cancel {
+				lastErr, lastKind = ev.Message, KindCancelled
+			}
+		case ev.Type == EvConfirm && ev.ConfirmCh != nil:
+			ok := false
+			if r, read := w.readReply(reader, "", func(jsonReply) bool { return true }); read {
+				ok = r.Confirm
+				if ev.Expect != "" {
+					ok = r.Text == ev.Expect
+				}
+			}
+			ev.ConfirmCh <- ok
+		}
+	}
+
+	if lastErr == "" {
+		w.write(JSONEvent{Type: "result", Status: RunOK})
+		return nil
+	}
+	if ctx.Err() != nil {
+		lastKind = KindCancelled
+	}
+	err := &RunError{Kind: lastKind, Err: fmt.Errorf("sync failed: %s", lastErr)}
+	w.write(jsonResult(lastErr, lastKind))
+	return err
+}
+
+// WriteJSONResult writes the result record of a sync that failed before
+// RunJSON could start, such as one whose config does not load.
+func WriteJSONResult(out io.Writer, err error) {
+	kind := KindOther
+	var re *RunError
+	if errors.As(err, &re) {
+		kind = re.Kind
+	}
+	w := &jsonWriter{enc: json.NewEncoder(out)}
+	w.write(jsonResult(err.Error(), kind))
+}
+
+func jsonResult(msg string, kind ErrorKind) JSONEvent {
+	status := RunFailed
+	if kind == KindCancelled {
+		status = RunCancelled
+	}
+	return JSONEvent{Type: "result", Status: status, Message: msg, Kind: kind.String(), ExitCode: kind.ExitCode()}
+}
+
+// newJSONEvent converts ev, setting Reply when it waits for an answer.
+func newJSONEvent(op Op, ev Event) JSONEvent {
+	je := JSONEvent{Type: ev.Type.String(), Step: ev.Step, Message: ev.Message, Progress: ev.Progress, Stats: ev.Stats}
+	if ev.Step >= 1 && ev.Step <= 7 {
+		je.StepName = op.StepName(ev.Step)
+	}
+	switch ev.Type {
+	case EvCheck:
+		je.Check = &ev.Check
+	case EvStepFail:
+		je.Kind = ev.Kind.String()
+		if ev.ReplyCh != nil {
+			je.Reply = "error_action"
+		}
+	case EvAuthRequest:
+		je.Reply = "auth"
+	case EvConfirm:
+		je.Reply, je.Expect = "confirm", ev.Expect
+	}
+	return je
+}
+
+// RunBatchJSON runs a batch like RunBatchHeadless, writing the events of
+// every site as NDJSON records with their site set. Nothing is read from
+// stdin since batch runs answer their own prompts. Once all sites are done,
+// one result record per site follows, in the order of sites.
+func RunBatchJSON(ctx context.Context, sites []string, op Op, opts Options, jobs int, out io.Writer) error {
+	w := &jsonWriter{enc: json.NewEncoder(out)}
+	results := RunBatch(ctx, sites, op, opts, jobs, func(site string, ev Event) {
+		je := newJSONEvent(op, ev)
+		je.Site, je.Reply, je.Expect = site, "", ""
+		w.write(je)
+	})
+	for _, r := range results {
+		je := JSONEvent{Type: "result", Site: r.Site, Status: RunOK}
+		if r.Status != RunOK {
+			je = jsonResult(r.Err, r.Kind)
+			je.Site = r.Site
+		}
+		w.write(je)
+	}
+	return BatchError(results)
+}
+
+// jsonWriter writes JSONEvent lines, stamping their time.
+type jsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonWriter) write(je JSONEvent) {
+	je.Time = time.Now()
+	_ = w.enc.Encode(je)
+}
+
+// readReply reads lines until one decodes into a reply accepted by valid,
+// reporting each line it rejects without echoing it, since it may hold a
+// password. It returns false at the end of in.
+func (w *jsonWriter) readReply(r *bufio.Reader, want string, valid func(jsonReply) bool) (jsonReply, bool) {
+	for {
+		line, err := r.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			var reply jsonReply
+			if derr := json.Unmarshal([]byte(line), &reply); derr != nil {
+				w.write(JSONEvent{Type: "invalid_reply", Message: derr.Error()})
+			} else if !valid(reply) {
+				w.write(JSONEvent{Type: "invalid_reply", Message: "expected " + want})
+			} else {
+				return reply, true
+			}
+		}
+		if err != nil {
+			return jsonReply{}, false
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+	"github.com/carlosrgl/sitesync/internal/logger"
+)
+
+func TestRunJSON(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	cfg := config.DefaultConfig()
+	cfg.Transport.Type = "lftp"
+	cfg.Destination.PathToLftp = "sitesync-no-such-lftp"
+	cfg.Destination.FilesRoot = "/var/www/shop"
+	cfg.Sync = []config.SyncPair{{Src: "/srv/shop", Dst: "/var/www/shop"}}
+
+	// The missing lftp fails the preflight, which asks what to do.
+	in := strings.NewReader("not json\n{\"confirm\": true}\n{\"action\": \"quit\"}\n")
+	var out bytes.Buffer
+	err := RunJSON(context.Background(), &cfg, OpFiles, Options{}, logger.Discard(), in, &out)
+	if ExitCode(err) != 2 {
+		t.Fatalf("RunJSON = %v, exit code %d, want a config failure (2)", err, ExitCode(err))
+	}
+
+	var types []string
+	var fail, result JSONEvent
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var je JSONEvent
+		if err := json.Unmarshal([]byte(line), &je); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		if je.Time.IsZero() {
+			t.Fatalf("line %q has no time", line)
+		}
+		types = append(types, je.Type)
+		switch je.Type {
+		case "step_fail":
+			fail = je
+		case "result":
+			result = je
+		}
+	}
+	got := strings.Join(types, " ")
+	if !strings.Contains(got, "check step_fail invalid_reply invalid_reply result") {
+		t.Fatalf("event types = %s", got)
+	}
+	if fail.Reply != "error_action" || fail.Kind != "config" || fail.StepName != "Fetch SQL dump" || !strings.Contains(fail.Message, "lftp") {
+		t.Fatalf("step_fail = %+v", fail)
+	}
+	if result.Status != RunFailed || result.Kind != "config" || result.ExitCode != 2 || !strings.Contains(result.Message, "preflight failed") {
+		t.Fatalf("result = %+v", result)
+	}
+}
@@ -0,0 +1,110 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// maxLinePiece bounds how much of one dump line the replacer and the
+// MariaDB stripper hold in memory. Longer lines (a single extended INSERT
+// can be hundreds of megabytes) are processed in pieces of about this size.
+var maxLinePiece = 1 << 20
+
+// lineReader reads a dump line by line without any limit on line length.
+// Lines of up to max bytes are returned whole; longer ones are returned in
+// pieces. Line endings are dropped as bufio.Scanner does ("\n" and "\r\n").
+type lineReader struct {
+	br      *bufio.Reader
+	max     int
+	closers []io.Closer
+}
+
+func newLineReader(r io.Reader, max int) *lineReader {
+	return &lineReader{br: bufio.NewReaderSize(r, readerSize(max)), max: max}
+}
+
+// readerSize keeps single reads within max bytes.
+func readerSize(max int) int {
+	return min(64*1024, max)
+}
+
+// next reads the start of the next line into buf. full is true when the
+// whole line fit in max bytes; otherwise the caller must read the rest of
+// the line with more before calling next again. io.EOF is returned once
+// there are no more lines.
+func (lr *lineReader) next(buf []byte) (line []byte, full bool, err error) {
+	buf = buf[:0]
+	for {
+		frag, err := lr.br.ReadSlice('\n')
+		buf = append(buf, frag...)
+		switch err {
+		case nil:
+			return trimCR(buf[:len(buf)-1]), true, nil
+		case bufio.ErrBufferFull:
+			if len(buf) >= lr.max {
+				return buf, false, nil
+			}
+		case io.EOF:
+			if len(buf) == 0 {
+				return nil, false, io.EOF
+			}
+			return trimCR(buf), true, nil
+		default:
+			return nil, false, err
+		}
+	}
+}
+
+// more appends up to about n more bytes of the current line to dst. eol is
+// true once the line is complete; the "\n" is dropped but a trailing "\r"
+// is left for the caller, which cannot tell it apart from content before
+// the end of the line is reached.
+func (lr *lineReader) more(dst []byte, n int) (_ []byte, eol bool, err error) {
+	for n > 0 {
+		frag, err := lr.br.ReadSlice('\n')
+		dst = append(dst, frag...)
+		n -= len(frag)
+		switch err {
+		case nil:
+			return dst[:len(dst)-1], true, nil
+		case bufio.ErrBufferFull:
+		case io.EOF:
+			return dst, true, nil
+		default:
+			return dst, false, err
+		}
+	}
+	return dst, false, nil
+}
+
+// unread puts data back in front of the remaining input, to be read again.
+func (lr *lineReader) unread(parts ...io.Reader) {
+	lr.br = bufio.NewReaderSize(io.MultiReader(append(parts, lr.br)...), readerSize(lr.max))
+}
+
+// spillFile returns an anonymous temp file for data that does not fit in
+// memory. It is closed by lr.close.
+func (lr *lineReader) spillFile() (*os.File, error) {
+	f, err := os.CreateTemp("", "sitesync-line-*")
+	if err != nil {
+		return nil, err
+	}
+	// The file stays usable until closed; removing it now means nothing is
+	// left behind if the process dies.
+	os.Remove(f.Name())
+	lr.closers = append(lr.closers, f)
+	return f, nil
+}
+
+func (lr *lineReader) close() {
+	for _, c := range lr.closers {
+		c.Close()
+	}
+	lr.closers = nil
+}
+
+func trimCR(b []byte) []byte {
+	return bytes.TrimSuffix(b, []byte("\r"))
+}
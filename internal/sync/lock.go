@@ -0,0 +1,171 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// LockInfo identifies the run holding a site's lock file.
+type LockInfo struct {
+	PID     int       `json:"pid"`
+	User    string    `json:"user"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+func (li LockInfo) String() string {
+	return fmt.Sprintf("%s@%s (pid %d) since %s", li.User, li.Host, li.PID, li.Started.Format("2006-01-02 15:04:05"))
+}
+
+// LockedError is returned by AcquireLock while another run of the same site
+// holds its lock.
+type LockedError struct {
+	Site   string
+	Holder LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("sync of %s in progress by %s; if that run is gone, retry with --force-unlock", e.Site, e.Holder)
+}
+
+// lockMaxAge is when a lock taken on another host counts as stale, since its
+// PID cannot be checked from here.
+const lockMaxAge = 24 * time.Hour
+
+// LockFilePath returns the lock file of a config inside tmpDir.
+func LockFilePath(tmpDir, confName string) string {
+	return filepath.Join(tmpDir, confName+".lock")
+}
+
+// AcquireLock takes the exclusive lock of confName, replacing a stale one
+// left by a run that died. The returned release func removes the lock
+// unless someone else has taken it over meanwhile.
+func AcquireLock(tmpDir, confName string) (release func(), err error) {
+	me := currentLockInfo()
+	data, err := json.Marshal(me)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lock is written to a temp file and hard-linked into place, so it
+	// appears atomically with its content and link fails if it exists.
+	tmp, err := os.CreateTemp(tmpDir, confName+".lock-*")
+	if err != nil {
+		return nil, fmt.Errorf("create lock file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, werr := tmp.Write(data)
+	if err := errors.Join(werr, tmp.Close()); err != nil {
+		return nil, fmt.Errorf("write lock file: %w", err)
+	}
+
+	path := LockFilePath(tmpDir, confName)
+	release = func() { releaseLock(path, me) }
+	err = os.Link(tmp.Name(), path)
+	if err == nil {
+		return release, nil
+	}
+	if !os.IsExist(err) {
+		return nil, fmt.Errorf("create lock file: %w", err)
+	}
+
+	// Take the lock over when it is stale or unreadable. Two runs may find
+	// the same stale lock, so the check and the takeover happen under an
+	// flock of tmpDir; the second run then sees the lock of the first
+	// instead of removing it.
+	unlock, err := lockDir(tmpDir)
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", tmpDir, err)
+	}
+	defer unlock()
+	holder, rerr := readLock(path)
+	if rerr == nil && !holder.stale() {
+		return nil, &LockedError{Site: confName, Holder: holder}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("remove stale lock file: %w", err)
+	}
+	if err := os.Link(tmp.Name(), path); err != nil {
+		// A run that found no lock at all took it meanwhile.
+		if holder, rerr := readLock(path); os.IsExist(err) && rerr == nil {
+			return nil, &LockedError{Site: confName, Holder: holder}
+		}
+		return nil, fmt.Errorf("create lock file: %w", err)
+	}
+	return release, nil
+}
+
+// lockDir holds an exclusive flock on dir until unlock is called.
+func lockDir(dir string) (unlock func(), err error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Closing the file releases the flock.
+	return func() { f.Close() }, nil
+}
+
+// ForceUnlock removes the lock of confName whoever holds it and returns
+// the holder, or nil when the site was not locked.
+func ForceUnlock(tmpDir, confName string) (*LockInfo, error) {
+	path := LockFilePath(tmpDir, confName)
+	holder, err := readLock(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("remove lock file: %w", err)
+	}
+	return &holder, nil
+}
+
+func releaseLock(path string, me LockInfo) {
+	if holder, err := readLock(path); err == nil && holder.PID == me.PID && holder.Started.Equal(me.Started) {
+		_ = os.Remove(path)
+	}
+}
+
+func readLock(path string) (LockInfo, error) {
+	var li LockInfo
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return li, err
+	}
+	err = json.Unmarshal(data, &li)
+	return li, err
+}
+
+func currentLockInfo() LockInfo {
+	li := LockInfo{PID: os.Getpid(), User: os.Getenv("USER"), Started: time.Now()}
+	if u, err := user.Current(); err == nil {
+		li.User = u.Username
+	}
+	li.Host, _ = os.Hostname()
+	return li
+}
+
+// stale reports whether the run that took the lock is gone.
+func (li LockInfo) stale() bool {
+	if host, _ := os.Hostname(); li.Host == host {
+		return !processAlive(li.PID)
+	}
+	return time.Since(li.Started) > lockMaxAge
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	dir := t.TempDir()
+
+	release, err := AcquireLock(dir, "site")
+	if err != nil {
+		t.Fatalf("first AcquireLock: %v", err)
+	}
+	_, err = AcquireLock(dir, "site")
+	var locked *LockedError
+	if !errors.As(err, &locked) || locked.Holder.PID != os.Getpid() {
+		t.Fatalf("second AcquireLock error = %v, want LockedError held by this process", err)
+	}
+	if _, err := AcquireLock(dir, "other"); err != nil {
+		t.Fatalf("AcquireLock of another site: %v", err)
+	}
+
+	release()
+	release2, err := AcquireLock(dir, "site")
+	if err != nil {
+		t.Fatalf("AcquireLock after release: %v", err)
+	}
+	release2()
+	if _, err := os.Stat(LockFilePath(dir, "site")); !os.IsNotExist(err) {
+		t.Fatalf("lock file left after release: %v", err)
+	}
+}
+
+func TestAcquireLockReplacesStaleLock(t *testing.T) {
+	dir := t.TempDir()
+
+	// A finished process leaves a PID that is no longer running.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("cannot run true:", err)
+	}
+	host, _ := os.Hostname()
+	data, _ := json.Marshal(LockInfo{PID: cmd.Process.Pid, User: "someone", Host: host, Started: time.Now()})
+	if err := os.WriteFile(LockFilePath(dir, "site"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := AcquireLock(dir, "site")
+	if err != nil {
+		t.Fatalf("AcquireLock over a stale lock: %v", err)
+	}
+	defer release()
+
+	holder, err := ForceUnlock(dir, "site")
+	if err != nil || holder == nil || holder.PID != os.Getpid() {
+		t.Fatalf("ForceUnlock = %+v, %v", holder, err)
+	}
+	if holder, err := ForceUnlock(dir, "site"); holder != nil || err != nil {
+		t.Fatalf("ForceUnlock of an unlocked site = %+v, %v", holder, err)
+	}
+}
+
+func TestAcquireLockRechecksStaleLockUnderFlock(t *testing.T) {
+	dir := t.TempDir()
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("cannot run true:", err)
+	}
+	host, _ := os.Hostname()
+	stale, _ := json.Marshal(LockInfo{PID: cmd.Process.Pid, User: "someone", Host: host, Started: time.Now()})
+	if err := os.WriteFile(LockFilePath(dir, "site"), stale, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// While another run holds the flock, it replaces the stale lock with
+	// its own; the waiting run must then find that lock, not remove it.
+	unlock, err := lockDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := AcquireLock(dir, "site")
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	live, _ := json.Marshal(LockInfo{PID: os.Getpid(), User: "other", Host: host, Started: time.Now()})
+	if err := os.WriteFile(LockFilePath(dir, "site"), live, 0600); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	var locked *LockedError
+	if err := <-errCh; !errors.As(err, &locked) || locked.Holder.User != "other" {
+		t.Fatalf("AcquireLock error = %v, want LockedError held by the other run", err)
+	}
+}
@@ -0,0 +1,477 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// PlanStep is what one step of a sync would do.
+type PlanStep struct {
+	Step    int      `json:"step"`
+	Name    string   `json:"name"`
+	Skipped bool     `json:"skipped,omitempty"`
+	Lines   []string `json:"lines"`
+}
+
+// FileList is the rsync dry run of one [[sync]] pair.
+type FileList struct {
+	Src     string   `json:"src"`
+	Dst     string   `json:"dst"`
+	Items   []string `json:"items"` // itemized changes, e.g. ">f+++++++++ 1.2 KB uploads/a.jpg"
+	Files   int      `json:"files"`
+	Dirs    int      `json:"dirs"`
+	Deletes int      `json:"deletes"`
+	Bytes   int64    `json:"bytes"`
+	Err     string   `json:"error,omitempty"`
+}
+
+// Plan describes a sync without running it.
+type Plan struct {
+	Site      string     `json:"site"`
+	Op        string     `json:"op"`
+	Target    string     `json:"target,omitempty"` // database that would be overwritten
+	Streaming bool       `json:"streaming"`
+	Steps     []PlanStep `json:"steps"`
+	Files     []FileList `json:"files,omitempty"`
+}
+
+// BuildPlan returns the commands every selected step of op would run, with
+// passwords redacted, and asks rsync for the files step 6 would transfer.
+// The rsync dry run is the only command it executes; it uses key
+// authentication only and never writes anything locally.
+func BuildPlan(ctx context.Context, cfg *config.Config, op Op, steps Steps) (*Plan, error) {
+	confName := filepath.Base(filepath.Dir(cfg.ConfigFilePath()))
+	dumpPath := DumpFilePath(config.TmpDir(), confName)
+	fetchPath := FetchFilePath(cfg, dumpPath)
+	opName := op.String()
+	if sel := op.Select(steps); sel != op.Steps() {
+		opName += ", steps " + sel.String()
+	}
+	steps = op.Select(steps)
+	if op == OpPush {
+		return buildPushPlan(ctx, cfg, confName, opName, dumpPath, steps)
+	}
+
+	p := &Plan{Site: confName, Op: opName, Streaming: useStreaming(cfg, op, steps)}
+	if steps.Has(4) {
+		dst := cfg.Destination
+		p.Target = fmt.Sprintf("%s@%s/%s", dst.DBUser, dst.DBHostname, dst.DBName)
+	}
+
+	var snapLine string
+	if steps.Has(4) && cfg.Database.SnapshotKeep > 0 {
+		bin, args, err := niceCommand(cfg.Destination.LocalNice, dumpBin(cfg), buildSnapshotArgs(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("parse local_nice: %w", err)
+		}
+		dir := config.SnapshotDir(confName)
+		snapLine = fmt.Sprintf("$ %s %s | gzip > %s", bin, redactArgs(args),
+			filepath.Join(dir, time.Now().Format(snapshotIDLayout)+"_"+cfg.Destination.DBName+snapshotExt))
+	}
+	importBin, importArgs, err := niceCommand(cfg.Destination.LocalNice, mysqlBin(cfg), buildMySQLArgs(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("parse local_nice: %w", err)
+	}
+	importCmd := importBin + " " + redactArgs(importArgs)
+
+	var pairs []string
+	for i, pair := range cfg.Replace {
+		pairs = append(pairs, describePair(i, len(cfg.Replace), pair))
+	}
+
+	// Step 1.
+	var fetch []string
+	if steps.Has(1) {
+		src, err := planSource(cfg, fetchPath, p.Streaming)
+		if err != nil {
+			return nil, err
+		}
+		if p.Streaming {
+			if snapLine != "" {
+				fetch = append(fetch, snapLine)
+			}
+			pipe := "| "
+			if streamCompressed(cfg) {
+				pipe += "gunzip | "
+			}
+			if len(cfg.Replace) > 0 {
+				pipe += fmt.Sprintf("replace (%d pairs) | ", len(cfg.Replace))
+			}
+			fetch = append(fetch, src, pipe+importCmd)
+		} else {
+			fetch = append(fetch, src)
+		}
+	}
+
+	// Step 2.
+	var replace []string
+	if steps.Has(2) {
+		if p.Streaming {
+			replace = append(replace, "applied while streaming (step 1)")
+		} else if fetchPath != dumpPath {
+			replace = append(replace, fmt.Sprintf("decompress %s → %s", fetchPath, dumpPath))
+		}
+		if len(pairs) == 0 {
+			replace = append(replace, "no replace pairs")
+		}
+		replace = append(replace, pairs...)
+		if cfg.Database.VerifySerialized {
+			if p.Streaming {
+				replace = append(replace, "verify_serialized skipped: no dump file in streaming mode")
+			} else {
+				replace = append(replace, "verify serialized values in "+dumpPath)
+			}
+		}
+	}
+
+	// Step 4.
+	var imp []string
+	if steps.Has(4) {
+		if p.Streaming {
+			imp = append(imp, "imported while streaming (step 1)")
+		} else {
+			if snapLine != "" {
+				imp = append(imp, snapLine)
+			}
+			imp = append(imp, fmt.Sprintf("$ %s < %s", importCmd, dumpPath))
+		}
+	}
+
+	// Step 6.
+	var files []string
+	if steps.Has(6) {
+		files, err = planFiles(cfg, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.Steps = []PlanStep{
+		{Step: 1, Lines: fetch},
+		{Step: 2, Lines: replace},
+		{Step: 3, Lines: planHooks(cfg, "before")},
+		{Step: 4, Lines: imp},
+		{Step: 5, Lines: planHooks(cfg, "between")},
+		{Step: 6, Lines: files},
+		{Step: 7, Lines: planHooks(cfg, "after")},
+	}
+	skipUnselected(p.Steps, op, steps)
+
+	if steps.Has(6) {
+		for _, pair := range cfg.Sync {
+			p.Files = append(p.Files, dryRunFiles(ctx, cfg, pair, false))
+		}
+	}
+	return p, nil
+}
+
+// buildPushPlan is BuildPlan for OpPush.
+func buildPushPlan(ctx context.Context, cfg *config.Config, confName, opName, dumpPath string, steps Steps) (*Plan, error) {
+	src := cfg.Source
+	p := &Plan{Site: confName, Op: opName}
+	if steps.Has(4) {
+		p.Target = fmt.Sprintf("%s@%s/%s on %s", src.DBUser, src.DBHostname, src.DBName, src.Server)
+	}
+	if err := checkPush(cfg); err != nil {
+		return nil, err
+	}
+
+	args, err := buildPushDumpArgs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	bin, args, err := niceCommand(cfg.Destination.LocalNice, dumpBin(cfg), args)
+	if err != nil {
+		return nil, fmt.Errorf("parse local_nice: %w", err)
+	}
+	dump := []string{fmt.Sprintf("$ %s %s > %s", bin, redactArgs(args), dumpPath)}
+
+	pairs, skipped := reversePairs(cfg.Replace)
+	var replace []string
+	for _, pair := range skipped {
+		replace = append(replace, fmt.Sprintf("regex pair %q cannot be reversed, skipped", pair.Search))
+	}
+	if len(pairs) == 0 {
+		replace = append(replace, "no replace pairs")
+	}
+	for i, pair := range pairs {
+		replace = append(replace, describePair(i, len(pairs), pair))
+	}
+
+	_, logCmd, err := buildRemoteImportCommand(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ssh := fmt.Sprintf("ssh %s %s@%s \"%s\"", strings.Join(sshArgs(src.Port, true), " "), src.User, src.Server, logCmd)
+	imp := []string{"$ " + ssh + " < " + dumpPath}
+	if src.Compress {
+		imp = []string{fmt.Sprintf("$ gzip -c %s | %s", dumpPath, ssh)}
+	}
+
+	files, err := planFiles(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Transport.Type == "lftp" && len(cfg.Sync) > 0 {
+		files = []string{"push needs the rsync transport"}
+	}
+
+	noHooks := []string{"hooks are not run when pushing"}
+	p.Steps = []PlanStep{
+		{Step: 1, Lines: dump},
+		{Step: 2, Lines: replace},
+		{Step: 3, Lines: noHooks},
+		{Step: 4, Lines: imp},
+		{Step: 5, Lines: noHooks},
+		{Step: 6, Lines: files},
+		{Step: 7, Lines: noHooks},
+	}
+	skipUnselected(p.Steps, OpPush, steps)
+	if steps.Has(6) {
+		for _, pair := range cfg.Sync {
+			p.Files = append(p.Files, dryRunFiles(ctx, cfg, pair, true))
+		}
+	}
+	return p, nil
+}
+
+// skipUnselected names the plan steps and marks those not in steps as
+// skipped, dropping their lines.
+func skipUnselected(ps []PlanStep, op Op, steps Steps) {
+	for i := range ps {
+		ps[i].Name = op.StepName(ps[i].Step)
+		if !steps.Has(ps[i].Step) {
+			ps[i].Skipped, ps[i].Lines = true, nil
+		}
+	}
+}
+
+func dumpBin(cfg *config.Config) string {
+	if cfg.Destination.PathToMysqldump != "" {
+		return cfg.Destination.PathToMysqldump
+	}
+	return "mysqldump"
+}
+
+// planSource returns the step 1 command for the source type. In streaming
+// mode the dump goes to stdout instead of fetchPath.
+func planSource(cfg *config.Config, fetchPath string, streaming bool) (string, error) {
+	src := cfg.Source
+	target := src.User + "@" + src.Server
+	redirect := " > " + fetchPath
+	if streaming {
+		redirect = ""
+	}
+	switch src.Type {
+	case "local_file":
+		if streaming {
+			return "$ cat " + src.File, nil
+		}
+		return fmt.Sprintf("copy %s → %s", src.File, fetchPath), nil
+	case "remote_file":
+		if streaming {
+			return fmt.Sprintf("$ ssh %s %s cat %s", strings.Join(sshArgs(src.Port, true), " "), target, src.File), nil
+		}
+		return fmt.Sprintf("$ scp %s %s:%s %s", strings.Join(scpArgs(src.Port, true), " "), target, src.File, fetchPath), nil
+	case "local_base":
+		args, err := buildDumpArgs(cfg, false)
+		if err != nil {
+			return "", err
+		}
+		bin, args, err := niceCommand(cfg.Destination.LocalNice, dumpBin(cfg), args)
+		if err != nil {
+			return "", fmt.Errorf("parse local_nice: %w", err)
+		}
+		line := "$ " + bin + " " + redactArgs(args)
+		if !streaming && dumpCompressed(cfg) {
+			line += " | gzip"
+		}
+		return line + redirect, nil
+	case "remote_base":
+		_, logCmd, err := buildRemoteDumpCommand(cfg)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("$ ssh %s %s %s%s", strings.Join(sshArgs(src.Port, true), " "), target, logCmd, redirect), nil
+	}
+	return "", fmt.Errorf("unknown source type %q", src.Type)
+}
+
+func planHooks(cfg *config.Config, phase string) []string {
+	scripts := hookScripts(cfg, phase)
+	if len(scripts) == 0 {
+		return []string{"no hooks in " + config.HookDir(cfg, phase)}
+	}
+	lines := make([]string, len(scripts))
+	for i, script := range scripts {
+		lines[i] = "$ bash " + script
+	}
+	return lines
+}
+
+func planFiles(cfg *config.Config, push bool) ([]string, error) {
+	if len(cfg.Sync) == 0 {
+		return []string{"no sync pairs configured"}, nil
+	}
+	var lines []string
+	for _, pair := range cfg.Sync {
+		if cfg.Transport.Type == "lftp" {
+			_, logScript := buildLFTPScript(cfg, pair)
+			lines = append(lines, "$ "+rsyncOrLftp(cfg)+" <commands via stdin>", logScript)
+			continue
+		}
+		args, err := buildRsyncArgs(cfg, pair, true, push)
+		if err != nil {
+			return nil, err
+		}
+		bin, args, err := niceCommand(cfg.Destination.LocalNice, rsyncOrLftp(cfg), args)
+		if err != nil {
+			return nil, fmt.Errorf("parse local_nice: %w", err)
+		}
+		lines = append(lines, fmt.Sprintf("$ %s %s", bin, strings.Join(args, " ")))
+	}
+	return lines, nil
+}
+
+func rsyncOrLftp(cfg *config.Config) string {
+	if cfg.Transport.Type == "lftp" {
+		if cfg.Destination.PathToLftp != "" {
+			return cfg.Destination.PathToLftp
+		}
+		return "lftp"
+	}
+	if cfg.Destination.PathToRsync != "" {
+		return cfg.Destination.PathToRsync
+	}
+	return "rsync"
+}
+
+// dryRunFiles lists what rsync would transfer for pair, using the same
+// arguments as step 6 plus --dry-run.
+func dryRunFiles(ctx context.Context, cfg *config.Config, pair config.SyncPair, push bool) FileList {
+	fl := FileList{Src: pair.Src, Dst: pair.Dst}
+	if push {
+		fl.Src, fl.Dst = pair.Dst, cfg.Source.Server+":"+pair.Src
+	}
+	if cfg.Transport.Type == "lftp" {
+		fl.Err = "no dry run with the lftp transport"
+		return fl
+	}
+	args, err := dryRunArgs(cfg, pair, push)
+	if err != nil {
+		fl.Err = err.Error()
+		return fl
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, rsyncOrLftp(cfg), args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+	parseItemized(&fl, &stdout)
+	if runErr != nil {
+		switch {
+		case shouldPromptForSSHPassword(fmt.Errorf("%w: %s", runErr, stderr.String())):
+			fl.Err = "key authentication failed; the dry run cannot ask for a password"
+		case lastLine(stderr.String()) != "":
+			fl.Err = lastLine(stderr.String())
+		default:
+			fl.Err = runErr.Error()
+		}
+	}
+	return fl
+}
+
+// dryRunArgs turns the step 6 rsync arguments into a dry run that prints
+// one itemized line per change with its size in bytes.
+func dryRunArgs(cfg *config.Config, pair config.SyncPair, push bool) ([]string, error) {
+	args, err := buildRsyncArgs(cfg, pair, true, push)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, a := range args[:len(args)-2] {
+		if a != "--info=progress2" {
+			out = append(out, a)
+		}
+	}
+	out = append(out, "--dry-run", "--itemize-changes", "--no-human-readable", "--out-format=%i %l %n")
+	return append(out, args[len(args)-2:]...), nil
+}
+
+// itemizeRe matches an --out-format="%i %l %n" line, e.g.
+// ">f+++++++++ 1234 uploads/a.jpg" or "*deleting   0 old.txt".
+var itemizeRe = regexp.MustCompile(`^(\*deleting|[<>ch.][fdLDS]\S{9})\s+(\d+) (.+)$`)
+
+// parseItemized adds the rsync dry run output in r to fl. Other lines,
+// such as the -v file list header and totals, are ignored.
+func parseItemized(fl *FileList, r io.Reader) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		m := itemizeRe.FindStringSubmatch(sc.Text())
+		if m == nil {
+			continue
+		}
+		item, name := m[1], m[3]
+		size, _ := strconv.ParseInt(m[2], 10, 64)
+		switch {
+		case item == "*deleting":
+			fl.Deletes++
+			fl.Items = append(fl.Items, "deleting    "+name)
+			continue
+		case item[1] == 'f' && item[0] != '.':
+			fl.Files++
+			fl.Bytes += size
+			fl.Items = append(fl.Items, fmt.Sprintf("%s %s %s", item, humanSize(size), name))
+			continue
+		case item[1] == 'd' && item[0] == 'c':
+			fl.Dirs++
+		}
+		fl.Items = append(fl.Items, item+" "+name)
+	}
+}
+
+// Print writes p for a terminal.
+func (p *Plan) Print(w io.Writer) {
+	fmt.Fprintf(w, "Plan for %s (%s), nothing will be changed\n", p.Site, p.Op)
+	if p.Target != "" {
+		fmt.Fprintf(w, "  database overwritten: %s\n", p.Target)
+	}
+	if p.Streaming {
+		fmt.Fprintln(w, "  mode: streaming (steps 1, 2 and 4 run as one pipeline)")
+	}
+	for _, s := range p.Steps {
+		fmt.Fprintf(w, "\n[%d/7] %s", s.Step, s.Name)
+		if s.Skipped {
+			fmt.Fprintln(w, " (skipped)")
+			continue
+		}
+		fmt.Fprintln(w)
+		for _, line := range s.Lines {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	for _, fl := range p.Files {
+		fmt.Fprintf(w, "\nFiles %s → %s\n", fl.Src, fl.Dst)
+		for _, item := range fl.Items {
+			fmt.Fprintf(w, "  %s\n", item)
+		}
+		if fl.Err != "" {
+			fmt.Fprintf(w, "  ✘ %s\n", fl.Err)
+			continue
+		}
+		fmt.Fprintf(w, "  %d file(s), %s, %d dir(s), %d deletion(s)\n", fl.Files, humanSize(fl.Bytes), fl.Dirs, fl.Deletes)
+	}
+}
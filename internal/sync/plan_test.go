@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+func TestParseItemized(t *testing.T) {
+	out := `receiving incremental file list
+cd+++++++++ 4096 uploads/
+>f+++++++++ 1200 uploads/a.jpg
+>f.st...... 300 uploads/my file.pdf
+.d..t...... 4096 themes/
+*deleting   0 old.txt
+
+sent 20 bytes  received 200 bytes  440.00 bytes/sec
+total size is 1500  speedup is 6.82 (DRY RUN)
+`
+	var fl FileList
+	parseItemized(&fl, strings.NewReader(out))
+	if fl.Files != 2 || fl.Dirs != 1 || fl.Deletes != 1 || fl.Bytes != 1500 {
+		t.Fatalf("got files=%d dirs=%d deletes=%d bytes=%d, want 2 1 1 1500", fl.Files, fl.Dirs, fl.Deletes, fl.Bytes)
+	}
+	if len(fl.Items) != 5 || !strings.HasSuffix(fl.Items[2], "uploads/my file.pdf") {
+		t.Fatalf("items = %q", fl.Items)
+	}
+}
+
+func TestBuildPlan(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	cfg := &config.Config{
+		Source: config.SourceConfig{Type: "local_base", User: "deploy", Server: "shop.com", Port: 22, DBHostname: "localhost", DBUser: "prod",
+			DBPassword: "s3cret", DBName: "shop_prod"},
+		Destination: config.DestConfig{DBHostname: "localhost", DBUser: "root", DBPassword: "pw",
+			DBName: "shop_local", PathToRsync: "sitesync-no-such-rsync"},
+		Database: config.DatabaseConfig{SnapshotKeep: 3},
+		Replace:  []config.ReplacePair{{Search: "https://shop.com", Replace: "http://shop.test"}},
+		Sync:     []config.SyncPair{{Src: "/srv/shop/uploads", Dst: "/var/www/shop/uploads"}},
+	}
+
+	plan, err := BuildPlan(context.Background(), cfg, OpAll, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Target != "root@localhost/shop_local" || plan.Streaming {
+		t.Fatalf("target = %q streaming = %v", plan.Target, plan.Streaming)
+	}
+	if len(plan.Steps) != 7 {
+		t.Fatalf("got %d steps", len(plan.Steps))
+	}
+	var sb strings.Builder
+	plan.Print(&sb)
+	text := sb.String()
+	if strings.Contains(text, "s3cret") || strings.Contains(text, "-ppw") {
+		t.Fatalf("plan leaks a password:\n%s", text)
+	}
+	for _, want := range []string{
+		"$ mysqldump -h localhost -u prod -p[REDACTED] shop_prod > ",
+		`[1/1] "https://shop.com" → "http://shop.test"`,
+		"--add-drop-database -h localhost -u root -p[REDACTED] --databases shop_local | gzip > ",
+		"$ mysql -h localhost -u root -p[REDACTED] shop_local < ",
+		"$ sitesync-no-such-rsync -uvrpztl -e ssh",
+		"deploy@shop.com:/srv/shop/uploads/ /var/www/shop/uploads/",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("plan misses %q:\n%s", want, text)
+		}
+	}
+	if len(plan.Files) != 1 || plan.Files[0].Err == "" {
+		t.Fatalf("files = %+v, want a dry run error for the missing rsync", plan.Files)
+	}
+
+	plan, err = BuildPlan(context.Background(), cfg, OpFiles, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Target != "" || !plan.Steps[0].Skipped || plan.Steps[5].Skipped {
+		t.Fatalf("OpFiles plan = %+v", plan)
+	}
+}
@@ -0,0 +1,139 @@
+package sync
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorPolicy decides what Run does when a step fails, so that unattended
+// runs need not answer the retry / continue / quit prompt. It is parsed from
+// rules separated by semicolons:
+//
+//	retry=3/30s,abort; 3,5,7:continue; 4:abort
+//
+// Each rule is an optional list of steps followed by a colon, an optional
+// retry=N[/DELAY] and the action to take when the step still fails: ask,
+// continue or abort. A rule without steps covers all of them, and a later
+// rule overrides an earlier one for the steps it names. The delay doubles
+// before each further retry. Steps no rule covers ask, like before.
+type ErrorPolicy []errorRule
+
+type errorRule struct {
+	steps   Steps
+	retries int
+	delay   time.Duration
+	ask     bool
+	then    ErrorAction // when !ask
+}
+
+// maxRetries bounds retry=N so the doubled delay stays reasonable.
+const maxRetries = 10
+
+// ParseErrorPolicy parses the rules of an --on-error flag or of the
+// on_error key of [run]. An empty string is an empty policy.
+func ParseErrorPolicy(str string) (ErrorPolicy, error) {
+	var p ErrorPolicy
+	for _, text := range strings.Split(str, ";") {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		r, err := parseErrorRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("on-error rule %q: %w", text, err)
+		}
+		p = append(p, r)
+	}
+	return p, nil
+}
+
+func parseErrorRule(text string) (errorRule, error) {
+	r := errorRule{steps: AllSteps, ask: true}
+	if stepList, rest, ok := strings.Cut(text, ":"); ok {
+		steps, err := ParseSteps(stepList)
+		if err != nil {
+			return r, err
+		}
+		r.steps, text = steps, rest
+	}
+	parts := strings.Split(text, ",")
+	if len(parts) > 2 {
+		return r, fmt.Errorf("want [STEPS:][retry=N[/DELAY],]ACTION")
+	}
+	if n, ok := strings.CutPrefix(strings.TrimSpace(parts[0]), "retry="); ok {
+		n, delay, hasDelay := strings.Cut(n, "/")
+		var err error
+		if r.retries, err = strconv.Atoi(n); err != nil || r.retries < 1 || r.retries > maxRetries {
+			return r, fmt.Errorf("retry count must be 1 to %d", maxRetries)
+		}
+		if hasDelay {
+			if r.delay, err = time.ParseDuration(delay); err != nil || r.delay < 0 {
+				return r, fmt.Errorf("invalid retry delay %q", delay)
+			}
+		}
+		parts = parts[1:]
+	}
+	if len(parts) == 0 {
+		return r, nil
+	}
+	if len(parts) > 1 {
+		return r, fmt.Errorf("want [STEPS:][retry=N[/DELAY],]ACTION")
+	}
+	switch action := strings.TrimSpace(parts[0]); action {
+	case "ask":
+	case "continue":
+		r.ask, r.then = false, ActionContinue
+	case "abort":
+		r.ask, r.then = false, ActionQuit
+	default:
+		return r, fmt.Errorf("unknown action %q: want ask, continue, abort or retry=N", action)
+	}
+	return r, nil
+}
+
+// rule returns the rule for failures of step: the last one naming it.
+func (p ErrorPolicy) rule(step int) errorRule {
+	r := errorRule{ask: true}
+	for _, pr := range p {
+		if pr.steps.Has(step) {
+			r = pr
+		}
+	}
+	return r
+}
+
+// retryDelay is how long to wait before retry number n, counted from 1.
+func (r errorRule) retryDelay(n int) time.Duration {
+	return r.delay << (n - 1)
+}
+
+func (p ErrorPolicy) String() string {
+	rules := make([]string, len(p))
+	for i, r := range p {
+		var sb strings.Builder
+		if r.steps != AllSteps {
+			sb.WriteString(r.steps.String() + ":")
+		}
+		if r.retries > 0 {
+			fmt.Fprintf(&sb, "retry=%d", r.retries)
+			if r.delay > 0 {
+				fmt.Fprintf(&sb, "/%s", r.delay)
+			}
+			if !r.ask {
+				sb.WriteString(",")
+			}
+		}
+		switch {
+		case r.ask && r.retries == 0:
+			sb.WriteString("ask")
+		case !r.ask && r.then == ActionContinue:
+			sb.WriteString("continue")
+		case !r.ask:
+			sb.WriteString("abort")
+		}
+		rules[i] = sb.String()
+	}
+	return strings.Join(rules, "; ")
+}
@@ -0,0 +1,99 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+	"github.com/carlosrgl/sitesync/internal/logger"
+)
+
+func TestParseErrorPolicy(t *testing.T) {
+	p, err := ParseErrorPolicy("retry=3/30s,abort; 3,5,7:continue ;4:abort;6:retry=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.String(), "retry=3/30s,abort; 3,5,7:continue; 4:abort; 6:retry=2"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+	tests := []struct {
+		step    int
+		retries int
+		ask     bool
+		then    ErrorAction
+	}{
+		{1, 3, false, ActionQuit},
+		{3, 0, false, ActionContinue},
+		{4, 0, false, ActionQuit},
+		{6, 2, true, 0},
+	}
+	for _, tt := range tests {
+		r := p.rule(tt.step)
+		if r.retries != tt.retries || r.ask != tt.ask || !r.ask && r.then != tt.then {
+			t.Errorf("rule(%d) = %+v, want %d retries, ask %v, then %v", tt.step, r, tt.retries, tt.ask, tt.then)
+		}
+	}
+	if d := p.rule(1).retryDelay(3); d != 2*time.Minute {
+		t.Errorf("third retry delay = %s, want 2m", d)
+	}
+	if r := (ErrorPolicy{}).rule(2); !r.ask || r.retries != 0 {
+		t.Errorf("empty policy rule = %+v, want ask", r)
+	}
+
+	for _, bad := range []string{"skip", "retry=0", "retry=x", "retry=2/soon", "8:abort", "retry=2,continue,abort", "continue,abort"} {
+		if _, err := ParseErrorPolicy(bad); err == nil {
+			t.Errorf("ParseErrorPolicy(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestRunAppliesErrorPolicy(t *testing.T) {
+	etc := t.TempDir()
+	t.Setenv("SITESYNC_ETC", etc)
+	dir := filepath.Join(etc, "shop")
+	if err := os.MkdirAll(filepath.Join(dir, "hook", "after"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	counter := filepath.Join(dir, "runs")
+	hook := "#!/bin/bash\necho x >> " + counter + "\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "hook", "after", "fail.sh"), []byte(hook), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte("[run]\non_error = \"abort\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The flag overrides the abort of the config for step 7.
+	onError, err := ParseErrorPolicy("7:retry=2/1ms,continue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventCh := make(chan Event, 64)
+	go Run(context.Background(), cfg, OpFiles, Options{Steps: StepsOf(7), OnError: onError}, eventCh, logger.Discard())
+	for ev := range eventCh {
+		if ev.Type == EvStepFail {
+			t.Fatalf("step %d failed although the policy continues: %s", ev.Step, ev.Message)
+		}
+	}
+
+	data, _ := os.ReadFile(counter)
+	if n := strings.Count(string(data), "x"); n != 3 {
+		t.Fatalf("hook ran %d times, want 3", n)
+	}
+	last := LastRun("shop")
+	if last == nil || last.Status != RunOK || last.OnError != "abort; 7:retry=2/1ms,continue" {
+		t.Fatalf("LastRun = %+v", last)
+	}
+	s := last.StepLog[len(last.StepLog)-1]
+	if s.Step != 7 || s.Status != StepContinued || s.Retries != 2 {
+		t.Fatalf("step 7 record = %+v, want continued after 2 retries", s)
+	}
+}
@@ -0,0 +1,460 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// CheckStatus is the outcome of a preflight check.
+type CheckStatus uint8
+
+const (
+	CheckPass CheckStatus = iota
+	CheckWarn
+	CheckFail
+)
+
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckPass:
+		return "pass"
+	case CheckWarn:
+		return "warn"
+	default:
+		return "fail"
+	}
+}
+
+// MarshalText encodes the status as pass, warn or fail.
+func (s CheckStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a status written by MarshalText.
+func (s *CheckStatus) UnmarshalText(text []byte) error {
+	for _, c := range []CheckStatus{CheckPass, CheckWarn, CheckFail} {
+		if string(text) == c.String() {
+			*s = c
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown check status %q", text)
+}
+
+// Check is one line of the preflight checklist or of sitesync doctor.
+type Check struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+	Hint   string      `json:"hint,omitempty"` // how to fix a warning or failure
+}
+
+// preflightTimeout bounds each probe so an unreachable host cannot hang the
+// run before it has even started.
+const preflightTimeout = 20 * time.Second
+
+// Preflight checks, before step 1, that everything the selected steps of op
+// need is in place: local and remote binaries, room in tmp/ for the dump or
+// the dump left by an earlier run, and a reachable local database. Each
+// result is sent as an EvCheck event as soon as it is known; the full list
+// is returned.
+func Preflight(ctx context.Context, cfg *config.Config, op Op, steps Steps, streaming bool, eventCh chan<- Event) []Check {
+	var checks []Check
+	report := func(c Check) {
+		checks = append(checks, c)
+		sendEvent(ctx, eventCh, Event{Type: EvCheck, Check: c})
+	}
+	if op == OpPush {
+		preflightPush(ctx, cfg, steps, eventCh, report)
+		return checks
+	}
+	fetchOn := steps.Has(1)
+	importOn := steps.Has(4)
+	filesOn := steps.Has(6) && len(cfg.Sync) > 0
+	rsyncOn := filesOn && cfg.Transport.Type != "lftp"
+
+	// Local binaries, in the order the steps use them.
+	var bins [][2]string
+	if fetchOn {
+		switch cfg.Source.Type {
+		case "remote_base":
+			bins = append(bins, [2]string{"ssh", "ssh"})
+		case "remote_file":
+			bins = append(bins, [2]string{"ssh", "ssh"})
+			if !streaming {
+				bins = append(bins, [2]string{"scp", "scp"})
+			}
+		}
+	}
+	if fetchOn && cfg.Source.Type == "local_base" || importOn && cfg.Database.SnapshotKeep > 0 {
+		bins = append(bins, [2]string{"mysqldump", orDefault(cfg.Destination.PathToMysqldump, "mysqldump")})
+	}
+	if importOn {
+		bins = append(bins, [2]string{"mysql", mysqlBin(cfg)})
+	}
+	if rsyncOn {
+		bins = append(bins, [2]string{"ssh", "ssh"}, [2]string{"rsync", orDefault(cfg.Destination.PathToRsync, "rsync")})
+	} else if filesOn {
+		bins = append(bins, [2]string{"lftp", orDefault(cfg.Destination.PathToLftp, "lftp")})
+	}
+	if hooksEnabled(cfg, steps) {
+		bins = append(bins, [2]string{"bash", "bash"})
+	}
+	seen := map[string]bool{}
+	for _, b := range bins {
+		if !seen[b[0]] {
+			seen[b[0]] = true
+			report(checkLocalBin(b[0], b[1]))
+		}
+	}
+
+	// Remote tools and the source database size, in a single SSH round trip.
+	var tools []string
+	if fetchOn && cfg.Source.Type == "remote_base" {
+		tools = append(tools, orDefault(cfg.Source.PathToMysqldump, "mysqldump"))
+	}
+	if rsyncOn {
+		tools = append(tools, "rsync")
+	}
+	needSize := fetchOn && !streaming
+	remoteSize := needSize && cfg.Source.Type == "remote_base"
+	var dbSize int64
+	var sizeErr error
+	if len(tools) > 0 || remoteSize {
+		missing, size, err := remoteProbe(ctx, cfg, eventCh, tools, remoteSize)
+		target := cfg.Source.User + "@" + cfg.Source.Server
+		if err != nil {
+			report(Check{Name: "ssh " + target, Status: CheckFail, Detail: err.Error()})
+			sizeErr = err
+		} else {
+			for _, t := range tools {
+				report(remoteToolCheck(cfg, t, missing[t]))
+			}
+			dbSize, sizeErr = size, nil
+			if remoteSize && size < 0 {
+				sizeErr = fmt.Errorf("cannot read the size of %s from information_schema", cfg.Source.DBName)
+			}
+		}
+	}
+
+	if needSize {
+		switch cfg.Source.Type {
+		case "local_base":
+			dbSize, sizeErr = localDBSize(ctx, cfg)
+		case "local_file":
+			var fi os.FileInfo
+			if fi, sizeErr = os.Stat(cfg.Source.File); sizeErr == nil {
+				dbSize = fi.Size()
+			}
+		}
+		if cfg.Source.Type != "remote_file" {
+			report(checkDiskSpace(cfg, dbSize, sizeErr))
+		}
+	}
+
+	// Steps that read the dump without fetching it need the one an
+	// earlier run left in tmp/.
+	readsDump := steps&StepsOf(2, 4) != 0 || steps.Has(3) && len(hookScripts(cfg, "before")) > 0
+	if !fetchOn && readsDump {
+		report(checkDumpLeft(cfg))
+	}
+
+	if importOn {
+		report(checkLocalDB(ctx, cfg))
+	}
+	return checks
+}
+
+// checkDumpLeft looks for the dump of an earlier run in tmp/.
+func checkDumpLeft(cfg *config.Config) Check {
+	dumpPath := DumpFilePath(config.TmpDir(), filepath.Base(filepath.Dir(cfg.ConfigFilePath())))
+	for _, p := range []string{dumpPath, FetchFilePath(cfg, dumpPath)} {
+		if fi, err := os.Stat(p); err == nil {
+			return Check{Name: "dump", Status: CheckPass,
+				Detail: fmt.Sprintf("%s (%s, %s)", filepath.Base(p), humanSize(fi.Size()), fi.ModTime().Format("2006-01-02 15:04"))}
+		}
+	}
+	return Check{Name: "dump", Status: CheckFail, Detail: "no dump in " + config.TmpDir(),
+		Hint: "run step 1 to fetch one"}
+}
+
+// preflightPush checks what the selected steps of a push need: mysqldump
+// and the local database to dump, and mysql, gzip and rsync on the server.
+func preflightPush(ctx context.Context, cfg *config.Config, steps Steps, eventCh chan<- Event, report func(Check)) {
+	rsyncOn := steps.Has(6) && len(cfg.Sync) > 0 && cfg.Transport.Type != "lftp"
+	if steps.Has(1) {
+		c := checkLocalBin("mysqldump", orDefault(cfg.Destination.PathToMysqldump, "mysqldump"))
+		if c.Status == CheckFail {
+			// A push dumps the local database with the local mysqldump.
+			c.Hint = "install mysqldump or set destination.path_to_mysqldump"
+		}
+		report(c)
+	}
+	if steps.Has(4) || rsyncOn {
+		report(checkLocalBin("ssh", "ssh"))
+	}
+	if rsyncOn {
+		report(checkLocalBin("rsync", orDefault(cfg.Destination.PathToRsync, "rsync")))
+	}
+
+	var tools []string
+	if steps.Has(4) {
+		tools = append(tools, remoteMySQLBin(cfg))
+		if cfg.Source.Compress {
+			tools = append(tools, "gzip")
+		}
+	}
+	if rsyncOn {
+		tools = append(tools, "rsync")
+	}
+	if len(tools) > 0 {
+		missing, _, err := remoteProbe(ctx, cfg, eventCh, tools, false)
+		if err != nil {
+			report(Check{Name: "ssh " + cfg.Source.User + "@" + cfg.Source.Server, Status: CheckFail, Detail: err.Error()})
+		} else {
+			for _, t := range tools {
+				report(remoteToolCheck(cfg, t, missing[t]))
+			}
+		}
+	}
+	if !steps.Has(1) && steps&StepsOf(2, 4) != 0 {
+		report(checkDumpLeft(cfg))
+	}
+	if steps.Has(1) {
+		report(checkLocalDB(ctx, cfg))
+	}
+}
+
+func remoteToolCheck(cfg *config.Config, tool string, missing bool) Check {
+	c := Check{Name: "remote " + path.Base(tool), Status: CheckPass, Detail: "found on " + cfg.Source.Server}
+	if missing {
+		c.Status, c.Detail = CheckFail, "not found on "+cfg.Source.Server
+		c.Hint = "install " + path.Base(tool) + " on the server"
+		switch path.Base(tool) {
+		case "mysqldump":
+			c.Hint += " or set source.path_to_mysqldump"
+		case "mysql":
+			c.Hint += " or set source.path_to_mysqldump to the mysqldump in its directory"
+		}
+	}
+	return c
+}
+
+// hooksEnabled reports whether any hook script would run in steps.
+func hooksEnabled(cfg *config.Config, steps Steps) bool {
+	for step, phase := range map[int]string{3: "before", 5: "between", 7: "after"} {
+		if steps.Has(step) && len(hookScripts(cfg, phase)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func checkLocalBin(name, bin string) Check {
+	p, err := exec.LookPath(bin)
+	if err != nil {
+		return Check{Name: name, Status: CheckFail, Detail: bin + " not found",
+			Hint: "install " + name + " or set its path_to_* option in the config"}
+	}
+	return Check{Name: name, Status: CheckPass, Detail: p}
+}
+
+// remoteProbe looks for tools on the source server and, when withSize is
+// set, reads the source database size. missing holds the tools that are
+// not on the remote PATH; size is -1 when the query failed.
+func remoteProbe(ctx context.Context, cfg *config.Config, eventCh chan<- Event, tools []string, withSize bool) (missing map[string]bool, size int64, err error) {
+	var parts []string
+	for _, t := range tools {
+		parts = append(parts, fmt.Sprintf("command -v %s >/dev/null 2>&1 || echo %s", shellQuote(t), shellQuote("missing:"+t)))
+	}
+	if withSize {
+		query := append(append([]string{remoteMySQLBin(cfg), "-N", "-B"}, srcConnArgs(cfg)...), "-e", dbSizeQuery(cfg))
+		parts = append(parts, "echo size:$("+shellJoin(query)+" 2>/dev/null)")
+	}
+	remoteCmd := strings.Join(parts, "; ")
+
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	target := cfg.Source.User + "@" + cfg.Source.Server
+	var out string
+	err = runSSHCommandWithPasswordPrompt(ctx, eventCh, 0, target, func(string) {}, func(extraEnv []string, batchMode bool) error {
+		cmd := exec.CommandContext(ctx, "ssh", append(sshArgs(cfg.Source.Port, batchMode), target, remoteCmd)...)
+		cmd.Env = commandEnv(extraEnv)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("%w: %s", err, msg)
+			}
+			return err
+		}
+		out = stdout.String()
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	missing = map[string]bool{}
+	size = -1
+	for _, line := range strings.Split(out, "\n") {
+		if t, ok := strings.CutPrefix(line, "missing:"); ok {
+			missing[t] = true
+		} else if v, ok := strings.CutPrefix(line, "size:"); ok {
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				size = n
+			}
+		}
+	}
+	return missing, size, nil
+}
+
+// remoteMySQLBin returns the mysql client next to the configured remote
+// mysqldump.
+func remoteMySQLBin(cfg *config.Config) string {
+	if p := cfg.Source.PathToMysqldump; strings.Contains(p, "/") {
+		return path.Join(path.Dir(p), "mysql")
+	}
+	return "mysql"
+}
+
+// dbSizeQuery sums the data of the dumped source tables. Indexes are left
+// out since a dump only holds their definitions.
+func dbSizeQuery(cfg *config.Config) string {
+	q := fmt.Sprintf("SELECT COALESCE(SUM(data_length),0) FROM information_schema.tables WHERE table_schema = %s", sqlQuote(cfg.Source.DBName))
+	if len(cfg.Database.IgnoreTables) > 0 {
+		names := make([]string, len(cfg.Database.IgnoreTables))
+		for i, t := range cfg.Database.IgnoreTables {
+			names[i] = sqlQuote(t)
+		}
+		q += " AND table_name NOT IN (" + strings.Join(names, ",") + ")"
+	}
+	return q
+}
+
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", "''") + "'"
+}
+
+func localDBSize(ctx context.Context, cfg *config.Config) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	args := append(append([]string{"-N", "-B"}, srcConnArgs(cfg)...), "-e", dbSizeQuery(cfg))
+	out, err := exec.CommandContext(ctx, mysqlBin(cfg), args...).Output()
+	if err != nil {
+		return 0, fmt.Errorf("read size of %s: %w", cfg.Source.DBName, err)
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+}
+
+// gzipRatio is how much smaller a gzipped SQL dump is assumed to be than
+// the plain one. Dumps usually compress better, so the estimate errs on the
+// side of more room.
+const gzipRatio = 3
+
+// checkDiskSpace compares the free space in tmp/ with the dump size, which
+// is the size of the source file for a *_file source. A gzip fetch stays
+// until step 2 has expanded it, and find / replace writes a second copy of
+// the dump before replacing the first, so all of them must fit at once.
+func checkDiskSpace(cfg *config.Config, dbSize int64, sizeErr error) Check {
+	c := Check{Name: "tmp disk space"}
+	free, err := diskFree(config.TmpDir())
+	if err != nil {
+		c.Status, c.Detail = CheckWarn, err.Error()
+		return c
+	}
+	if sizeErr != nil {
+		c.Status, c.Detail = CheckWarn, fmt.Sprintf("%s free; dump size unknown: %v", humanSize(free), sizeErr)
+		return c
+	}
+	plain, fetch := dbSize, int64(0)
+	if dumpCompressed(cfg) {
+		if cfg.Source.Type == "local_file" {
+			fetch, plain = dbSize, dbSize*gzipRatio
+		} else {
+			fetch = dbSize / gzipRatio
+		}
+	}
+	need := fetch + plain
+	if len(cfg.Replace) > 0 {
+		need += plain
+	}
+	c.Detail = fmt.Sprintf("%s free, dump needs about %s", humanSize(free), humanSize(need))
+	if free < need {
+		c.Status = CheckFail
+		c.Hint = "free up space in " + config.TmpDir() + " or set database.stream = true"
+	}
+	return c
+}
+
+func diskFree(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", dir, err)
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// checkLocalDB connects to the destination server without selecting the
+// database, which may not exist before the first sync.
+func checkLocalDB(ctx context.Context, cfg *config.Config) Check {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	c := Check{Name: "local database"}
+	args := append([]string{"--connect-timeout=5"}, destConnArgs(cfg)...)
+	args = append(args, "-e", "SELECT 1")
+	out, err := exec.CommandContext(ctx, mysqlBin(cfg), args...).CombinedOutput()
+	if err != nil {
+		// The last line holds the error, after any password warning.
+		c.Status, c.Detail = CheckFail, err.Error()
+		c.Hint = "check the [destination] db_* settings and that the MySQL server is running"
+		if lines := strings.Split(strings.TrimSpace(string(out)), "\n"); lines[len(lines)-1] != "" {
+			c.Detail = lines[len(lines)-1]
+		}
+		return c
+	}
+	c.Detail = fmt.Sprintf("connected to %s@%s", cfg.Destination.DBUser, cfg.Destination.DBHostname)
+	return c
+}
+
+// PrintChecks writes one line per check, followed by its hint when it did
+// not pass.
+func PrintChecks(w io.Writer, checks []Check) {
+	for _, c := range checks {
+		fmt.Fprintf(w, "  %s %-16s %s\n", checkIcon(c.Status), c.Name, c.Detail)
+		if c.Hint != "" && c.Status != CheckPass {
+			fmt.Fprintf(w, "    → %s\n", c.Hint)
+		}
+	}
+}
+
+// checkIcon returns the checklist mark of a check result.
+func checkIcon(s CheckStatus) string {
+	switch s {
+	case CheckPass:
+		return "✔"
+	case CheckWarn:
+		return "⚠"
+	default:
+		return "✘"
+	}
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+func TestPreflight(t *testing.T) {
+	etc := t.TempDir()
+	t.Setenv("SITESYNC_ETC", etc)
+	if err := os.MkdirAll(config.TmpDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	dump := filepath.Join(etc, "dump.sql")
+	if err := os.WriteFile(dump, []byte("SELECT 1;\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mysql := filepath.Join(t.TempDir(), "mysql")
+	if err := os.WriteFile(mysql, []byte("#!/bin/sh\necho 1\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Source: config.SourceConfig{Type: "local_file", File: dump},
+		Destination: config.DestConfig{
+			DBHostname:  "localhost",
+			DBName:      "local",
+			PathToMySQL: mysql,
+			PathToLftp:  "sitesync-no-such-lftp",
+		},
+		Sync: []config.SyncPair{{Src: "/srv/site", Dst: "/var/www/site"}},
+	}
+	eventCh := make(chan Event, 64)
+
+	got := map[string]CheckStatus{}
+	for _, c := range Preflight(context.Background(), cfg, OpSQL, OpSQL.Steps(), false, eventCh) {
+		got[c.Name] = c.Status
+	}
+	want := map[string]CheckStatus{"mysql": CheckPass, "tmp disk space": CheckPass, "local database": CheckPass}
+	if len(got) != len(want) {
+		t.Fatalf("OpSQL checks = %v, want %v", got, want)
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Fatalf("OpSQL check %q = %v, want %v (all: %v)", name, got[name], status, got)
+		}
+	}
+
+	// Importing without fetching needs the dump of an earlier run.
+	got = map[string]CheckStatus{}
+	for _, c := range Preflight(context.Background(), cfg, OpSQL, StepsOf(4), false, eventCh) {
+		got[c.Name] = c.Status
+	}
+	if len(got) != 3 || got["mysql"] != CheckPass || got["dump"] != CheckFail || got["local database"] != CheckPass {
+		t.Fatalf("step 4 checks = %v, want mysql, a failed dump and local database", got)
+	}
+
+	cfg.Transport.Type = "lftp"
+	checks := Preflight(context.Background(), cfg, OpFiles, OpFiles.Steps(), false, eventCh)
+	if len(checks) != 1 || checks[0].Name != "lftp" || checks[0].Status != CheckFail {
+		t.Fatalf("OpFiles checks = %+v, want a single failed lftp check", checks)
+	}
+}
+
+func TestDBSizeQueryQuotesNames(t *testing.T) {
+	cfg := &config.Config{
+		Source:   config.SourceConfig{DBName: "it's"},
+		Database: config.DatabaseConfig{IgnoreTables: []string{"cache", `a\b`}},
+	}
+	want := `SELECT COALESCE(SUM(data_length),0) FROM information_schema.tables WHERE table_schema = 'it''s' AND table_name NOT IN ('cache','a\\b')`
+	if got := dbSizeQuery(cfg); got != want {
+		t.Fatalf("dbSizeQuery() = %s, want %s", got, want)
+	}
+}
+
+func TestCheckDiskSpaceCountsCompressedFetch(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	if err := os.MkdirAll(config.TmpDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		src  config.SourceConfig
+		pair bool
+		want int64
+	}{
+		{"plain", config.SourceConfig{Type: "remote_base"}, true, 6 << 20},
+		// The fetch, the expanded dump and its replaced copy.
+		{"remote gzip", config.SourceConfig{Type: "remote_base", Compress: true}, true, 7 << 20},
+		// The size is the one of the .gz file, which expands to more.
+		{"local .gz file", config.SourceConfig{Type: "local_file", File: "/srv/site.sql.gz"}, false, 12 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Source: tt.src}
+			if tt.pair {
+				cfg.Replace = []config.ReplacePair{{Search: "a", Replace: "b"}}
+			}
+			c := checkDiskSpace(cfg, 3<<20, nil)
+			if want := "dump needs about " + humanSize(tt.want); !strings.HasSuffix(c.Detail, want) {
+				t.Fatalf("detail = %q, want it to end with %q", c.Detail, want)
+			}
+		})
+	}
+}
+
+func TestPreflightPushPointsAtLocalMysqldump(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	mysql := filepath.Join(t.TempDir(), "mysql")
+	if err := os.WriteFile(mysql, []byte("#!/bin/sh\necho 1\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Destination: config.DestConfig{DBHostname: "localhost", DBName: "local", PathToMySQL: mysql, PathToMysqldump: "sitesync-no-such-mysqldump"},
+	}
+	for _, c := range Preflight(context.Background(), cfg, OpPush, StepsOf(1), false, make(chan Event, 64)) {
+		if c.Name == "mysqldump" {
+			if c.Status != CheckFail || !strings.Contains(c.Hint, "destination.path_to_mysqldump") {
+				t.Fatalf("mysqldump check = %+v, want a failure pointing at destination.path_to_mysqldump", c)
+			}
+			return
+		}
+	}
+	t.Fatal("push did not check mysqldump")
+}
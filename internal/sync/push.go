@@ -0,0 +1,220 @@
+package sync
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// A push runs the sync backwards: the local database is dumped, the replace
+// pairs are applied from replace back to search, the dump is imported into
+// the source database over SSH and the [[sync]] pairs are rsynced from dst
+// to src. Hooks are written for the pull direction and are not run.
+
+// checkPush returns why cfg cannot be pushed, or nil.
+func checkPush(cfg *config.Config) error {
+	name := filepath.Base(filepath.Dir(cfg.ConfigFilePath()))
+	switch {
+	case !cfg.Safety.AllowPush:
+		return fmt.Errorf("push is disabled for %s (set allow_push = true in [safety])", name)
+	case cfg.Source.Type != "remote_base":
+		return fmt.Errorf("push needs source.type = \"remote_base\", not %q", cfg.Source.Type)
+	case cfg.Source.DBName == "":
+		return fmt.Errorf("push needs source.db_name")
+	}
+	return nil
+}
+
+// confirmPush asks the consumer to type the name of the remote database
+// that the push overwrites. Cancellation counts as a refusal.
+func confirmPush(ctx context.Context, cfg *config.Config, eventCh chan<- Event) bool {
+	src := cfg.Source
+	lines := []string{fmt.Sprintf("  database %s on %s@%s is replaced by %s",
+		src.DBName, src.DBUser, orDefault(src.DBHostname, "localhost"), cfg.Destination.DBName)}
+	for _, sp := range cfg.Sync {
+		lines = append(lines, fmt.Sprintf("  files in %s:%s are updated from %s", src.Server, sp.Src, sp.Dst))
+	}
+	replyCh := make(chan bool, 1)
+	sendEvent(ctx, eventCh, Event{Type: EvConfirm, ConfirmCh: replyCh, Expect: src.DBName,
+		Message: fmt.Sprintf("Push overwrites the REMOTE site on %s:\n%s\nType %s to confirm.",
+			src.Server, strings.Join(lines, "\n"), src.DBName)})
+	select {
+	case ok := <-replyCh:
+		return ok
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// reversePairs swaps search and replace of every pair and reverses their
+// order, since the pull applies them one after another: a pair that
+// rewrote the output of an earlier one must be undone first. Regex pairs
+// cannot be reversed and are returned apart so they can be reported.
+func reversePairs(pairs []config.ReplacePair) (rev, skipped []config.ReplacePair) {
+	for _, p := range slices.Backward(pairs) {
+		if p.Regex {
+			skipped = append(skipped, p)
+			continue
+		}
+		p.Search, p.Replace = p.Replace, p.Search
+		rev = append(rev, p)
+	}
+	return rev, skipped
+}
+
+// buildPushDumpArgs returns the mysqldump arguments for the local database,
+// with the same options and ignored tables as the source dump.
+func buildPushDumpArgs(cfg *config.Config) ([]string, error) {
+	var args []string
+	for _, opt := range []struct{ key, raw string }{
+		{"sql_options_structure", cfg.Database.SQLOptionsStructure},
+		{"sql_options_extra", cfg.Database.SQLOptionsExtra},
+	} {
+		var err error
+		if args, err = appendSplitArgs(args, opt.raw); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", opt.key, err)
+		}
+	}
+	args = append(args, destConnArgs(cfg)...)
+	for _, tbl := range cfg.Database.IgnoreTables {
+		args = append(args, fmt.Sprintf("--ignore-table=%s.%s", cfg.Destination.DBName, tbl))
+	}
+	return append(args, cfg.Destination.DBName), nil
+}
+
+// buildRemoteImportCommand returns the shell command that imports the dump
+// read from stdin into the source database, plus a log-safe version.
+func buildRemoteImportCommand(cfg *config.Config) (remoteCmd, logCmd string, err error) {
+	bin, args, err := niceCommand(cfg.Source.RemoteNice, remoteMySQLBin(cfg), append(srcConnArgs(cfg), cfg.Source.DBName))
+	if err != nil {
+		return "", "", fmt.Errorf("parse remote_nice: %w", err)
+	}
+	remoteCmd = shellJoin(append([]string{bin}, args...))
+	logCmd = bin + " " + redactArgs(args)
+	if cfg.Source.Compress {
+		remoteCmd = "(set -o pipefail) 2>/dev/null && set -o pipefail; gzip -dc | " + remoteCmd
+		logCmd = "gzip -dc | " + logCmd
+	}
+	return remoteCmd, logCmd, nil
+}
+
+// DumpLocalDB implements step 1 of a push: dump the local database.
+func DumpLocalDB(ctx context.Context, cfg *config.Config, dumpPath string, eventCh chan<- Event, step int) error {
+	sendLog := func(msg string) {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: msg})
+	}
+	args, err := buildPushDumpArgs(cfg)
+	if err != nil {
+		return err
+	}
+	sendLog(fmt.Sprintf("  source: local database %s", cfg.Destination.DBName))
+	if err := runDump(ctx, cfg, args, dumpPath, false, sendLog); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(dumpPath); err == nil {
+		sendLog(fmt.Sprintf("  dump: %s (%s)", filepath.Base(dumpPath), humanSize(fi.Size())))
+	}
+	return nil
+}
+
+// ReverseReplace implements step 2 of a push: apply the replace pairs from
+// replace back to search.
+func ReverseReplace(ctx context.Context, cfg *config.Config, dumpPath string, eventCh chan<- Event, step int) error {
+	sendLog := func(msg string) {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: msg})
+	}
+	pairs, skipped := reversePairs(cfg.Replace)
+	for _, p := range skipped {
+		sendLog(fmt.Sprintf("  ⚠ regex pair %q cannot be reversed, skipped", p.Search))
+	}
+	if len(pairs) == 0 {
+		sendLog("  no replace pairs")
+		return nil
+	}
+	for i, pair := range pairs {
+		sendLog("  " + describePair(i, len(pairs), pair))
+	}
+	replacer, err := NewMultiReplacer(pairs)
+	if err != nil {
+		return err
+	}
+	var size int64
+	if fi, err := os.Stat(dumpPath); err == nil {
+		size = fi.Size()
+	}
+	err = rewriteFile(dumpPath, func(r io.Reader, w io.Writer) error {
+		if size > 0 {
+			r = &progressReader{r: r, total: size, eventCh: eventCh, step: step, ctx: ctx}
+		}
+		return replacer.ReplaceStreamParallel(r, w, replaceWorkers(cfg))
+	})
+	if err != nil {
+		return err
+	}
+	reportReplaceStats(ctx, eventCh, step, pairs, replacer)
+	return nil
+}
+
+// ImportRemote implements step 4 of a push: pipe the dump over SSH into
+// mysql on the server, gzip-compressed when source.compress is set.
+func ImportRemote(ctx context.Context, cfg *config.Config, dumpPath string, eventCh chan<- Event, step int) error {
+	sendLog := func(msg string) {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: msg})
+	}
+	remoteCmd, logCmd, err := buildRemoteImportCommand(cfg)
+	if err != nil {
+		return err
+	}
+	target := cfg.Source.User + "@" + cfg.Source.Server
+	sendLog(fmt.Sprintf("  target: %s@%s → %s on %s", cfg.Source.DBUser, cfg.Source.DBHostname, cfg.Source.DBName, cfg.Source.Server))
+
+	return runSSHCommandWithPasswordPrompt(ctx, eventCh, step, target, sendLog, func(extraEnv []string, batchMode bool) error {
+		f, err := os.Open(dumpPath)
+		if err != nil {
+			return fmt.Errorf("open dump file: %w", err)
+		}
+		defer f.Close()
+		var r io.Reader = f
+		if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+			r = &progressReader{r: f, total: fi.Size(), eventCh: eventCh, step: step, ctx: ctx}
+		}
+		if cfg.Source.Compress {
+			pr := gzipReader(r)
+			// Unblocks the compressor when ssh exits without reading it all.
+			defer pr.Close()
+			r = pr
+		}
+
+		cmdArgs := append(sshArgs(cfg.Source.Port, batchMode), target, remoteCmd)
+		sendLog(fmt.Sprintf("  $ ssh %s %s %s < %s", strings.Join(cmdArgs[:len(cmdArgs)-2], " "), target, logCmd, filepath.Base(dumpPath)))
+		cmd := exec.CommandContext(ctx, "ssh", cmdArgs...)
+		cmd.Env = commandEnv(extraEnv)
+		cmd.Stdin = r
+		if err := streamCmd(ctx, eventCh, step, cmd, false); err != nil {
+			return fmt.Errorf("remote import into %s: %w", cfg.Source.DBName, err)
+		}
+		return nil
+	})
+}
+
+// gzipReader returns a reader yielding r gzip-compressed.
+func gzipReader(r io.Reader) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, r)
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
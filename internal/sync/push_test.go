@@ -0,0 +1,178 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+	"github.com/carlosrgl/sitesync/internal/logger"
+)
+
+func TestReversePairs(t *testing.T) {
+	pairs := []config.ReplacePair{
+		{Search: "https://shop.com", Replace: "http://shop.test", Tables: []string{"wp_posts"}},
+		{Search: `https?://cdn\.shop\.com`, Replace: "http://shop.test/cdn", Regex: true},
+	}
+	rev, skipped := reversePairs(pairs)
+	if len(rev) != 1 || rev[0].Search != "http://shop.test" || rev[0].Replace != "https://shop.com" || rev[0].Tables[0] != "wp_posts" {
+		t.Fatalf("reversed = %+v", rev)
+	}
+	if len(skipped) != 1 || !skipped[0].Regex {
+		t.Fatalf("skipped = %+v, want the regex pair", skipped)
+	}
+	if pairs[0].Search != "https://shop.com" {
+		t.Fatal("reversePairs modified its input")
+	}
+
+	// The second pull pair rewrites the output of the first one, so the
+	// push must undo it first.
+	chained := []config.ReplacePair{
+		{Search: "https://prod.com", Replace: "http://prod.test"},
+		{Search: "http://prod.test/cdn", Replace: "http://cdn.test"},
+	}
+	rev, _ = reversePairs(chained)
+	if len(rev) != 2 || rev[0].Search != "http://cdn.test" || rev[1].Search != "http://prod.test" {
+		t.Fatalf("reversed chained pairs = %+v", rev)
+	}
+	m, err := NewMultiReplacer(rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.ReplaceLine("'http://cdn.test/a.jpg','http://prod.test/'"); got != "'https://prod.com/cdn/a.jpg','https://prod.com/'" {
+		t.Fatalf("pushed line = %q", got)
+	}
+}
+
+func TestPushCommands(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Source.User, cfg.Source.Server = "deploy", "shop.com"
+	cfg.Source.DBUser, cfg.Source.DBPassword, cfg.Source.DBName = "shop", "s3cret", "shop_staging"
+	cfg.Destination.DBUser, cfg.Destination.DBName = "root", "shop_local"
+	cfg.Database.IgnoreTables = []string{"sessions"}
+
+	remoteCmd, logCmd, err := buildRemoteImportCommand(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(remoteCmd, "gzip -dc | 'mysql'") || !strings.Contains(remoteCmd, "'-ps3cret'") {
+		t.Fatalf("remoteCmd = %s", remoteCmd)
+	}
+	if strings.Contains(logCmd, "s3cret") || !strings.HasSuffix(logCmd, "-u shop -p[REDACTED] shop_staging") {
+		t.Fatalf("logCmd = %s", logCmd)
+	}
+
+	args, err := buildPushDumpArgs(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args, " "); got != "--default-character-set=utf8 -h localhost -u root --ignore-table=shop_local.sessions shop_local" {
+		t.Fatalf("dump args = %s", got)
+	}
+
+	args, err = buildRsyncArgs(&cfg, config.SyncPair{Src: "/srv/shop/uploads", Dst: "/var/www/shop/uploads"}, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args[len(args)-2:], " "); got != "/var/www/shop/uploads/ deploy@shop.com:/srv/shop/uploads/" {
+		t.Fatalf("push rsync src/dst = %s", got)
+	}
+	if !slices.Contains(args, "--info=progress2,stats1") {
+		t.Fatalf("rsync args lack the stats the history counts: %v", args)
+	}
+}
+
+func TestRunRefusesPushWithoutAllowPush(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	cfg := config.DefaultConfig()
+	cfg.Source.DBName = "shop_staging"
+
+	eventCh := make(chan Event, 64)
+	go Run(context.Background(), &cfg, OpPush, Options{}, eventCh, logger.Discard())
+	for ev := range eventCh {
+		if ev.Type == EvConfirm {
+			t.Fatal("asked for confirmation although allow_push is off")
+		}
+		if ev.Type == EvStepFail {
+			if !strings.Contains(ev.Message, "allow_push") {
+				t.Fatalf("failure = %q, want a hint about allow_push", ev.Message)
+			}
+			return
+		}
+	}
+	t.Fatal("push ran without allow_push")
+}
+
+func TestResumePushAfterStep1WithCompress(t *testing.T) {
+	etc := t.TempDir()
+	t.Setenv("SITESYNC_ETC", etc)
+	dir := filepath.Join(etc, "shop")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	mysqldump := filepath.Join(dir, "mysqldump")
+	if err := os.WriteFile(mysqldump, []byte("#!/bin/sh\necho \"INSERT INTO t VALUES ('shop.test');\"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	conf := fmt.Sprintf("[source]\ntype = \"remote_base\"\ncompress = true\nserver = \"shop.com\"\ndb_name = \"shop_staging\"\n\n"+
+		"[destination]\ndb_name = \"shop_local\"\npath_to_mysqldump = %q\n\n[database]\nsql_options_extra = \"--complete-insert\"\n\n"+
+		"[safety]\nallow_push = true\n\n[[replace]]\nsearch = \"shop.com\"\nreplace = \"shop.test\"\ntables = [\"t.c\"]\n", mysqldump)
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A .gz left by an earlier pull is not the dump of the push.
+	tmpDir := config.TmpDir()
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(DumpFilePath(tmpDir, "shop")+".gz", []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// run answers every confirmation, ignores the preflight and quits on
+	// the failure of step 2: the dump has no column names for the
+	// column-scoped pair. It returns the log lines.
+	run := func(opts Options) []string {
+		eventCh := make(chan Event, 64)
+		go Run(context.Background(), cfg, OpPush, opts, eventCh, logger.Discard())
+		var lines []string
+		for ev := range eventCh {
+			switch {
+			case ev.ConfirmCh != nil:
+				ev.ConfirmCh <- true
+			case ev.ReplyCh != nil && strings.HasPrefix(ev.Message, "preflight failed"):
+				// There is no database or server to reach.
+				ev.ReplyCh <- ActionContinue
+			case ev.ReplyCh != nil && ev.Step == 2:
+				ev.ReplyCh <- ActionQuit
+			case ev.Type == EvStepFail:
+				t.Fatalf("step %d failed: %s", ev.Step, ev.Message)
+			}
+			lines = append(lines, ev.Message)
+		}
+		return lines
+	}
+
+	steps := StepsOf(1, 2)
+	run(Options{Steps: steps})
+	rs, err := loadRunState(RunStatePath(tmpDir, "shop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.DumpPath != DumpFilePath(tmpDir, "shop") || rs.DumpSHA256 == "" {
+		t.Fatalf("run state after step 1 = %+v, want the sealed plain dump", rs)
+	}
+
+	lines := strings.Join(run(Options{Steps: steps, Resume: true}), "\n")
+	if !strings.Contains(lines, "resume: from step 2") {
+		t.Fatalf("push was not resumed:\n%s", lines)
+	}
+}
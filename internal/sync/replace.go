@@ -1,7 +1,6 @@
 package sync
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"os"
@@ -9,6 +8,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/carlosrgl/sitesync/internal/config"
 )
 
 // ReplaceOptions controls the behaviour of the replace engine.
@@ -17,11 +18,27 @@ type ReplaceOptions struct {
 	Regex bool
 	// OnlyIntoSerialized skips replacement in plain (non-serialized) text.
 	OnlyIntoSerialized bool
-	// compiledRe is set internally by ResilientReplaceStream to avoid
+	// IgnoreCase matches Search case-insensitively. A literal Search is then
+	// matched through the regex engine with its replacement kept literal.
+	IgnoreCase bool
+	// dumpEscaped marks a search/replace pair written with mysqldump
+	// backslash escaping, so s:N: byte counts must count \\ as one byte.
+	dumpEscaped bool
+	// compiledRe is set internally by compileReplaceOptions to avoid
 	// recompiling the same regex pattern on every line of the input.
 	compiledRe *regexp.Regexp
 }
 
+// ReplaceStats counts what a search/replace pair changed.
+type ReplaceStats struct {
+	Plain      int64 `json:"plain"`      // occurrences replaced in plain text
+	Serialized int64 `json:"serialized"` // occurrences replaced inside PHP serialized strings
+	Lines      int64 `json:"lines"`      // lines changed by the pair
+}
+
+// Matches returns the total number of occurrences replaced.
+func (s ReplaceStats) Matches() int64 { return s.Plain + s.Serialized }
+
 // phpSerialPattern matches PHP serialized strings: s:N:"content";
 // Capture group 1 = byte-length integer N
 // Capture group 2 = string content (no unescaped double-quotes inside)
@@ -38,15 +55,103 @@ var phpSerialPatternEsc = regexp.MustCompile(`s:(\d+):\\"((?:[^"\\]|\\.)*?)\\";`
 // only counts the first occurrence of the search string when computing the
 // new byte length. This implementation counts all occurrences.
 func ResilientReplaceLine(search, replace, line string, opts ReplaceOptions) string {
+	return replaceLine(search, replace, line, opts, nil)
+}
+
+// replaceLine is ResilientReplaceLine that also adds the plain and
+// serialized occurrence counts to st when st is non-nil.
+func replaceLine(search, replace, line string, opts ReplaceOptions, st *ReplaceStats) string {
+	if opts.usesRegex() {
+		return resilientReplaceRegex(searchPattern(search, opts), regexReplacement(replace, opts), line, opts, st)
+	}
+	return resilientReplaceLiteral(search, replace, line, opts, st)
+}
+
+// replaceOptionsFor returns the ReplaceOptions configured on a pair.
+func replaceOptionsFor(p config.ReplacePair) ReplaceOptions {
+	return ReplaceOptions{
+		Regex:              p.Regex,
+		IgnoreCase:         p.IgnoreCase,
+		OnlyIntoSerialized: p.OnlySerialized,
+	}
+}
+
+// describePair formats pair i of n for the step log, e.g.
+// [1/2] "a" → "b" (regex, ignore case).
+func describePair(i, n int, pair config.ReplacePair) string {
+	s := fmt.Sprintf("[%d/%d] %q → %q", i+1, n, pair.Search, pair.Replace)
+	var flags []string
+	if pair.Regex {
+		flags = append(flags, "regex")
+	}
+	if pair.IgnoreCase {
+		flags = append(flags, "ignore case")
+	}
+	if pair.OnlySerialized {
+		flags = append(flags, "serialized only")
+	}
+	if pair.SkipEncoded {
+		flags = append(flags, "no encoded forms")
+	}
+	if len(pair.Tables) > 0 {
+		flags = append(flags, "only "+strings.Join(pair.Tables, ", "))
+	}
+	if len(pair.ExcludeTables) > 0 {
+		flags = append(flags, "except "+strings.Join(pair.ExcludeTables, ", "))
+	}
+	if len(flags) > 0 {
+		s += " (" + strings.Join(flags, ", ") + ")"
+	}
+	return s
+}
+
+// usesRegex reports whether the pair must go through the regex engine.
+func (o ReplaceOptions) usesRegex() bool {
+	return o.Regex || o.IgnoreCase
+}
+
+// searchPattern returns the regular expression matching search under opts.
+func searchPattern(search string, opts ReplaceOptions) string {
+	pattern := search
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(search)
+	}
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return pattern
+}
+
+// regexReplacement escapes $ in the replacement of a literal pair so that
+// it is not expanded as a group reference by the regex engine.
+func regexReplacement(replace string, opts ReplaceOptions) string {
 	if opts.Regex {
-		return resilientReplaceRegex(search, replace, line, opts)
+		return replace
+	}
+	return strings.ReplaceAll(replace, "$", "$$")
+}
+
+// compileReplaceOptions compiles the regex for search once so the per-line
+// functions do not recompile it on every call.
+func compileReplaceOptions(search string, opts ReplaceOptions) (ReplaceOptions, error) {
+	if !opts.usesRegex() || opts.compiledRe != nil {
+		return opts, nil
 	}
-	return resilientReplaceLiteral(search, replace, line, opts)
+	re, err := regexp.Compile(searchPattern(search, opts))
+	if err != nil {
+		return opts, fmt.Errorf("invalid regex %q: %w", search, err)
+	}
+	opts.compiledRe = re
+	return opts, nil
 }
 
-func resilientReplaceLiteral(search, replace, line string, opts ReplaceOptions) string {
+func resilientReplaceLiteral(search, replace, line string, opts ReplaceOptions, st *ReplaceStats) string {
 	searchLen := len([]byte(search))
 	replaceLen := len([]byte(replace))
+	if opts.dumpEscaped {
+		searchLen -= strings.Count(search, `\\`)
+		replaceLen -= strings.Count(replace, `\\`)
+	}
 	delta := replaceLen - searchLen
 
 	// First pass: fix serialized strings, adjusting s:N: byte counts.
@@ -62,6 +167,9 @@ func resilientReplaceLiteral(search, replace, line string, opts ReplaceOptions)
 			if count == 0 {
 				return match
 			}
+			if st != nil {
+				st.Serialized += int64(count)
+			}
 			newInner := strings.ReplaceAll(inner, search, replace)
 			newN := origN + count*delta
 			return wrap(newN, newInner)
@@ -81,12 +189,15 @@ func resilientReplaceLiteral(search, replace, line string, opts ReplaceOptions)
 
 	// Second pass: replace in plain text (unless suppressed).
 	if !opts.OnlyIntoSerialized {
+		if st != nil {
+			st.Plain += int64(strings.Count(result, search))
+		}
 		result = strings.ReplaceAll(result, search, replace)
 	}
 	return result
 }
 
-func resilientReplaceRegex(search, replace, line string, opts ReplaceOptions) string {
+func resilientReplaceRegex(search, replace, line string, opts ReplaceOptions, st *ReplaceStats) string {
 	re := opts.compiledRe
 	if re == nil {
 		re = regexp.MustCompile(search)
@@ -104,6 +215,9 @@ func resilientReplaceRegex(search, replace, line string, opts ReplaceOptions) st
 			if newInner == inner {
 				return match
 			}
+			if st != nil {
+				st.Serialized += int64(len(re.FindAllStringIndex(inner, -1)))
+			}
 			newN := origN + len([]byte(newInner)) - len([]byte(inner))
 			return wrap(newN, newInner)
 		}
@@ -121,6 +235,9 @@ func resilientReplaceRegex(search, replace, line string, opts ReplaceOptions) st
 	)
 
 	if !opts.OnlyIntoSerialized {
+		if st != nil {
+			st.Plain += int64(len(re.FindAllStringIndex(result, -1)))
+		}
 		result = re.ReplaceAllString(result, replace)
 	}
 	return result
@@ -128,34 +245,37 @@ func resilientReplaceRegex(search, replace, line string, opts ReplaceOptions) st
 
 // ResilientReplaceStream applies search/replace to every line read from r,
 // writing results to w. This is used for streaming (e.g. SQL dump pipeline).
-func ResilientReplaceStream(search, replace string, r io.Reader, w io.Writer, opts ReplaceOptions) error {
-	// Compile the regex once here so resilientReplaceRegex doesn't re-compile
-	// it on every line (which would be O(n_lines) compilations over a large dump).
-	if opts.Regex && opts.compiledRe == nil {
-		re, err := regexp.Compile(search)
-		if err != nil {
-			return fmt.Errorf("invalid regex %q: %w", search, err)
-		}
-		opts.compiledRe = re
-	}
-	sc := bufio.NewScanner(r)
-	sc.Buffer(make([]byte, 4*1024*1024), 4*1024*1024)
-	bw := bufio.NewWriter(w)
-	for sc.Scan() {
-		line := ResilientReplaceLine(search, replace, sc.Text(), opts)
-		if _, err := fmt.Fprintln(bw, line); err != nil {
-			return err
-		}
-	}
-	if err := sc.Err(); err != nil {
-		return err
+// It returns how many occurrences were replaced and on how many lines.
+func ResilientReplaceStream(search, replace string, r io.Reader, w io.Writer, opts ReplaceOptions) (ReplaceStats, error) {
+	// A MultiReplacer with this single pair (and no encoded forms) compiles
+	// the regex once and handles lines of any length.
+	m, err := NewMultiReplacer([]config.ReplacePair{{
+		Search:         search,
+		Replace:        replace,
+		Regex:          opts.Regex,
+		IgnoreCase:     opts.IgnoreCase,
+		OnlySerialized: opts.OnlyIntoSerialized,
+		SkipEncoded:    true,
+	}})
+	if err != nil {
+		return ReplaceStats{}, err
 	}
-	return bw.Flush()
+	err = m.ReplaceStream(r, w)
+	return m.stats[0], err
 }
 
 // ResilientReplaceFile applies search/replace to a file in-place.
 // It writes to a temp file and renames atomically.
 func ResilientReplaceFile(search, replace, filePath string, opts ReplaceOptions) error {
+	return rewriteFile(filePath, func(r io.Reader, w io.Writer) error {
+		_, err := ResilientReplaceStream(search, replace, r, w, opts)
+		return err
+	})
+}
+
+// rewriteFile streams filePath through fn into a temp file in the same
+// directory, then renames it over the original.
+func rewriteFile(filePath string, fn func(r io.Reader, w io.Writer) error) error {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("open %s: %w", filePath, err)
@@ -168,7 +288,7 @@ func ResilientReplaceFile(search, replace, filePath string, opts ReplaceOptions)
 	}
 	tmpPath := tmp.Name()
 
-	if err := ResilientReplaceStream(search, replace, f, tmp, opts); err != nil {
+	if err := fn(f, tmp); err != nil {
 		tmp.Close()
 		os.Remove(tmpPath)
 		return fmt.Errorf("replace in %s: %w", filePath, err)
@@ -183,12 +303,8 @@ func ResilientReplaceFile(search, replace, filePath string, opts ReplaceOptions)
 	return os.Rename(tmpPath, filePath)
 }
 
-// ApplyAllReplacements applies every search/replace pair in order to a file.
-func ApplyAllReplacements(pairs [][2]string, filePath string) error {
-	for _, p := range pairs {
-		if err := ResilientReplaceFile(p[0], p[1], filePath, ReplaceOptions{}); err != nil {
-			return err
-		}
-	}
-	return nil
+// ApplyAllReplacements applies every search/replace pair in order to a file
+// in a single pass.
+func ApplyAllReplacements(pairs []config.ReplacePair, filePath string) error {
+	return ResilientReplaceAllFile(pairs, filePath)
 }
@@ -0,0 +1,590 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// longLine replaces one dump line that is longer than maxLinePiece. The
+// line is processed in windows cut where no rule match and no serialized
+// string can straddle the cut, so the output is the same as replacing the
+// whole line at once. A serialized string that does not fit in a window is
+// streamed through a temp file and its s:N: length fixed afterwards.
+type longLine struct {
+	m  *MultiReplacer
+	lr *lineReader
+	w  *bufio.Writer
+
+	// la is kept unprocessed at the end of each window so that matches
+	// starting before the cut are complete; margin keeps cuts away from the
+	// matches of one rule that a later rule might extend. window is the
+	// size of a window, larger than maxLinePiece for very long searches.
+	la, margin, window int
+
+	// fields is set when rules apply per column; rows then tracks the field
+	// being read and skip the INSERT header bytes still to pass through.
+	fields bool
+	rows   rowScanner
+	skip   int
+
+	// skipHeader is set once the serialized header at the start of the
+	// next window was found not to close, so it is treated as plain text.
+	skipHeader bool
+}
+
+// replaceLongLine processes a line whose first bytes are head and whose
+// rest is read from lr, and writes it to w with its newline.
+func (m *MultiReplacer) replaceLongLine(head []byte, lr *lineReader, w *bufio.Writer) error {
+	l := &longLine{m: m, lr: lr, w: w}
+	l.la, l.margin = m.lookahead()
+	l.window = max(maxLinePiece, 4*l.la)
+	clear(m.touched)
+	if m.scoped {
+		m.ctx = nextInsertContext(m.ctx, insertHeaderPrefix(head))
+		if m.columnScoped(m.ctx.table) {
+			if m.ctx.columns == nil {
+				m.noteNoColumns(m.ctx.table)
+				return m.errNoColumns()
+			}
+			l.fields, l.skip = true, m.ctx.values
+		}
+	}
+	return l.run(head)
+}
+
+// insertHeaderPrefix returns enough of line to parse its INSERT header.
+func insertHeaderPrefix(line []byte) string {
+	return string(line[:min(len(line), 64*1024)])
+}
+
+// lookahead returns the longLine la and margin for m's rules. Regex matches
+// are assumed to be shorter than 4 KB and at most a quarter of a piece; a
+// literal search, in any of its encoded forms, is always covered in full.
+func (m *MultiReplacer) lookahead() (la, margin int) {
+	for _, rule := range m.rules {
+		if rule.opts.Regex {
+			la = 4096
+		} else {
+			margin = max(margin, len(rule.search))
+		}
+	}
+	la = max(min(max(la, 64), maxLinePiece/4), margin)
+	return la, margin
+}
+
+func (l *longLine) run(pending []byte) error {
+	var (
+		eol bool
+		err error
+	)
+	for {
+		for !eol && len(pending) < l.window {
+			if pending, eol, err = l.lr.more(pending, l.window-len(pending)); err != nil {
+				return err
+			}
+		}
+		if eol {
+			if err := l.write(trimCR(pending)); err != nil {
+				return err
+			}
+			return l.w.WriteByte('\n')
+		}
+		cut, spill := l.cut(pending)
+		if spill {
+			if pending, eol, err = l.spill(pending); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := l.write(pending[:cut]); err != nil {
+			return err
+		}
+		pending = append(pending[:0], pending[cut:]...)
+	}
+}
+
+// write applies the rules to one piece of the line and writes the result.
+func (l *longLine) write(piece []byte) error {
+	if l.skip > 0 {
+		n := min(l.skip, len(piece))
+		if _, err := l.w.Write(piece[:n]); err != nil {
+			return err
+		}
+		piece, l.skip = piece[n:], l.skip-n
+	}
+	m := l.m
+	s := string(piece)
+	switch {
+	case m.prefilter && !m.candidate(s):
+		l.scanRows(piece)
+	case l.fields:
+		s = m.replaceRowFields(s, &l.rows)
+	default:
+		for _, rule := range m.rules {
+			if rule.scope != nil && !rule.scope.allows(m.ctx.table, "") {
+				continue
+			}
+			s = m.apply(rule, s)
+		}
+	}
+	_, err := l.w.WriteString(s)
+	return err
+}
+
+// cut returns where to end the next piece of window b, or spill when b
+// starts with a serialized string that does not close within it.
+func (l *longLine) cut(b []byte) (cut int, spill bool) {
+	var ivs [][2]int
+	open := -1
+	for i := 0; ; {
+		h, hl, _, escaped, ok := findSerialHeader(b, i)
+		if !ok {
+			break
+		}
+		if h == 0 && l.skipHeader {
+			i = 1
+			continue
+		}
+		end, st := scanSerialClose(b[h+hl:], escaped)
+		if st == closeFound {
+			e := h + hl + end + serialCloseLen(escaped)
+			ivs = append(ivs, [2]int{h, e})
+			i = e
+			continue
+		}
+		if st == closeNeedMore {
+			open = h
+			break
+		}
+		i = h + 1
+	}
+	l.skipHeader = false
+	if open == 0 {
+		return 0, true
+	}
+
+	// A serialized string that does not close in this window starts the
+	// next one, so that it can be spilled.
+	limit := len(b) - l.la
+	if open > 0 && open <= limit {
+		return open, false
+	}
+	if !l.m.prefilter || l.m.candidate(string(b)) {
+		cut = l.matchCut(b, limit, ivs)
+	} else {
+		cut = safeCut(limit, ivs)
+	}
+	if open > 0 {
+		cut = min(cut, open)
+	}
+	return cut, false
+}
+
+// matchCut returns a cut point up to limit in b that is outside ivs and
+// away from rule matches. When matches are too dense to leave a margin
+// around each of them, it only avoids the matches themselves.
+func (l *longLine) matchCut(b []byte, limit int, ivs [][2]int) int {
+	if l.margin > 0 {
+		if cut := safeCut(limit, append(l.matchIntervals(b, l.margin), ivs...)); cut > 0 && cut <= limit {
+			return cut
+		}
+	}
+	return safeCut(limit, append(l.matchIntervals(b, 0), ivs...))
+}
+
+// matchIntervals returns the ranges of b covered by a match of any rule,
+// widened by margin on each side.
+func (l *longLine) matchIntervals(b []byte, margin int) [][2]int {
+	var ivs [][2]int
+	add := func(start, end int) {
+		ivs = append(ivs, [2]int{max(start-margin, 0), min(end+margin, len(b))})
+	}
+	for _, rule := range l.m.rules {
+		switch {
+		case rule.opts.usesRegex():
+			for _, loc := range rule.opts.compiledRe.FindAllIndex(b, -1) {
+				add(loc[0], loc[1])
+			}
+		case rule.search != "":
+			search := []byte(rule.search)
+			for i := 0; ; {
+				j := bytes.Index(b[i:], search)
+				if j < 0 {
+					break
+				}
+				add(i+j, i+j+len(search))
+				i += j + len(search)
+			}
+		}
+	}
+	return ivs
+}
+
+// safeCut returns the largest cut point up to limit that is not strictly
+// inside one of ivs. When there is none, it returns the end of the ranges
+// covering the start, which may lie past limit.
+func safeCut(limit int, ivs [][2]int) int {
+	sort.Slice(ivs, func(i, j int) bool { return ivs[i][0] < ivs[j][0] })
+	var merged [][2]int
+	for _, iv := range ivs {
+		if iv[0] >= iv[1] {
+			continue
+		}
+		if n := len(merged); n > 0 && iv[0] < merged[n-1][1] {
+			merged[n-1][1] = max(merged[n-1][1], iv[1])
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	p := limit
+	for _, iv := range merged {
+		if iv[0] < p && p < iv[1] {
+			p = iv[0]
+			break
+		}
+	}
+	if p == 0 && len(merged) > 0 {
+		p = merged[0][1]
+	}
+	return p
+}
+
+// spill handles a serialized string that starts at b[0] and does not close
+// within the window. Its content is copied to a temp file up to the closing
+// quote, then written back with the rules applied and its length fixed. It
+// returns the rest of the line read so far. If the string turns out not to
+// close, everything read is put back in front of the input and processed
+// again as plain text.
+func (l *longLine) spill(b []byte) (rest []byte, eol bool, err error) {
+	_, hl, n, escaped, _ := findSerialHeader(b, 0)
+	header := append([]byte(nil), b[:hl]...)
+
+	raw, err := l.lr.spillFile()
+	if err != nil {
+		return nil, false, err
+	}
+	rw := bufio.NewWriter(raw)
+	scan := newCandidateScanner(l.m)
+	// In field mode, text outside the rows is never replaced. The string is
+	// still fed to the row scanner so it keeps track of quotes and fields.
+	column, inRow, rows := l.column(), !l.fields || l.rows.depth == 1, l.rows
+	l.scanRows(header)
+
+	buf := b[hl:]
+	for {
+		end, st := scanSerialClose(buf, escaped)
+		if st == closeFailed || (st == closeNeedMore && eol) {
+			l.rows = rows
+			return nil, false, l.unspill(header, raw, rw, buf, eol)
+		}
+		if _, err := rw.Write(buf[:end]); err != nil {
+			return nil, false, err
+		}
+		scan.feed(buf[:end])
+		l.scanRows(buf[:end])
+		if st == closeFound {
+			if err := rw.Flush(); err != nil {
+				return nil, false, err
+			}
+			closing := end + serialCloseLen(escaped)
+			l.scanRows(buf[end:closing])
+			return buf[closing:], eol, l.writeSpilled(raw, n, escaped, scan.found && inRow, column)
+		}
+		buf = append(buf[:0], buf[end:]...)
+		if buf, eol, err = l.lr.more(buf, maxLinePiece); err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// unspill puts a serialized header that did not close, the content copied
+// so far and tail back in front of the input.
+func (l *longLine) unspill(header []byte, raw *os.File, rw *bufio.Writer, tail []byte, eol bool) error {
+	if err := rw.Flush(); err != nil {
+		return err
+	}
+	if _, err := raw.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	parts := []io.Reader{bytes.NewReader(header), raw, bytes.NewReader(bytes.Clone(tail))}
+	if eol {
+		parts = append(parts, strings.NewReader("\n"))
+	}
+	l.lr.unread(parts...)
+	l.skipHeader = true
+	return nil
+}
+
+// writeSpilled writes the serialized string whose content is in raw, with
+// the rules applied when the content may contain a match.
+func (l *longLine) writeSpilled(raw *os.File, n int, escaped, candidate bool, column string) error {
+	if _, err := raw.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	quote := `"`
+	if escaped {
+		quote = `\"`
+	}
+	if !candidate {
+		fmt.Fprintf(l.w, "s:%d:%s", n, quote)
+		if _, err := io.Copy(l.w, raw); err != nil {
+			return err
+		}
+		_, err := l.w.WriteString(quote + ";")
+		return err
+	}
+
+	out, err := l.lr.spillFile()
+	if err != nil {
+		return err
+	}
+	ow := bufio.NewWriter(out)
+	delta := 0
+	var win []byte
+	for eof := false; !eof || len(win) > 0; {
+		if !eof {
+			if win, eof, err = fill(raw, win, l.window); err != nil {
+				return err
+			}
+		}
+		cut := len(win)
+		if !eof {
+			cut = l.matchCut(win, len(win)-l.la, nil)
+		}
+		s, d := l.replaceInner(string(win[:cut]), column)
+		delta += d
+		if _, err := ow.WriteString(s); err != nil {
+			return err
+		}
+		win = append(win[:0], win[cut:]...)
+	}
+	if err := ow.Flush(); err != nil {
+		return err
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	fmt.Fprintf(l.w, "s:%d:%s", n+delta, quote)
+	if _, err := io.Copy(l.w, out); err != nil {
+		return err
+	}
+	_, err = l.w.WriteString(quote + ";")
+	return err
+}
+
+// scanRows advances the row scanner over b in field mode.
+func (l *longLine) scanRows(b []byte) {
+	if l.fields {
+		l.rows.scan(string(b), func(int, int, int) {})
+	}
+}
+
+// column returns the column the current field belongs to in field mode.
+func (l *longLine) column() string {
+	if cols := l.m.ctx.columns; l.fields && l.rows.col < len(cols) {
+		return cols[l.rows.col]
+	}
+	return ""
+}
+
+// replaceInner applies the rules to part of the content of a serialized
+// string, as replaceLine does, and returns the change in byte length to add
+// to its s:N: count.
+func (l *longLine) replaceInner(s, column string) (string, int) {
+	m := l.m
+	delta := 0
+	for _, rule := range m.rules {
+		if rule.scope != nil && !rule.scope.allows(m.ctx.table, column) {
+			continue
+		}
+		st := &m.stats[rule.pair]
+		out, count := replaceAllCount(rule, s)
+		if count > 0 {
+			st.Serialized += int64(count)
+			if rule.opts.usesRegex() {
+				delta += len(out) - len(s)
+			} else {
+				searchLen, replaceLen := len(rule.search), len(rule.replace)
+				if rule.opts.dumpEscaped {
+					searchLen -= strings.Count(rule.search, `\\`)
+					replaceLen -= strings.Count(rule.replace, `\\`)
+				}
+				delta += count * (replaceLen - searchLen)
+			}
+		}
+		// replaceLine's plain pass also runs over serialized strings.
+		if !rule.opts.OnlyIntoSerialized {
+			var plain int
+			out, plain = replaceAllCount(rule, out)
+			st.Plain += int64(plain)
+		}
+		if out != s && !m.touched[rule.pair] {
+			m.touched[rule.pair] = true
+			st.Lines++
+		}
+		s = out
+	}
+	return s, delta
+}
+
+// replaceAllCount replaces every match of rule in s and counts them.
+func replaceAllCount(rule replaceRule, s string) (string, int) {
+	if rule.opts.usesRegex() {
+		re := rule.opts.compiledRe
+		count := len(re.FindAllStringIndex(s, -1))
+		if count == 0 {
+			return s, 0
+		}
+		return re.ReplaceAllString(s, regexReplacement(rule.replace, rule.opts)), count
+	}
+	if rule.search == "" {
+		return s, 0
+	}
+	count := strings.Count(s, rule.search)
+	if count == 0 {
+		return s, 0
+	}
+	return strings.ReplaceAll(s, rule.search, rule.replace), count
+}
+
+// fill appends up to n bytes read from r to b; eof is true once r is
+// exhausted.
+func fill(r io.Reader, b []byte, n int) (_ []byte, eof bool, err error) {
+	k := len(b)
+	b = slices.Grow(b, n)[:k+n]
+	got, err := io.ReadFull(r, b[k:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return b[:k+got], true, nil
+	}
+	return b[:k+got], false, err
+}
+
+// ── Serialized string boundaries ────────────────────────────────────────────
+
+// findSerialHeader finds the first serialized string header at or after
+// b[from]: s:N:" or, in the escaped form, s:N:\". It returns the header's
+// offset and length and the declared byte count N.
+func findSerialHeader(b []byte, from int) (at, length, n int, escaped, ok bool) {
+	for i := from; i < len(b); {
+		j := bytes.Index(b[i:], []byte("s:"))
+		if j < 0 {
+			return 0, 0, 0, false, false
+		}
+		at = i + j
+		k := at + 2
+		for k < len(b) && b[k] >= '0' && b[k] <= '9' {
+			k++
+		}
+		digits := b[at+2 : k]
+		if len(digits) > 0 && k < len(b) && b[k] == ':' {
+			k++
+			escaped = k < len(b) && b[k] == '\\'
+			if escaped {
+				k++
+			}
+			if k < len(b) && b[k] == '"' {
+				n, err := strconv.Atoi(string(digits))
+				if err == nil {
+					return at, k + 1 - at, n, escaped, true
+				}
+			}
+		}
+		i = at + 1
+	}
+	return 0, 0, 0, false, false
+}
+
+type closeStatus int
+
+const (
+	closeNeedMore closeStatus = iota
+	closeFound
+	closeFailed
+)
+
+// scanSerialClose finds the closing "; (or \"; when escaped) of serialized
+// string content b, matching exactly what phpSerialPattern and
+// phpSerialPatternEsc accept. It returns the offset of the closing quote.
+// closeFailed means the content cannot be a serialized string; with
+// closeNeedMore, the returned offset is how much of b is known to be
+// content.
+func scanSerialClose(b []byte, escaped bool) (int, closeStatus) {
+	for i := 0; i < len(b); {
+		switch b[i] {
+		case '"':
+			if escaped {
+				return i, closeFailed
+			}
+			if i+1 >= len(b) {
+				return i, closeNeedMore
+			}
+			if b[i+1] == ';' {
+				return i, closeFound
+			}
+			return i, closeFailed
+		case '\\':
+			if escaped {
+				if i+2 >= len(b) {
+					return i, closeNeedMore
+				}
+				if b[i+1] == '"' && b[i+2] == ';' {
+					return i, closeFound
+				}
+			} else if i+1 >= len(b) {
+				return i, closeNeedMore
+			}
+			i += 2
+		default:
+			i++
+		}
+	}
+	return len(b), closeNeedMore
+}
+
+func serialCloseLen(escaped bool) int {
+	if escaped {
+		return 3
+	}
+	return 2
+}
+
+// candidateScanner runs the Aho-Corasick prefilter over a stream.
+type candidateScanner struct {
+	m     *MultiReplacer
+	state int32
+	found bool
+}
+
+func newCandidateScanner(m *MultiReplacer) *candidateScanner {
+	return &candidateScanner{m: m, found: !m.prefilter}
+}
+
+func (cs *candidateScanner) feed(b []byte) {
+	if cs.found {
+		return
+	}
+	a := cs.m.ac
+	for _, c := range b {
+		if cs.m.foldCase {
+			if c >= 0x80 {
+				cs.found = true
+				return
+			}
+			if 'A' <= c && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+		}
+		cs.state = a.next[cs.state][c]
+		if a.out[cs.state] {
+			cs.found = true
+			return
+		}
+	}
+}
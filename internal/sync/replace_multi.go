@@ -0,0 +1,445 @@
+package sync
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// MultiReplacer applies an ordered list of replace pairs to a dump in a
+// single pass. Every line is scanned once by an Aho-Corasick automaton built
+// from all search strings; lines without any candidate are passed through
+// untouched. Lines that do contain a candidate get the pairs applied in
+// config order, exactly as running ResilientReplaceLine once per pair would,
+// so a later pair still sees the output of earlier ones.
+type MultiReplacer struct {
+	rules []replaceRule
+	ac    *acMatcher
+	// prefilter is false when some rule cannot be expressed as a literal
+	// (e.g. a regex or an empty search); every line is then processed.
+	prefilter bool
+	// foldCase is set when a case-insensitive literal is present: the
+	// automaton then holds lower-cased patterns and scans ASCII-folded input.
+	foldCase bool
+
+	// stats is indexed by configured pair; encoded forms count towards the
+	// pair they were derived from. touched tracks the current line.
+	stats   []ReplaceStats
+	touched []bool
+
+	// scoped is set when some pair is limited to tables or columns; the
+	// INSERT statement of each line is then tracked in ctx.
+	scoped bool
+	ctx    insertContext
+	// noColumns is the first table with column-scoped pairs whose INSERT
+	// has no column list. The pairs cannot be honoured there, so the
+	// stream stops with errNoColumns rather than widen them to the table.
+	noColumns string
+}
+
+type replaceRule struct {
+	search  string
+	replace string
+	opts    ReplaceOptions
+	pair    int        // index of the configured pair
+	scope   *pairScope // nil when the pair applies to every table
+}
+
+// NewMultiReplacer compiles pairs into a MultiReplacer.
+func NewMultiReplacer(pairs []config.ReplacePair) (*MultiReplacer, error) {
+	m := &MultiReplacer{
+		prefilter: true,
+		stats:     make([]ReplaceStats, len(pairs)),
+		touched:   make([]bool, len(pairs)),
+	}
+	var literals []string
+	for _, p := range expandEncodedPairs(pairs) {
+		opts := replaceOptionsFor(p.ReplacePair)
+		opts.dumpEscaped = p.dumpEscaped
+		opts, err := compileReplaceOptions(p.Search, opts)
+		if err != nil {
+			return nil, err
+		}
+		rule := replaceRule{search: p.Search, replace: p.Replace, opts: opts, pair: p.pair, scope: newPairScope(p.ReplacePair)}
+		if rule.scope != nil {
+			m.scoped = true
+		}
+		switch {
+		case opts.Regex || p.Search == "":
+			m.prefilter = false
+		default:
+			if opts.IgnoreCase {
+				m.foldCase = true
+			}
+			literals = append(literals, p.Search)
+		}
+		m.rules = append(m.rules, rule)
+	}
+	if m.foldCase {
+		for i, l := range literals {
+			literals[i] = strings.ToLower(l)
+		}
+	}
+	m.ac = newACMatcher(literals)
+	return m, nil
+}
+
+// ReplaceLine applies every pair, in order, to one line.
+func (m *MultiReplacer) ReplaceLine(line string) string {
+	if len(m.rules) == 0 {
+		return line
+	}
+	if m.scoped {
+		m.ctx = nextInsertContext(m.ctx, line)
+	}
+	if m.prefilter && !m.candidate(line) {
+		return line
+	}
+	clear(m.touched)
+	if m.scoped && m.columnScoped(m.ctx.table) {
+		if m.ctx.columns == nil {
+			m.noteNoColumns(m.ctx.table)
+			return line
+		}
+		return m.replaceFields(line)
+	}
+	for _, rule := range m.rules {
+		if rule.scope != nil && !rule.scope.allows(m.ctx.table, "") {
+			continue
+		}
+		line = m.apply(rule, line)
+	}
+	return line
+}
+
+// apply runs one rule over s and records its statistics.
+func (m *MultiReplacer) apply(rule replaceRule, s string) string {
+	// A literal that is absent leaves the text unchanged, so skip the
+	// serialized-string scan entirely.
+	if !rule.opts.usesRegex() && rule.search != "" && !strings.Contains(s, rule.search) {
+		return s
+	}
+	out := replaceLine(rule.search, rule.replace, s, rule.opts, &m.stats[rule.pair])
+	if out != s && !m.touched[rule.pair] {
+		m.touched[rule.pair] = true
+		m.stats[rule.pair].Lines++
+	}
+	return out
+}
+
+// columnScoped reports whether some pair names a column of table.
+func (m *MultiReplacer) columnScoped(table string) bool {
+	if table == "" {
+		return false
+	}
+	for _, rule := range m.rules {
+		if rule.scope != nil && rule.scope.hasColumns(table) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceFields applies the rules field by field to the rows of a
+// --complete-insert line, so column-scoped pairs only see their columns.
+func (m *MultiReplacer) replaceFields(line string) string {
+	var rs rowScanner
+	off := m.ctx.values
+	if out := m.replaceRowFields(line[off:], &rs); out != line[off:] {
+		return line[:off] + out
+	}
+	return line
+}
+
+// replaceRowFields applies the rules to the fields found by rs in s, which
+// holds rows of the current INSERT.
+func (m *MultiReplacer) replaceRowFields(s string, rs *rowScanner) string {
+	var b strings.Builder
+	last, changed := 0, false
+	rs.scan(s, func(start, end, col int) {
+		column := ""
+		if col < len(m.ctx.columns) {
+			column = m.ctx.columns[col]
+		}
+		field := s[start:end]
+		out := field
+		for _, rule := range m.rules {
+			if rule.scope != nil && !rule.scope.allows(m.ctx.table, column) {
+				continue
+			}
+			out = m.apply(rule, out)
+		}
+		if out == field {
+			return
+		}
+		changed = true
+		b.WriteString(s[last:start])
+		b.WriteString(out)
+		last = end
+	})
+	if !changed {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// noteNoColumns records that the INSERT of table has no column names
+// although some pair is scoped to columns of it.
+func (m *MultiReplacer) noteNoColumns(table string) {
+	if m.noColumns == "" {
+		m.noColumns = table
+	}
+}
+
+// errNoColumns returns the error that stops a stream once noColumns is
+// set, or nil.
+func (m *MultiReplacer) errNoColumns() error {
+	if m.noColumns == "" {
+		return nil
+	}
+	return fmt.Errorf("table %s: the dump has no column names for the column-scoped replace pairs (add --complete-insert to sql_options_extra)", m.noColumns)
+}
+
+// Stats returns the counts gathered so far, one entry per configured pair
+// in config order.
+func (m *MultiReplacer) Stats() []ReplaceStats {
+	return append([]ReplaceStats(nil), m.stats...)
+}
+
+// candidate reports whether line may contain a match for any literal rule.
+func (m *MultiReplacer) candidate(line string) bool {
+	if !m.foldCase {
+		return m.ac.containsAny(line)
+	}
+	// Unicode case folding maps some non-ASCII runes onto ASCII letters
+	// (e.g. the Kelvin sign onto k), so only pure-ASCII lines can be ruled
+	// out by the ASCII-folded scan.
+	for i := 0; i < len(line); i++ {
+		if line[i] >= 0x80 {
+			return true
+		}
+	}
+	return m.ac.containsAnyFold(line)
+}
+
+// ReplaceStream applies every pair to each line read from r, writing the
+// result to w. Lines of any length are handled in bounded memory: lines
+// longer than maxLinePiece are processed in pieces (see longLine).
+func (m *MultiReplacer) ReplaceStream(r io.Reader, w io.Writer) error {
+	lr := newLineReader(r, maxLinePiece)
+	defer lr.close()
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	for {
+		line, full, err := lr.next(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if full {
+			bw.WriteString(m.ReplaceLine(string(line)))
+			if err = m.errNoColumns(); err == nil {
+				err = bw.WriteByte('\n')
+			}
+		} else {
+			err = m.replaceLongLine(line, lr, bw)
+		}
+		if err != nil {
+			return err
+		}
+		buf = line[:0]
+	}
+	return bw.Flush()
+}
+
+// ResilientReplaceAllStream applies every pair in order to the stream r in a
+// single pass, writing the result to w.
+func ResilientReplaceAllStream(pairs []config.ReplacePair, r io.Reader, w io.Writer) error {
+	m, err := NewMultiReplacer(pairs)
+	if err != nil {
+		return err
+	}
+	return m.ReplaceStream(r, w)
+}
+
+// ResilientReplaceAllFile applies every pair in order to a file in-place,
+// reading and rewriting it once regardless of the number of pairs.
+func ResilientReplaceAllFile(pairs []config.ReplacePair, filePath string) error {
+	m, err := NewMultiReplacer(pairs)
+	if err != nil {
+		return err
+	}
+	return rewriteFile(filePath, m.ReplaceStream)
+}
+
+// ── Encoded variants ────────────────────────────────────────────────────────
+
+// encodedPair is a replace pair, possibly in one of its encoded forms.
+type encodedPair struct {
+	config.ReplacePair
+	pair        int  // index of the configured pair it derives from
+	dumpEscaped bool // written with mysqldump backslash escaping
+}
+
+// expandEncodedPairs returns pairs with the encoded forms of each literal
+// pair inserted right after it, so that URLs stored inside JSON (Gutenberg
+// block attributes, Elementor data, ACF) or URL-encoded values are rewritten
+// too. Regex pairs and pairs with SkipEncoded are kept as-is.
+func expandEncodedPairs(pairs []config.ReplacePair) []encodedPair {
+	encodings := []struct {
+		encode      func(string) string
+		dumpEscaped bool
+	}{
+		{jsonEscapeSlashes, false},
+		{sqlJSONEscapeSlashes, true},
+		{urlEncodeComponent, false},
+	}
+
+	out := make([]encodedPair, 0, len(pairs))
+	for i, p := range pairs {
+		out = append(out, encodedPair{ReplacePair: p, pair: i})
+		if p.Regex || p.SkipEncoded || p.Search == "" {
+			continue
+		}
+		seen := map[string]bool{p.Search: true}
+		for _, enc := range encodings {
+			v := p
+			v.Search, v.Replace = enc.encode(p.Search), enc.encode(p.Replace)
+			if seen[v.Search] {
+				continue
+			}
+			seen[v.Search] = true
+			out = append(out, encodedPair{ReplacePair: v, pair: i, dumpEscaped: enc.dumpEscaped})
+		}
+	}
+	return out
+}
+
+// jsonEscapeSlashes returns s as json_encode() writes it by default:
+// https://a.b/c → https:\/\/a.b\/c.
+func jsonEscapeSlashes(s string) string {
+	return strings.ReplaceAll(s, "/", `\/`)
+}
+
+// sqlJSONEscapeSlashes returns the JSON-escaped form of s as it appears in
+// a mysqldump string literal, where every backslash is doubled.
+func sqlJSONEscapeSlashes(s string) string {
+	return strings.ReplaceAll(s, "/", `\\/`)
+}
+
+// urlEncodeComponent percent-encodes s like PHP's rawurlencode() and
+// JavaScript's encodeURIComponent(): every byte except the RFC 3986
+// unreserved characters is escaped.
+func urlEncodeComponent(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// ── Aho-Corasick ────────────────────────────────────────────────────────────
+
+// acMatcher is a byte-level Aho-Corasick automaton with fully resolved
+// transitions, so matching is a single table lookup per input byte.
+type acMatcher struct {
+	next [][256]int32
+	out  []bool // a pattern ends at this state (directly or via a fail link)
+}
+
+func newACMatcher(patterns []string) *acMatcher {
+	a := &acMatcher{next: make([][256]int32, 1), out: make([]bool, 1)}
+	for i := range a.next[0] {
+		a.next[0][i] = -1
+	}
+
+	// Build the trie.
+	for _, p := range patterns {
+		state := int32(0)
+		for i := 0; i < len(p); i++ {
+			c := p[i]
+			if a.next[state][c] < 0 {
+				var row [256]int32
+				for j := range row {
+					row[j] = -1
+				}
+				a.next = append(a.next, row)
+				a.out = append(a.out, false)
+				a.next[state][c] = int32(len(a.next) - 1)
+			}
+			state = a.next[state][c]
+		}
+		a.out[state] = true
+	}
+
+	// Resolve fail links breadth-first into the transition table.
+	fail := make([]int32, len(a.next))
+	var queue []int32
+	for c := 0; c < 256; c++ {
+		if s := a.next[0][c]; s >= 0 {
+			fail[s] = 0
+			queue = append(queue, s)
+		} else {
+			a.next[0][c] = 0
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		a.out[state] = a.out[state] || a.out[fail[state]]
+		for c := 0; c < 256; c++ {
+			if s := a.next[state][c]; s >= 0 {
+				fail[s] = a.next[fail[state]][c]
+				queue = append(queue, s)
+			} else {
+				a.next[state][c] = a.next[fail[state]][c]
+			}
+		}
+	}
+	return a
+}
+
+// containsAny reports whether s contains at least one of the patterns.
+func (a *acMatcher) containsAny(s string) bool {
+	state := int32(0)
+	for i := 0; i < len(s); i++ {
+		state = a.next[state][s[i]]
+		if a.out[state] {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAnyFold is containsAny with ASCII letters folded to lower case.
+// The automaton must have been built from lower-cased patterns.
+func (a *acMatcher) containsAnyFold(s string) bool {
+	state := int32(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		state = a.next[state][c]
+		if a.out[state] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// replaceChunkSize is the amount of dump text handed to one worker. Chunks
+// are only cut at statement boundaries, so a chunk may be larger.
+var replaceChunkSize = 1 << 20
+
+// replaceWorkers returns the number of find/replace workers for cfg:
+// database.replace_workers, or GOMAXPROCS when unset.
+func replaceWorkers(cfg *config.Config) int {
+	if n := cfg.Database.ReplaceWorkers; n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// errStopped unblocks the chunk reader once the writer has failed.
+var errStopped = errors.New("replace stopped")
+
+// ReplaceStreamParallel is ReplaceStream spread over workers goroutines.
+// The input is split into chunks at statement boundaries, each chunk is
+// processed by one worker and the results are written back in order, so
+// the output and the statistics are identical to ReplaceStream.
+func (m *MultiReplacer) ReplaceStreamParallel(r io.Reader, w io.Writer, workers int) error {
+	if workers <= 1 || len(m.rules) == 0 {
+		return m.ReplaceStream(r, w)
+	}
+
+	type job struct {
+		data []byte
+		ctx  insertContext
+		out  chan chunkResult
+		// long is set for a line longer than maxLinePiece. The writer
+		// processes it itself, reading the rest of the line from long,
+		// while the reader waits on done.
+		long *lineReader
+		done chan error
+	}
+	jobs := make(chan job, workers)
+	// order holds the jobs in input order; its buffer bounds the number of
+	// chunks held in memory.
+	order := make(chan job, 2*workers)
+	stop := make(chan struct{})
+	send := func(j job) error {
+		select {
+		case <-stop:
+			return errStopped
+		default:
+		}
+		select {
+		case order <- j:
+			return nil
+		case <-stop:
+			return errStopped
+		}
+	}
+
+	var readErr error
+	go func() {
+		defer close(jobs)
+		defer close(order)
+		readErr = readStatementChunks(r, m.scoped, func(data []byte, ctx insertContext) error {
+			j := job{data: data, ctx: ctx, out: make(chan chunkResult, 1)}
+			if err := send(j); err != nil {
+				return err
+			}
+			jobs <- j
+			return nil
+		}, func(head []byte, lr *lineReader, ctx insertContext) error {
+			j := job{data: head, ctx: ctx, long: lr, done: make(chan error, 1)}
+			if err := send(j); err != nil {
+				return err
+			}
+			return <-j.done
+		})
+	}()
+
+	clones := make([]*MultiReplacer, workers)
+	var wg sync.WaitGroup
+	for i := range clones {
+		clones[i] = m.clone()
+		wg.Add(1)
+		go func(c *MultiReplacer) {
+			defer wg.Done()
+			for j := range jobs {
+				data := c.replaceChunk(j.data, j.ctx)
+				j.out <- chunkResult{data, c.errNoColumns()}
+			}
+		}(clones[i])
+	}
+
+	bw := bufio.NewWriter(w)
+	var writeErr error
+	for j := range order {
+		if j.long != nil {
+			if writeErr != nil {
+				j.done <- errStopped
+				continue
+			}
+			m.ctx = j.ctx
+			if writeErr = m.replaceLongLine(j.data, j.long, bw); writeErr != nil {
+				close(stop)
+			}
+			j.done <- writeErr
+			continue
+		}
+		res := <-j.out
+		if writeErr != nil {
+			continue
+		}
+		if writeErr = res.err; writeErr == nil {
+			_, writeErr = bw.Write(res.data)
+		}
+		if writeErr != nil {
+			close(stop)
+		}
+	}
+	wg.Wait()
+	if writeErr == nil {
+		writeErr = bw.Flush()
+	}
+
+	for _, c := range clones {
+		m.merge(c)
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return readErr
+}
+
+// readStatementChunks reads r line by line and calls emit with chunks of at
+// least replaceChunkSize bytes. A chunk ends after a line terminated by ";"
+// and before a line that starts a new statement, so INSERT context rarely
+// carries over from one chunk to the next; when scoped, the context at the
+// start of each chunk is tracked anyway and passed along. Lines longer than
+// maxLinePiece end the current chunk and are handed to long with the rest
+// of the line still unread in lr. Line endings are normalised to "\n".
+func readStatementChunks(r io.Reader, scoped bool,
+	emit func(data []byte, ctx insertContext) error,
+	long func(head []byte, lr *lineReader, ctx insertContext) error) error {
+	lr := newLineReader(r, maxLinePiece)
+	defer lr.close()
+	var (
+		chunk         []byte
+		ctx, chunkCtx insertContext
+		buf           []byte
+	)
+	endsStatement := false
+	for {
+		line, full, err := lr.next(buf)
+		if err == io.EOF {
+			if len(chunk) > 0 {
+				return emit(chunk, chunkCtx)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !full {
+			if len(chunk) > 0 {
+				if err := emit(chunk, chunkCtx); err != nil {
+					return err
+				}
+				chunk = nil
+			}
+			lineCtx := ctx
+			if scoped {
+				ctx = nextInsertContext(ctx, insertHeaderPrefix(line))
+			}
+			if err := long(line, lr, lineCtx); err != nil {
+				return err
+			}
+			chunkCtx, endsStatement = ctx, false
+			buf = line[:0]
+			continue
+		}
+		if len(chunk) >= replaceChunkSize && endsStatement && startsStatement(line) {
+			if err := emit(chunk, chunkCtx); err != nil {
+				return err
+			}
+			chunk, chunkCtx = nil, ctx
+		}
+		if scoped {
+			ctx = nextInsertContext(ctx, insertHeaderPrefix(line))
+		}
+		chunk = append(chunk, line...)
+		chunk = append(chunk, '\n')
+		endsStatement = bytes.HasSuffix(line, []byte(";"))
+		buf = line[:0]
+	}
+}
+
+// startsStatement reports whether line gets its INSERT context from itself
+// rather than from the previous line (see nextInsertContext).
+func startsStatement(line []byte) bool {
+	if len(line) == 0 {
+		return false
+	}
+	switch line[0] {
+	case '(', ' ', '\t':
+		return false
+	}
+	return true
+}
+
+// chunkResult is a chunk processed by a worker, or the error that stops
+// the stream.
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// replaceChunk applies ReplaceLine to every line of chunk, starting in the
+// INSERT context ctx.
+func (m *MultiReplacer) replaceChunk(chunk []byte, ctx insertContext) []byte {
+	m.ctx = ctx
+	out := make([]byte, 0, len(chunk)+len(chunk)/16)
+	for len(chunk) > 0 {
+		line := chunk
+		if i := bytes.IndexByte(chunk, '\n'); i >= 0 {
+			line, chunk = chunk[:i], chunk[i+1:]
+		} else {
+			chunk = nil
+		}
+		out = append(out, m.ReplaceLine(string(line))...)
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// clone returns a MultiReplacer sharing m's compiled rules with its own
+// statistics and INSERT tracking, for use by one worker goroutine.
+func (m *MultiReplacer) clone() *MultiReplacer {
+	c := *m
+	c.stats = make([]ReplaceStats, len(m.stats))
+	c.touched = make([]bool, len(m.touched))
+	c.ctx = insertContext{}
+	c.noColumns = ""
+	return &c
+}
+
+// merge adds the statistics gathered by a worker clone to m.
+func (m *MultiReplacer) merge(c *MultiReplacer) {
+	for i, st := range c.stats {
+		m.stats[i].Plain += st.Plain
+		m.stats[i].Serialized += st.Serialized
+		m.stats[i].Lines += st.Lines
+	}
+}
@@ -0,0 +1,172 @@
+package sync
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// insertHeaderRe matches the start of an INSERT/REPLACE statement and
+// captures the table name and, for --complete-insert dumps, the column list.
+var insertHeaderRe = regexp.MustCompile("^(?:INSERT|REPLACE)(?:\\s+IGNORE)?\\s+INTO\\s+`?([^`\\s(]+)`?\\s*(?:\\(([^)]*)\\))?\\s*(?:VALUES)?\\s*")
+
+// insertContext is the statement a dump line belongs to.
+type insertContext struct {
+	table   string   // "" outside an INSERT
+	columns []string // nil unless the dump uses --complete-insert
+	values  int      // byte offset of the first row on the line
+}
+
+// nextInsertContext returns the context of line given the context of the
+// previous line. Rows of one INSERT may continue on lines that start with
+// "(" or whitespace; any other statement ends the INSERT.
+func nextInsertContext(prev insertContext, line string) insertContext {
+	if len(line) == 0 {
+		return prev
+	}
+	switch line[0] {
+	case 'I', 'R':
+		if m := insertHeaderRe.FindStringSubmatchIndex(line); m != nil {
+			ctx := insertContext{table: line[m[2]:m[3]], values: m[1]}
+			if m[4] >= 0 {
+				for _, col := range strings.Split(line[m[4]:m[5]], ",") {
+					ctx.columns = append(ctx.columns, strings.Trim(strings.TrimSpace(col), "`"))
+				}
+			}
+			return ctx
+		}
+	case '(', ' ', '\t':
+		prev.values = 0
+		return prev
+	}
+	return insertContext{}
+}
+
+// pairScope restricts a pair to some tables or columns. Entries are table
+// names or "table.column", and the table part may be a glob (wp_*_log).
+type pairScope struct {
+	include []scopeEntry
+	exclude []scopeEntry
+}
+
+type scopeEntry struct {
+	table  string
+	column string // "" for the whole table
+}
+
+// newPairScope returns nil for a pair that applies everywhere.
+func newPairScope(p config.ReplacePair) *pairScope {
+	if len(p.Tables) == 0 && len(p.ExcludeTables) == 0 {
+		return nil
+	}
+	return &pairScope{include: scopeEntries(p.Tables), exclude: scopeEntries(p.ExcludeTables)}
+}
+
+func scopeEntries(list []string) []scopeEntry {
+	entries := make([]scopeEntry, 0, len(list))
+	for _, s := range list {
+		table, column, _ := strings.Cut(strings.TrimSpace(s), ".")
+		entries = append(entries, scopeEntry{table: table, column: column})
+	}
+	return entries
+}
+
+// hasColumns reports whether some entry names a column of table.
+func (sc *pairScope) hasColumns(table string) bool {
+	for _, list := range [][]scopeEntry{sc.include, sc.exclude} {
+		for _, e := range list {
+			if e.column != "" && e.matchTable(table) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allows reports whether the pair applies to column of table. column is
+// "" when the whole line is processed at once; column entries then act on
+// their whole table.
+func (sc *pairScope) allows(table, column string) bool {
+	if len(sc.include) > 0 && !sc.matches(sc.include, table, column) {
+		return false
+	}
+	return !sc.matches(sc.exclude, table, column)
+}
+
+func (sc *pairScope) matches(list []scopeEntry, table, column string) bool {
+	if table == "" {
+		return false
+	}
+	for _, e := range list {
+		if e.matchTable(table) && (e.column == "" || column == "" || e.column == column) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e scopeEntry) matchTable(table string) bool {
+	ok, _ := path.Match(e.table, table)
+	return ok
+}
+
+// rowScanner splits the rows of an INSERT into field values. It keeps its
+// state between calls to scan, so a line may be fed to it in pieces.
+type rowScanner struct {
+	depth, col int
+	quote, esc bool
+}
+
+// scan calls fn for each field value of the rows in s, with its byte range
+// and zero-based column index. Quoted strings may contain commas and
+// parentheses. A field still open at the end of s is reported up to there
+// and continues in the next call.
+func (rs *rowScanner) scan(s string, fn func(start, end, col int)) {
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if rs.quote {
+			switch {
+			case rs.esc:
+				rs.esc = false
+			case c == '\\':
+				rs.esc = true
+			case c == '\'':
+				rs.quote = false
+			}
+			continue
+		}
+		switch c {
+		case '\'':
+			rs.quote = true
+		case '(':
+			rs.depth++
+			if rs.depth == 1 {
+				rs.col, start = 0, i+1
+			}
+		case ',':
+			if rs.depth == 1 {
+				fn(start, i, rs.col)
+				rs.col, start = rs.col+1, i+1
+			}
+		case ')':
+			if rs.depth == 1 {
+				fn(start, i, rs.col)
+			}
+			if rs.depth > 0 {
+				rs.depth--
+			}
+		}
+	}
+	if rs.depth == 1 && start < len(s) {
+		fn(start, len(s), rs.col)
+	}
+}
+
+// splitRowFields calls fn for each field value of the rows in s.
+func splitRowFields(s string, fn func(start, end, col int)) {
+	var rs rowScanner
+	rs.scan(s, fn)
+}
@@ -1,8 +1,12 @@
 package sync
 
 import (
+	"fmt"
+	"io"
 	"strings"
 	"testing"
+
+	"github.com/carlosrgl/sitesync/internal/config"
 )
 
 func TestResilientReplaceLine(t *testing.T) {
@@ -110,9 +114,13 @@ func TestResilientReplaceStream(t *testing.T) {
 	input := "s:18:\"http://example.com\";\nplain http://example.com text\n"
 	r := strings.NewReader(input)
 	var sb strings.Builder
-	if err := ResilientReplaceStream("http://example.com", "http://local.test", r, &sb, ReplaceOptions{}); err != nil {
+	st, err := ResilientReplaceStream("http://example.com", "http://local.test", r, &sb, ReplaceOptions{})
+	if err != nil {
 		t.Fatal(err)
 	}
+	if want := (ReplaceStats{Plain: 1, Serialized: 1, Lines: 2}); st != want {
+		t.Errorf("stats = %+v, want %+v", st, want)
+	}
 	out := sb.String()
 	if !strings.Contains(out, `s:17:"http://local.test";`) {
 		t.Errorf("serialized not replaced: %q", out)
@@ -125,12 +133,388 @@ func TestResilientReplaceStream(t *testing.T) {
 func TestResilientReplaceStream_InvalidRegex(t *testing.T) {
 	r := strings.NewReader("some line\n")
 	var sb strings.Builder
-	err := ResilientReplaceStream(`[invalid`, "x", r, &sb, ReplaceOptions{Regex: true})
+	_, err := ResilientReplaceStream(`[invalid`, "x", r, &sb, ReplaceOptions{Regex: true})
 	if err == nil {
 		t.Fatal("expected error for invalid regex, got nil")
 	}
 }
 
+func TestMultiReplacerMatchesSequentialPairs(t *testing.T) {
+	pairs := []config.ReplacePair{
+		{Search: "https://www.example.com", Replace: "http://example.local"},
+		{Search: "https://example.com", Replace: "http://example.local"},
+		// Chained: matches the output of the first two pairs.
+		{Search: "example.local", Replace: "site.test"},
+		{Search: "/var/www/site", Replace: "/home/me/site"},
+	}
+	lines := []string{
+		`INSERT INTO wp_options VALUES (1,'siteurl','https://www.example.com','yes');`,
+		`(1,'x','a:1:{s:3:"url";s:23:"https://www.example.com";}','yes');`,
+		`s:29:"/var/www/site/wp-content/a.b";`,
+		`nothing to see here`,
+		`https://example.com and /var/www/site`,
+		``,
+	}
+
+	m, err := NewMultiReplacer(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range lines {
+		want := line
+		for _, p := range pairs {
+			want = ResilientReplaceLine(p.Search, p.Replace, want, ReplaceOptions{})
+		}
+		if got := m.ReplaceLine(line); got != want {
+			t.Errorf("line %q\ngot  %q\nwant %q", line, got, want)
+		}
+	}
+}
+
+func TestACMatcherContainsAny(t *testing.T) {
+	a := newACMatcher([]string{"he", "she", "hers", "his"})
+	tests := map[string]bool{
+		"ushers":  true,
+		"ahishe":  true,
+		"hxexrs":  false,
+		"":        false,
+		"s h e r": false,
+	}
+	for in, want := range tests {
+		if got := a.containsAny(in); got != want {
+			t.Errorf("containsAny(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestResilientReplaceAllStream(t *testing.T) {
+	pairs := []config.ReplacePair{
+		{Search: "http://example.com", Replace: "http://local.test"},
+		{Search: "local.test", Replace: "dev.test"},
+	}
+	var sb strings.Builder
+	in := "s:18:\"http://example.com\";\nuntouched\n"
+	if err := ResilientReplaceAllStream(pairs, strings.NewReader(in), &sb); err != nil {
+		t.Fatal(err)
+	}
+	want := "s:15:\"http://dev.test\";\nuntouched\n"
+	if sb.String() != want {
+		t.Errorf("got %q, want %q", sb.String(), want)
+	}
+}
+
+func TestMultiReplacerPairOptions(t *testing.T) {
+	pairs := []config.ReplacePair{
+		{Search: "WWW.Example.COM", Replace: "site.test", IgnoreCase: true},
+		{Search: `https?://(cdn\.)?site\.test`, Replace: "http://${1}site.local", Regex: true},
+		{Search: "/uploads/", Replace: "/media/", OnlySerialized: true},
+		{Search: "price", Replace: "$5", IgnoreCase: true},
+	}
+	tests := []struct{ in, want string }{
+		{`'https://www.example.com/'`, `'http://site.local/'`},
+		{`s:27:"https://cdn.www.EXAMPLE.com";`, `s:21:"http://cdn.site.local";`},
+		{`'/uploads/a.jpg' s:14:"/uploads/a.jpg";`, `'/uploads/a.jpg' s:12:"/media/a.jpg";`},
+		{`Price: 3`, `$5: 3`},
+		{`nothing to see here`, `nothing to see here`},
+	}
+
+	m, err := NewMultiReplacer(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := m.ReplaceLine(tt.in); got != tt.want {
+			t.Errorf("ReplaceLine(%q)\ngot  %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMultiReplacerIgnoreCaseNonASCII(t *testing.T) {
+	// The Kelvin sign (U+212A) folds to "k", so ASCII-only prefiltering
+	// must not rule the line out.
+	m, err := NewMultiReplacer([]config.ReplacePair{{Search: "kit", Replace: "set", IgnoreCase: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.ReplaceLine("\u212Ait"), "set"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMultiReplacerEncodedForms(t *testing.T) {
+	pair := config.ReplacePair{Search: "https://www.example.com", Replace: "http://site.test"}
+	tests := []struct{ in, want string }{
+		// json_encode() output, as stored by Gutenberg/Elementor.
+		{`{"url":"https:\/\/www.example.com\/a.jpg"}`, `{"url":"http:\/\/site.test\/a.jpg"}`},
+		// The same JSON inside a mysqldump string literal.
+		{`'{\"url\":\"https:\\/\\/www.example.com\"}'`, `'{\"url\":\"http:\\/\\/site.test\"}'`},
+		{`?redirect=https%3A%2F%2Fwww.example.com%2F`, `?redirect=http%3A%2F%2Fsite.test%2F`},
+		// s:N: counts the unescaped bytes: https:\/\/www.example.com is 25.
+		{`s:25:\"https:\\/\\/www.example.com\";`, `s:18:\"http:\\/\\/site.test\";`},
+	}
+
+	m, err := NewMultiReplacer([]config.ReplacePair{pair})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := m.ReplaceLine(tt.in); got != tt.want {
+			t.Errorf("ReplaceLine(%q)\ngot  %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+
+	// A replacement with more slashes than the search must not count the
+	// doubled backslashes of the dump-escaped form.
+	m, err = NewMultiReplacer([]config.ReplacePair{{Search: "https://www.example.com", Replace: "http://site.test/sub"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, want := `s:25:\"https:\\/\\/www.example.com\";`, `s:23:\"http:\\/\\/site.test\\/sub\";`
+	if got := m.ReplaceLine(in); got != want {
+		t.Errorf("ReplaceLine(%q)\ngot  %q\nwant %q", in, got, want)
+	}
+
+	pair.SkipEncoded = true
+	m, err = NewMultiReplacer([]config.ReplacePair{pair})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := m.ReplaceLine(tt.in); got != tt.in {
+			t.Errorf("SkipEncoded: ReplaceLine(%q) = %q, want unchanged", tt.in, got)
+		}
+	}
+}
+
+func TestMultiReplacerStats(t *testing.T) {
+	pairs := []config.ReplacePair{
+		{Search: "https://a.test", Replace: "http://b.test"},
+		{Search: "typo.test", Replace: "x"},
+		{Search: `/v\d/`, Replace: "/v9/", Regex: true},
+	}
+	m, err := NewMultiReplacer(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`'https://a.test/v1/','s:14:"https://a.test";'`,
+		`{"u":"https:\/\/a.test"}`,
+		`untouched`,
+	} {
+		m.ReplaceLine(line)
+	}
+
+	want := []ReplaceStats{
+		// The JSON-escaped form counts towards the pair it derives from.
+		{Plain: 2, Serialized: 1, Lines: 2},
+		{},
+		{Plain: 1, Lines: 1},
+	}
+	got := m.Stats()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("pair %d stats = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMultiReplacerTableScopes(t *testing.T) {
+	pairs := []config.ReplacePair{
+		{Search: "a.test", Replace: "b.test", ExcludeTables: []string{"wp_users.user_email", "wp_*_log"}},
+		{Search: "secret", Replace: "xxx", Tables: []string{"wp_options"}},
+	}
+	tests := []struct{ in, want string }{
+		{"INSERT INTO `wp_users` (`ID`, `user_url`, `user_email`) VALUES (1,'http://a.test','me@a.test'),(2,'a.test, (x)','you@a.test');",
+			"INSERT INTO `wp_users` (`ID`, `user_url`, `user_email`) VALUES (1,'http://b.test','me@a.test'),(2,'b.test, (x)','you@a.test');"},
+		{"INSERT INTO `wp_audit_log` VALUES (1,'a.test','secret');", "INSERT INTO `wp_audit_log` VALUES (1,'a.test','secret');"},
+		{"INSERT INTO `wp_options` VALUES (1,'a.test','secret');", "INSERT INTO `wp_options` VALUES (1,'b.test','xxx');"},
+		// Row continuation lines keep the context of their INSERT.
+		{"(2,'a.test','secret');", "(2,'b.test','xxx');"},
+		{"CREATE VIEW v AS SELECT 'a.test', 'secret';", "CREATE VIEW v AS SELECT 'b.test', 'secret';"},
+	}
+
+	m, err := NewMultiReplacer(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := m.ReplaceLine(tt.in); got != tt.want {
+			t.Errorf("ReplaceLine(%q)\ngot  %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+	if err := m.errNoColumns(); err != nil {
+		t.Errorf("errNoColumns() = %v, want nil", err)
+	}
+
+	// Without --complete-insert the column entry cannot be honoured, and
+	// the stream fails instead of excluding the whole table.
+	in := "INSERT INTO `wp_options` VALUES (1,'a.test');\nINSERT INTO `wp_users` VALUES (1,'http://a.test','me@a.test');\n"
+	for _, workers := range []int{1, 4} {
+		m, err := NewMultiReplacer(pairs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.ReplaceStreamParallel(strings.NewReader(in), io.Discard, workers)
+		if err == nil || !strings.Contains(err.Error(), "table wp_users") {
+			t.Errorf("%d worker(s): ReplaceStreamParallel error = %v, want one naming wp_users", workers, err)
+		}
+	}
+}
+
+func TestReplaceStreamLongLineLongSearch(t *testing.T) {
+	// The search, and even more its JSON-escaped form, is longer than a
+	// quarter of a piece, so matches straddle the piece boundaries.
+	pairs := []config.ReplacePair{{Search: "https://www.example.com/wp-content/uploads", Replace: "http://site.test/media"}}
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO `wp_posts` VALUES ")
+	for i := range 30 {
+		fmt.Fprintf(&sb, `(%d,'%s https://www.example.com/wp-content/uploads/a.jpg','{\"u\":\"https:\\/\\/www.example.com\\/wp-content\\/uploads\"}'),`,
+			i, strings.Repeat("x", i))
+	}
+	sb.WriteString("(0,'');\n")
+	input := sb.String()
+
+	replace := func() string {
+		m, err := NewMultiReplacer(pairs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		if err := m.ReplaceStream(strings.NewReader(input), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	want := replace()
+	if strings.Contains(want, "example.com") {
+		t.Fatalf("reference output is incomplete: %.300q", want)
+	}
+
+	defer func(n int) { maxLinePiece = n }(maxLinePiece)
+	maxLinePiece = 64
+	if got := replace(); got != want {
+		t.Fatalf("output differs from whole-line processing\ngot  %.400q\nwant %.400q", got, want)
+	}
+}
+
+func TestReplaceStreamParallelMatchesSequential(t *testing.T) {
+	defer func(n int) { replaceChunkSize = n }(replaceChunkSize)
+	replaceChunkSize = 256
+
+	pairs := []config.ReplacePair{
+		{Search: "https://www.example.com", Replace: "http://site.test"},
+		{Search: "site.test", Replace: "mysite.local"},
+		{Search: "secret", Replace: "xxx", Tables: []string{"wp_options"}},
+	}
+	var sb strings.Builder
+	sb.WriteString("-- MySQL dump\r\n")
+	for i := range 200 {
+		table := []string{"wp_options", "wp_posts"}[i%2]
+		fmt.Fprintf(&sb, "INSERT INTO `%s` VALUES (%d,'s:23:\\\"https://www.example.com\\\";','secret'),\n", table, i)
+		fmt.Fprintf(&sb, "(%d,'https:\\/\\/www.example.com','secret');\n", i)
+		if i%7 == 0 {
+			sb.WriteString("  SELECT 'secret';\n\n")
+		}
+	}
+	sb.WriteString("UNLOCK TABLES; -- no trailing newline, secret")
+	input := sb.String()
+
+	seq, err := NewMultiReplacer(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want strings.Builder
+	if err := seq.ReplaceStream(strings.NewReader(input), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	par, err := NewMultiReplacer(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got strings.Builder
+	if err := par.ReplaceStreamParallel(strings.NewReader(input), &got, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.String() != want.String() {
+		t.Fatalf("parallel output differs from sequential:\ngot  %q\nwant %q", got.String(), want.String())
+	}
+	if gs, ws := par.Stats(), seq.Stats(); fmt.Sprint(gs) != fmt.Sprint(ws) {
+		t.Errorf("parallel stats = %v, want %v", gs, ws)
+	}
+}
+
+func TestReplaceStreamLongLines(t *testing.T) {
+	pairs := []config.ReplacePair{
+		{Search: "https://www.example.com", Replace: "http://site.test"},
+		{Search: "site.test", Replace: "mysite.local"},
+		{Search: "secret", Replace: "xxx", Tables: []string{"wp_options.option_value"}},
+	}
+	long := strings.Repeat("lorem ipsum ", 60)
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO `wp_posts` VALUES ")
+	for i := range 40 {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		// Serialized strings longer than a piece, with matches near both
+		// ends, in both quoting styles; a header that never closes; and
+		// plain matches in between.
+		body := "https://www.example.com/" + long + "https://www.example.com/end"
+		fmt.Fprintf(&sb, "(%d,'s:%d:\\\"%s\\\";','a:1:{s:3:\"url\";s:%d:\"%s\";}','s:9:\"no close %s','https://www.example.com')",
+			i, len(body), body, len(body), body, long)
+	}
+	sb.WriteString(";\r\n")
+	sb.WriteString("INSERT INTO `wp_options` (`option_name`, `option_value`) VALUES ")
+	for i := range 40 {
+		fmt.Fprintf(&sb, "('secret_%d','s:%d:\\\"%s secret\\\";'),", i, len(long)+7, long)
+	}
+	sb.WriteString("('last','secret');\n")
+	sb.WriteString("-- short line https://www.example.com\n")
+	input := sb.String()
+
+	replace := func(parallel bool) (string, []ReplaceStats) {
+		m, err := NewMultiReplacer(pairs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out strings.Builder
+		if parallel {
+			err = m.ReplaceStreamParallel(strings.NewReader(input), &out, 3)
+		} else {
+			err = m.ReplaceStream(strings.NewReader(input), &out)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.String(), m.Stats()
+	}
+
+	want, wantStats := replace(false)
+	if strings.Contains(want, "www.example.com") || strings.Count(want, "xxx") != 41 {
+		t.Fatalf("reference output is incomplete: %.300q", want)
+	}
+
+	defer func(n, c int) { maxLinePiece, replaceChunkSize = n, c }(maxLinePiece, replaceChunkSize)
+	maxLinePiece, replaceChunkSize = 256, 256
+	for _, parallel := range []bool{false, true} {
+		got, stats := replace(parallel)
+		if got != want {
+			t.Fatalf("parallel=%v: output differs from whole-line processing", parallel)
+		}
+		if fmt.Sprint(stats) != fmt.Sprint(wantStats) {
+			t.Errorf("parallel=%v: stats = %v, want %v", parallel, stats, wantStats)
+		}
+	}
+	var issues []string
+	if err := VerifySerialized(strings.NewReader(want), func(si SerialIssue) {
+		issues = append(issues, si.String())
+	}); err != nil || len(issues) > 0 {
+		t.Errorf("VerifySerialized() = %v, %v", err, issues)
+	}
+}
+
 // BenchmarkResilientReplaceFile measures the cost of running ResilientReplaceLine
 // across many lines — representative of processing a real SQL dump.
 func BenchmarkResilientReplaceLine(b *testing.B) {
@@ -155,7 +539,7 @@ func BenchmarkResilientReplaceLineRegex_Stream(b *testing.B) {
 	b.ResetTimer()
 	for range b.N {
 		sb.Reset()
-		_ = ResilientReplaceStream(`https?://`, "http://", strings.NewReader(input), &sb, opts)
+		_, _ = ResilientReplaceStream(`https?://`, "http://", strings.NewReader(input), &sb, opts)
 	}
 }
 
@@ -0,0 +1,181 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// RunState records how far a run got, so that a later run of the same op
+// can skip the steps already done. It is saved after every completed step
+// and removed when the run succeeds.
+type RunState struct {
+	Op         Op        `json:"op"`
+	Steps      Steps     `json:"steps"`
+	Done       []int     `json:"done"`
+	DumpPath   string    `json:"dump_path,omitempty"` // dump the remaining steps read
+	DumpSize   int64     `json:"dump_size,omitempty"`
+	DumpMTime  time.Time `json:"dump_mtime"`
+	DumpSHA256 string    `json:"dump_sha256,omitempty"` // set once the run stops
+	ConfigHash string    `json:"config_hash"`
+	Updated    time.Time `json:"updated"`
+}
+
+// RunStatePath returns the run-state file of a config inside tmpDir.
+func RunStatePath(tmpDir, confName string) string {
+	return filepath.Join(tmpDir, confName+".run.json")
+}
+
+// NextStep returns the first selected step not done yet.
+func (rs *RunState) NextStep() int {
+	for step := 1; step <= 7; step++ {
+		if rs.Steps.Has(step) && !slices.Contains(rs.Done, step) {
+			return step
+		}
+	}
+	return 8
+}
+
+// Resumable returns the run state left by an interrupted run of steps of op
+// on the named config, or nil when there is none or it cannot be resumed.
+// Only the size and modification time of the dump are compared; the checksum
+// is left to Run, since reading a large dump takes a while.
+func Resumable(cfg *config.Config, name string, op Op, steps Steps) *RunState {
+	rs, err := loadRunState(RunStatePath(config.TmpDir(), name))
+	if err != nil || rs.check(cfg, op, steps, false) != nil {
+		return nil
+	}
+	return rs
+}
+
+func loadRunState(path string) (*RunState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rs RunState
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	return &rs, nil
+}
+
+// noteDump records the dump the remaining steps read by its size and
+// modification time, which are cheap to compare. An empty path clears it.
+func (rs *RunState) noteDump(path string) {
+	rs.DumpPath, rs.DumpSize, rs.DumpMTime, rs.DumpSHA256 = path, 0, time.Time{}, ""
+	if path == "" {
+		return
+	}
+	if fi, err := os.Stat(path); err == nil {
+		rs.DumpSize, rs.DumpMTime = fi.Size(), fi.ModTime()
+	}
+}
+
+// sealDump checksums the dump once the run stops with steps left, so that
+// --resume can also tell a dump rewritten in place. A dump that already
+// changed since its step was done is left without a checksum, which makes
+// the state not resumable.
+func (rs *RunState) sealDump() {
+	rs.DumpSHA256 = ""
+	if rs.DumpPath == "" || rs.statDump() != nil {
+		return
+	}
+	rs.DumpSHA256, _ = fileSHA256(rs.DumpPath)
+}
+
+// statDump explains why the dump no longer matches its recorded size and
+// modification time.
+func (rs *RunState) statDump() error {
+	fi, err := os.Stat(rs.DumpPath)
+	if err != nil {
+		return fmt.Errorf("dump of the previous run: %w", err)
+	}
+	if fi.Size() != rs.DumpSize || !fi.ModTime().Equal(rs.DumpMTime) {
+		return fmt.Errorf("%s changed since the previous run", filepath.Base(rs.DumpPath))
+	}
+	return nil
+}
+
+func (rs *RunState) save(path string) error {
+	rs.Updated = time.Now()
+	data, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// check explains why rs cannot be resumed by a run of steps of op with cfg:
+// another op or other steps, a changed config, or a dump that is gone or was
+// modified since, which verifyDump also checks by its checksum.
+func (rs *RunState) check(cfg *config.Config, op Op, steps Steps, verifyDump bool) error {
+	if rs.Op != op {
+		return fmt.Errorf("the previous run was %s", rs.Op)
+	}
+	if rs.Steps != steps {
+		return fmt.Errorf("the previous run was of steps %s", rs.Steps)
+	}
+	if len(rs.Done) == 0 || rs.NextStep() > 7 {
+		return errors.New("nothing to resume")
+	}
+	hash, err := configHash(cfg)
+	if err != nil {
+		return err
+	}
+	if hash != rs.ConfigHash {
+		return errors.New("the config changed since the previous run")
+	}
+	if rs.DumpPath == "" {
+		return nil
+	}
+	if err := rs.statDump(); err != nil {
+		return err
+	}
+	if verifyDump {
+		sum, err := fileSHA256(rs.DumpPath)
+		if err != nil {
+			return fmt.Errorf("dump of the previous run: %w", err)
+		}
+		if sum != rs.DumpSHA256 {
+			return fmt.Errorf("%s changed since the previous run", filepath.Base(rs.DumpPath))
+		}
+	}
+	return nil
+}
+
+// configHash identifies the settings a run depends on.
+func configHash(cfg *config.Config) (string, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
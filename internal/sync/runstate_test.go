@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+	"github.com/carlosrgl/sitesync/internal/logger"
+)
+
+func TestRunStateCheck(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Destination.DBName = "shop_local"
+	dump := filepath.Join(dir, "shop.sql")
+	if err := os.WriteFile(dump, []byte("INSERT INTO t VALUES (1);\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := configHash(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &RunState{Op: OpAll, Steps: AllSteps, Done: []int{1, 2, 3}, ConfigHash: hash}
+	rs.noteDump(dump)
+	if rs.DumpSHA256 != "" {
+		t.Fatal("noteDump checksummed the dump")
+	}
+	rs.sealDump()
+	if sum, _ := fileSHA256(dump); rs.DumpSHA256 != sum {
+		t.Fatalf("sealDump checksum = %q, want %q", rs.DumpSHA256, sum)
+	}
+	path := RunStatePath(dir, "shop")
+	if err := rs.save(path); err != nil {
+		t.Fatal(err)
+	}
+	rs, err = loadRunState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.NextStep() != 4 {
+		t.Fatalf("NextStep() = %d, want 4", rs.NextStep())
+	}
+	if err := rs.check(&cfg, OpAll, AllSteps, true); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+
+	cases := []struct {
+		name  string
+		setup func(cfg *config.Config, rs *RunState)
+		want  string
+	}{
+		{"other op", func(_ *config.Config, _ *RunState) {}, "previous run was"},
+		{"other steps", func(_ *config.Config, rs *RunState) { rs.Steps = StepsOf(1, 2, 3) }, "previous run was of steps 1,2,3"},
+		{"config changed", func(cfg *config.Config, _ *RunState) { cfg.Destination.DBName = "shop_dev" }, "config changed"},
+		{"all done", func(_ *config.Config, rs *RunState) { rs.Done = []int{1, 2, 3, 4, 5, 6, 7} }, "nothing to resume"},
+		{"dump modified", func(_ *config.Config, rs *RunState) { rs.DumpSHA256 = "0000" }, "changed since"},
+		{"dump gone", func(_ *config.Config, rs *RunState) { rs.DumpPath = filepath.Join(dir, "gone.sql") }, "dump of the previous run"},
+		{"dump resized", func(_ *config.Config, rs *RunState) { rs.DumpSize++ }, "changed since"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, r := cfg, *rs
+			tc.setup(&c, &r)
+			op := OpAll
+			if tc.name == "other op" {
+				op = OpSQL
+			}
+			err := r.check(&c, op, AllSteps, true)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("check = %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+
+	// Without verifyDump a modified dump is left for Run to find.
+	r := *rs
+	r.DumpSHA256 = "0000"
+	if err := r.check(&cfg, OpAll, AllSteps, false); err != nil {
+		t.Fatalf("check without verifyDump: %v", err)
+	}
+
+	// A dump rewritten after its step was done is not sealed.
+	r = *rs
+	if err := os.WriteFile(dump, []byte("INSERT INTO t VALUES (2), (3);\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r.sealDump()
+	if r.DumpSHA256 != "" {
+		t.Fatal("sealDump checksummed a dump that changed since its step")
+	}
+	if err := r.check(&cfg, OpAll, AllSteps, false); err == nil || !strings.Contains(err.Error(), "changed since") {
+		t.Fatalf("check of a rewritten dump = %v, want an error containing %q", err, "changed since")
+	}
+}
+
+func TestRunKeepsCompressedFetchWhenStep2Fails(t *testing.T) {
+	etc := t.TempDir()
+	t.Setenv("SITESYNC_ETC", etc)
+	dir := filepath.Join(etc, "shop")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	conf := "[source]\ntype = \"remote_base\"\ncompress = true\n\n[database]\nverify_serialized = true\n\n[run]\non_error = \"abort\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := config.TmpDir()
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	fetch := FetchFilePath(cfg, DumpFilePath(tmpDir, "shop"))
+	f, err := os.Create(fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(f)
+	// The serialized length is wrong, so verify_serialized fails step 2.
+	fmt.Fprintln(gw, `INSERT INTO wp_options VALUES (1,'a:1:{s:3:"abcd";i:1;}');`)
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	eventCh := make(chan Event, 64)
+	go Run(context.Background(), cfg, OpSQL, Options{Steps: StepsOf(2)}, eventCh, logger.Discard())
+	failed := false
+	for ev := range eventCh {
+		failed = failed || ev.Type == EvStepFail && ev.Step == 2
+	}
+	if !failed {
+		t.Fatal("step 2 did not fail")
+	}
+	if _, err := os.Stat(fetch); err != nil {
+		t.Fatalf("compressed fetch removed by the failed step: %v", err)
+	}
+}
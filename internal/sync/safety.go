@@ -0,0 +1,123 @@
+package sync
+
+import (
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// SafetyIssue is one reason the destination does not look like a local
+// development environment.
+type SafetyIssue struct {
+	Field  string // config key at fault, e.g. destination.db_name
+	Reason string
+}
+
+func (si SafetyIssue) String() string {
+	return si.Field + ": " + si.Reason
+}
+
+// systemDirs are never valid sync destinations, nor is anything below them.
+var systemDirs = []string{"/bin", "/boot", "/dev", "/etc", "/lib", "/lib64", "/proc", "/sbin", "/sys", "/usr", "/System"}
+
+// CheckSafety returns every reason the destination of the steps of op looks
+// unsafe to overwrite: a non-local database host that is not in
+// safety.allowed_hosts, a protected database name or the source database
+// itself when step 4 runs, and file destinations such as / or the home
+// directory when step 6 runs. For OpPush the destinations are the [[sync]]
+// src directories on the server.
+func CheckSafety(cfg *config.Config, op Op, steps Steps) []SafetyIssue {
+	var issues []SafetyIssue
+	if op == OpPush {
+		if !steps.Has(6) {
+			return nil
+		}
+		// A push writes to the server. Its database is guarded by
+		// safety.allow_push and the typed confirmation, so only the
+		// directories it writes to are checked here.
+		for _, sp := range cfg.Sync {
+			if reason := dangerousDir(sp.Src); reason != "" {
+				issues = append(issues, SafetyIssue{"sync.src", sp.Src + " " + reason})
+			}
+		}
+		return issues
+	}
+	if steps.Has(4) {
+		dst := cfg.Destination
+		if !isLocalHost(dst.DBHostname) && !matchAny(cfg.Safety.AllowedHosts, dst.DBHostname) {
+			issues = append(issues, SafetyIssue{"destination.db_hostname",
+				dst.DBHostname + " is not a local host (add it to safety.allowed_hosts if it is a dev server)"})
+		}
+		switch {
+		case dst.DBName != "" && strings.EqualFold(dst.DBName, cfg.Source.DBName):
+			issues = append(issues, SafetyIssue{"destination.db_name",
+				dst.DBName + " is also the source database"})
+		case matchAny(cfg.Safety.ProtectedDBs, dst.DBName):
+			issues = append(issues, SafetyIssue{"destination.db_name",
+				dst.DBName + " matches safety.protected_dbs"})
+		}
+	}
+	if steps.Has(6) {
+		roots := []struct{ field, dir string }{{"destination.files_root", cfg.Destination.FilesRoot}}
+		for _, sp := range cfg.Sync {
+			roots = append(roots, struct{ field, dir string }{"sync.dst", sp.Dst})
+		}
+		for _, r := range roots {
+			if reason := dangerousDir(r.dir); reason != "" {
+				issues = append(issues, SafetyIssue{r.field, r.dir + " " + reason})
+			}
+		}
+	}
+	return issues
+}
+
+// isLocalHost reports whether a MySQL host refers to this machine.
+func isLocalHost(host string) bool {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// matchAny reports whether name matches one of the glob patterns, ignoring
+// case.
+func matchAny(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dangerousDir explains why dir must not be overwritten by a sync, or
+// returns "" when it looks like a project directory. Relative paths are
+// left alone.
+func dangerousDir(dir string) string {
+	if !filepath.IsAbs(dir) {
+		return ""
+	}
+	dir = filepath.Clean(dir)
+	if dir == "/" {
+		return "is the filesystem root"
+	}
+	if home, err := os.UserHomeDir(); err == nil && dir == filepath.Clean(home) {
+		return "is the home directory"
+	}
+	for _, sys := range systemDirs {
+		if dir == sys || strings.HasPrefix(dir, sys+"/") {
+			return "is a system directory"
+		}
+	}
+	if strings.Count(dir, "/") < 2 {
+		return "is a top-level directory"
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"os"
+	"testing"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+func TestCheckSafety(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+
+	base := func() *config.Config {
+		cfg := config.DefaultConfig()
+		cfg.Source.DBName = "shop_prod"
+		cfg.Destination.DBName = "shop_local"
+		cfg.Destination.FilesRoot = "/var/www/shop"
+		cfg.Sync = []config.SyncPair{{Src: "/srv/shop", Dst: "/var/www/shop"}}
+		return &cfg
+	}
+
+	tests := []struct {
+		name   string
+		op     Op
+		steps  Steps
+		edit   func(*config.Config)
+		fields []string
+	}{
+		{name: "local", edit: func(*config.Config) {}},
+		{name: "loopback ip", edit: func(c *config.Config) { c.Destination.DBHostname = "127.0.0.1" }},
+		{name: "remote host", edit: func(c *config.Config) { c.Destination.DBHostname = "db.example.com" },
+			fields: []string{"destination.db_hostname"}},
+		{name: "allowed host", edit: func(c *config.Config) {
+			c.Destination.DBHostname = "mysql"
+			c.Safety.AllowedHosts = []string{"mysql", "*.docker"}
+		}},
+		{name: "protected db", edit: func(c *config.Config) { c.Destination.DBName = "Shop_PROD" },
+			fields: []string{"destination.db_name"}},
+		{name: "source db", edit: func(c *config.Config) { c.Destination.DBName = "shop"; c.Source.DBName = "shop" },
+			fields: []string{"destination.db_name"}},
+		{name: "root files", edit: func(c *config.Config) { c.Destination.FilesRoot = "/" },
+			fields: []string{"destination.files_root"}},
+		{name: "home and system dirs", edit: func(c *config.Config) {
+			c.Sync = append(c.Sync, config.SyncPair{Dst: home + "/"}, config.SyncPair{Dst: "/etc/nginx"}, config.SyncPair{Dst: "/var"})
+		}, fields: []string{"sync.dst", "sync.dst", "sync.dst"}},
+		{name: "files only ignores db", op: OpFiles, edit: func(c *config.Config) { c.Destination.DBHostname = "db.example.com" }},
+		{name: "sql only ignores files", op: OpSQL, edit: func(c *config.Config) { c.Destination.FilesRoot = "/" }},
+		{name: "hooks only ignore db and files", steps: StepsOf(3, 5, 7), edit: func(c *config.Config) {
+			c.Destination.DBHostname = "db.example.com"
+			c.Destination.FilesRoot = "/"
+		}},
+		{name: "push checks remote dirs", op: OpPush, edit: func(c *config.Config) {
+			c.Destination.DBHostname = "db.example.com"
+			c.Sync = append(c.Sync, config.SyncPair{Src: "/etc"})
+		}, fields: []string{"sync.src"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base()
+			tt.edit(cfg)
+			issues := CheckSafety(cfg, tt.op, tt.op.Select(tt.steps))
+			if len(issues) != len(tt.fields) {
+				t.Fatalf("CheckSafety() = %v, want issues on %v", issues, tt.fields)
+			}
+			for i, issue := range issues {
+				if issue.Field != tt.fields[i] {
+					t.Fatalf("issue %d = %v, want field %s", i, issue, tt.fields[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// Snapshot is a compressed dump of the destination database taken right
+// before an import overwrote it. Snapshots live in config.SnapshotDir as
+// {ID}_{db}.sql.gz.
+type Snapshot struct {
+	ID      string // creation time, e.g. 20261016-153045, then -2, -3… for more in the same second
+	DB      string // destination database the dump was taken from
+	Path    string
+	Size    int64
+	Created time.Time
+
+	seq int // rank among the snapshots taken in the same second
+}
+
+const (
+	snapshotIDLayout = "20060102-150405"
+	snapshotExt      = ".sql.gz"
+)
+
+// ListSnapshots returns the snapshots of the named config, newest first.
+func ListSnapshots(name string) ([]Snapshot, error) {
+	dir := config.SnapshotDir(name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading snapshots: %w", err)
+	}
+
+	var snaps []Snapshot
+	for _, e := range entries {
+		base, ok := strings.CutSuffix(e.Name(), snapshotExt)
+		if !ok || e.IsDir() {
+			continue // includes unfinished .part files
+		}
+		id, db, ok := strings.Cut(base, "_")
+		if !ok {
+			continue
+		}
+		created, seq, err := parseSnapshotID(id)
+		if err != nil {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, Snapshot{
+			ID:      id,
+			DB:      db,
+			Path:    filepath.Join(dir, e.Name()),
+			Size:    fi.Size(),
+			Created: created,
+			seq:     seq,
+		})
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		if !snaps[i].Created.Equal(snaps[j].Created) {
+			return snaps[i].Created.After(snaps[j].Created)
+		}
+		return snaps[i].seq > snaps[j].seq
+	})
+	return snaps, nil
+}
+
+// parseSnapshotID returns the creation time of a snapshot ID and its rank
+// among the snapshots of the same second, 1 for the first.
+func parseSnapshotID(id string) (time.Time, int, error) {
+	stamp, suffix := id, ""
+	if len(id) > len(snapshotIDLayout) {
+		stamp, suffix = id[:len(snapshotIDLayout)], id[len(snapshotIDLayout):]
+	}
+	created, err := time.ParseInLocation(snapshotIDLayout, stamp, time.Local)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	if suffix == "" {
+		return created, 1, nil
+	}
+	seq, err := strconv.Atoi(strings.TrimPrefix(suffix, "-"))
+	if err != nil || !strings.HasPrefix(suffix, "-") || seq < 2 {
+		return time.Time{}, 0, fmt.Errorf("invalid snapshot ID %q", id)
+	}
+	return created, seq, nil
+}
+
+// FindSnapshot returns the snapshot with the given ID, or the most recent
+// one when id is empty.
+func FindSnapshot(name, id string) (Snapshot, error) {
+	snaps, err := ListSnapshots(name)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(snaps) == 0 {
+		return Snapshot{}, fmt.Errorf("no snapshots for %s", name)
+	}
+	if id == "" {
+		return snaps[0], nil
+	}
+	for _, s := range snaps {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return Snapshot{}, fmt.Errorf("snapshot %q not found for %s (see sitesync snapshots --conf=%s)", id, name, name)
+}
+
+// TakeSnapshot dumps the destination database to a new gzip snapshot of
+// the named config, then prunes the oldest ones beyond
+// database.snapshot_keep. A destination database that does not exist yet
+// (first sync) has nothing to lose and is skipped with a warning; the server
+// is asked first, so a failed dump is never mistaken for one.
+func TakeSnapshot(ctx context.Context, cfg *config.Config, name string, eventCh chan<- Event, step int) error {
+	sendLog := func(msg string) {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: msg})
+	}
+
+	db := cfg.Destination.DBName
+	exists, err := destDBExists(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("snapshot of %s failed (set snapshot_keep = 0 to disable): %w", db, err)
+	}
+	if !exists {
+		sendLog(fmt.Sprintf("  ⚠ %s does not exist yet, nothing to snapshot", db))
+		return nil
+	}
+
+	dir := config.SnapshotDir(name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("create snapshot dir: %w", err)
+	}
+	path, err := newSnapshotPath(dir, db, time.Now())
+	if err != nil {
+		return err
+	}
+	// Dump to a .part file so an interrupted snapshot is never listed.
+	part := path + ".part"
+
+	sendLog(fmt.Sprintf("  snapshot: %s → %s", db, filepath.Base(path)))
+	if err := runDump(ctx, cfg, buildSnapshotArgs(cfg), part, true, sendLog); err != nil {
+		_ = os.Remove(part)
+		return fmt.Errorf("snapshot of %s failed (set snapshot_keep = 0 to disable): %w", db, err)
+	}
+	if err := os.Rename(part, path); err != nil {
+		_ = os.Remove(part)
+		return fmt.Errorf("save snapshot: %w", err)
+	}
+	if fi, err := os.Stat(path); err == nil {
+		sendLog(fmt.Sprintf("  snapshot size: %s", humanSize(fi.Size())))
+	}
+
+	removed, err := pruneSnapshots(name, cfg.Database.SnapshotKeep)
+	for _, s := range removed {
+		sendLog(fmt.Sprintf("  removed old snapshot %s", s.ID))
+	}
+	if err != nil {
+		sendLog(fmt.Sprintf("  ⚠ cannot prune snapshots: %v", err))
+	}
+	return nil
+}
+
+// destDBExists asks the destination server whether its database exists.
+func destDBExists(ctx context.Context, cfg *config.Config) (bool, error) {
+	q := "SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = " + sqlQuote(cfg.Destination.DBName)
+	args := append(append([]string{"-N", "-B"}, destConnArgs(cfg)...), "-e", q)
+	out, err := exec.CommandContext(ctx, mysqlBin(cfg), args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return false, fmt.Errorf("look up %s: %w", cfg.Destination.DBName, err)
+	}
+	return strings.TrimSpace(string(out)) != "0", nil
+}
+
+// newSnapshotPath returns the path of a new snapshot of db and reserves its
+// .part file. A snapshot already taken in the same second gets -2, -3… added
+// to the ID instead of being overwritten.
+func newSnapshotPath(dir, db string, now time.Time) (string, error) {
+	stamp := now.Format(snapshotIDLayout)
+	id := stamp
+	for seq := 2; ; seq++ {
+		if taken, _ := filepath.Glob(filepath.Join(dir, id+"_*")); len(taken) == 0 {
+			path := filepath.Join(dir, id+"_"+db+snapshotExt)
+			f, err := os.OpenFile(path+".part", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err == nil {
+				return path, f.Close()
+			}
+			if !os.IsExist(err) {
+				return "", fmt.Errorf("create snapshot: %w", err)
+			}
+		}
+		id = fmt.Sprintf("%s-%d", stamp, seq)
+	}
+}
+
+// buildSnapshotArgs returns the mysqldump arguments for a snapshot of the
+// destination database. --databases with --add-drop-database makes the
+// restore drop and recreate the database, so tables the sync added are
+// removed too.
+func buildSnapshotArgs(cfg *config.Config) []string {
+	args := []string{"--single-transaction", "--routines", "--add-drop-database"}
+	args = append(args, destConnArgs(cfg)...)
+	return append(args, "--databases", cfg.Destination.DBName)
+}
+
+// pruneSnapshots deletes all but the keep most recent snapshots of the
+// named config and returns the ones it removed.
+func pruneSnapshots(name string, keep int) ([]Snapshot, error) {
+	snaps, err := ListSnapshots(name)
+	if err != nil || len(snaps) <= keep {
+		return nil, err
+	}
+	var removed []Snapshot
+	for _, s := range snaps[max(keep, 0):] {
+		if err := os.Remove(s.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, s)
+	}
+	return removed, nil
+}
+
+// RestoreSnapshot imports snap into the destination database, printing
+// progress to stdout. Used by the rollback subcommand. The snapshot drops,
+// creates and selects its database itself, so mysql connects without one
+// and the rollback works when that database is gone.
+func RestoreSnapshot(ctx context.Context, cfg *config.Config, snap Snapshot) error {
+	eventCh := make(chan Event, 64)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(eventCh)
+		errCh <- importDump(ctx, cfg, snap.Path, "", eventCh, 0)
+	}()
+
+	for ev := range eventCh {
+		switch ev.Type {
+		case EvProgress:
+			fmt.Printf("\r       %3.0f%%", ev.Progress*100)
+		case EvLog:
+			fmt.Println("    " + ev.Message)
+		}
+	}
+	return <-errCh
+}
+
+// PrintSnapshots writes the snapshots of the named config as a table.
+func PrintSnapshots(w io.Writer, name string, snaps []Snapshot) {
+	fmt.Fprintf(w, "  %s\n", name)
+	if len(snaps) == 0 {
+		fmt.Fprintln(w, "    (no snapshots)")
+		return
+	}
+	fmt.Fprintf(w, "    %-17s  %-19s  %10s  %s\n", "ID", "Created", "Size", "Database")
+	for _, s := range snaps {
+		fmt.Fprintf(w, "    %-17s  %-19s  %10s  %s\n",
+			s.ID, s.Created.Format("2006-01-02 15:04:05"), humanSize(s.Size), s.DB)
+	}
+}
@@ -0,0 +1,203 @@
+package sync
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// fakeMysqldump writes a stand-in mysqldump binary that runs script.
+func fakeMysqldump(t *testing.T, script string) string {
+	t.Helper()
+	return fakeBin(t, "mysqldump", script)
+}
+
+// fakeMysql writes a stand-in mysql binary answering whether the database
+// exists with count.
+func fakeMysql(t *testing.T, count string) string {
+	t.Helper()
+	return fakeBin(t, "mysql", "echo "+count+"\n")
+}
+
+func fakeBin(t *testing.T, name, script string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"+script), 0700); err != nil {
+		t.Fatalf("write fake %s: %v", name, err)
+	}
+	return bin
+}
+
+func TestTakeSnapshotPrunesOldest(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	dir := config.SnapshotDir("site")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"20240101-000000_site_local.sql.gz",
+		"20240102-000000_site_local.sql.gz",
+		"20240103-000000_site_local.sql.gz.part",
+		"notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &config.Config{
+		Destination: config.DestConfig{
+			DBHostname:      "localhost",
+			DBName:          "site_local",
+			PathToMySQL:     fakeMysql(t, "1"),
+			PathToMysqldump: fakeMysqldump(t, "echo \"CREATE TABLE t (id int);\"\n"),
+		},
+		Database: config.DatabaseConfig{SnapshotKeep: 2},
+	}
+	eventCh := make(chan Event, 64)
+	if err := TakeSnapshot(context.Background(), cfg, "site", eventCh, 4); err != nil {
+		t.Fatalf("TakeSnapshot returned error: %v", err)
+	}
+
+	snaps, err := ListSnapshots("site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 || snaps[1].ID != "20240102-000000" || snaps[0].DB != "site_local" {
+		t.Fatalf("snapshots after prune = %+v", snaps)
+	}
+
+	f, err := os.Open(snaps[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(gr)
+	if string(got) != "CREATE TABLE t (id int);\n" {
+		t.Fatalf("snapshot content = %q", got)
+	}
+
+	latest, err := FindSnapshot("site", "")
+	if err != nil || latest.ID != snaps[0].ID {
+		t.Fatalf("FindSnapshot(\"\") = %+v, %v", latest, err)
+	}
+	if _, err := FindSnapshot("site", "20240101-000000"); err == nil {
+		t.Fatal("FindSnapshot found a pruned snapshot")
+	}
+}
+
+func TestTakeSnapshotSkipsMissingDatabase(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	cfg := &config.Config{
+		Destination: config.DestConfig{
+			DBHostname:      "localhost",
+			DBName:          "site_local",
+			PathToMySQL:     fakeMysql(t, "0"),
+			PathToMysqldump: fakeMysqldump(t, "exit 1\n"),
+		},
+		Database: config.DatabaseConfig{SnapshotKeep: 3},
+	}
+	eventCh := make(chan Event, 64)
+	if err := TakeSnapshot(context.Background(), cfg, "site", eventCh, 4); err != nil {
+		t.Fatalf("TakeSnapshot returned error: %v", err)
+	}
+	if snaps, _ := ListSnapshots("site"); len(snaps) != 0 {
+		t.Fatalf("snapshots = %+v, want none", snaps)
+	}
+	entries, _ := os.ReadDir(config.SnapshotDir("site"))
+	if len(entries) != 0 {
+		t.Fatalf("left behind %d file(s)", len(entries))
+	}
+}
+
+func TestTakeSnapshotFailsWhenDumpFails(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	// An error mentioning 1049 is no proof the database is missing.
+	cfg := &config.Config{
+		Destination: config.DestConfig{
+			DBHostname:      "localhost",
+			DBName:          "site_local",
+			PathToMySQL:     fakeMysql(t, "1"),
+			PathToMysqldump: fakeMysqldump(t, "echo \"mysqldump: Error 2013: Lost connection at row 1049\" >&2\nexit 2\n"),
+		},
+		Database: config.DatabaseConfig{SnapshotKeep: 3},
+	}
+	eventCh := make(chan Event, 64)
+	if err := TakeSnapshot(context.Background(), cfg, "site", eventCh, 4); err == nil {
+		t.Fatal("TakeSnapshot ignored a failed dump of an existing database")
+	}
+	entries, _ := os.ReadDir(config.SnapshotDir("site"))
+	if len(entries) != 0 {
+		t.Fatalf("left behind %d file(s)", len(entries))
+	}
+}
+
+func TestNewSnapshotPathKeepsSnapshotsOfTheSameSecond(t *testing.T) {
+	t.Setenv("SITESYNC_ETC", t.TempDir())
+	dir := config.SnapshotDir("site")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 16, 15, 30, 45, 0, time.Local)
+	for range 3 {
+		path, err := newSnapshotPath(dir, "site_local", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(path+".part", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snaps, err := ListSnapshots("site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, s := range snaps {
+		ids = append(ids, s.ID)
+	}
+	if got := strings.Join(ids, " "); got != "20261016-153045-3 20261016-153045-2 20261016-153045" {
+		t.Fatalf("snapshot IDs = %s", got)
+	}
+}
+
+func TestRestoreSnapshotSelectsNoDatabase(t *testing.T) {
+	dir := t.TempDir()
+	snap := filepath.Join(dir, "20240101-000000_site_local.sql.gz")
+	f, err := os.Create(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(f)
+	io.WriteString(gw, "CREATE DATABASE `site_local`;\nUSE `site_local`;\n")
+	gw.Close()
+	f.Close()
+
+	// The stand-in mysql records its arguments and its input.
+	out := filepath.Join(dir, "mysql.out")
+	bin := filepath.Join(dir, "mysql")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\necho \"$@\" > "+out+"\ncat >> "+out+"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Destination: config.DestConfig{DBHostname: "localhost", DBUser: "root", DBName: "site_local", PathToMySQL: bin},
+	}
+	if err := RestoreSnapshot(context.Background(), cfg, Snapshot{DB: "site_local", Path: snap}); err != nil {
+		t.Fatalf("RestoreSnapshot returned error: %v", err)
+	}
+	got, _ := os.ReadFile(out)
+	if want := "-h localhost -u root\nCREATE DATABASE `site_local`;\nUSE `site_local`;\n"; string(got) != want {
+		t.Fatalf("mysql got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,258 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// StreamDump runs Steps 1, 2 and 4 as a single pipeline when
+// database.stream is enabled: the dump flows from the source through every
+// replace pair straight into mysql's stdin, without an intermediate file in
+// tmp/. Progress is reported as bytes received from the source.
+func StreamDump(ctx context.Context, cfg *config.Config, eventCh chan<- Event, step int) error {
+	sendLog := func(msg string) {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: msg})
+	}
+
+	consume := func(src io.Reader) error {
+		return streamImport(ctx, cfg, src, eventCh, step, sendLog)
+	}
+
+	switch cfg.Source.Type {
+	case "local_file":
+		sendLog(fmt.Sprintf("  source: local file %s", cfg.Source.File))
+		f, err := os.Open(cfg.Source.File)
+		if err != nil {
+			return fmt.Errorf("open dump file: %w", err)
+		}
+		defer f.Close()
+		return consume(f)
+
+	case "remote_file":
+		sendLog(fmt.Sprintf("  source: %s@%s:%s", cfg.Source.User, cfg.Source.Server, cfg.Source.File))
+		remoteCmd := shellJoin([]string{"cat", cfg.Source.File})
+		return streamFromSSH(ctx, cfg, eventCh, step, remoteCmd, "cat "+cfg.Source.File, consume, sendLog)
+
+	case "local_base":
+		sendLog(fmt.Sprintf("  source: local mysqldump → %s", cfg.Source.DBName))
+		dumpArgs, err := buildDumpArgs(cfg, false)
+		if err != nil {
+			return err
+		}
+		dumpBin := cfg.Destination.PathToMysqldump
+		if dumpBin == "" {
+			dumpBin = "mysqldump"
+		}
+		bin, args, err := niceCommand(cfg.Destination.LocalNice, dumpBin, dumpArgs)
+		if err != nil {
+			return fmt.Errorf("parse local_nice: %w", err)
+		}
+		sendLog(fmt.Sprintf("  $ %s %s", bin, redactArgs(args)))
+		return streamFromCmd(exec.CommandContext(ctx, bin, args...), consume, sendLog)
+
+	case "remote_base":
+		sendLog(fmt.Sprintf("  source: %s@%s → %s", cfg.Source.User, cfg.Source.Server, cfg.Source.DBName))
+		remoteCmd, logCmd, err := buildRemoteDumpCommand(cfg)
+		if err != nil {
+			return err
+		}
+		return streamFromSSH(ctx, cfg, eventCh, step, remoteCmd, logCmd, consume, sendLog)
+
+	default:
+		return fmt.Errorf("unknown source type %q", cfg.Source.Type)
+	}
+}
+
+// streamCompressed reports whether the streamed source is gzip-compressed.
+// Unlike the file mode, a local_base stream is never compressed since it
+// does not cross the network.
+func streamCompressed(cfg *config.Config) bool {
+	if cfg.Source.Type == "local_base" {
+		return false
+	}
+	return dumpCompressed(cfg)
+}
+
+func streamFromSSH(
+	ctx context.Context,
+	cfg *config.Config,
+	eventCh chan<- Event,
+	step int,
+	remoteCmd, logCmd string,
+	consume func(io.Reader) error,
+	log func(string),
+) error {
+	target := fmt.Sprintf("%s@%s", cfg.Source.User, cfg.Source.Server)
+	return runSSHCommandWithPasswordPrompt(ctx, eventCh, step, target, log, func(extraEnv []string, batchMode bool) error {
+		cmdArgs := append(sshArgs(cfg.Source.Port, batchMode), target, remoteCmd)
+		log(fmt.Sprintf("  $ ssh %s %s %s", strings.Join(cmdArgs[:len(cmdArgs)-2], " "), target, logCmd))
+
+		cmd := exec.CommandContext(ctx, "ssh", cmdArgs...)
+		cmd.Env = commandEnv(extraEnv)
+		return streamFromCmd(cmd, consume, log)
+	})
+}
+
+// streamFromCmd starts the dump source cmd and hands its stdout to consume.
+// If consume fails first the source is killed so it does not keep dumping
+// into a closed pipe. A source failure takes precedence over the consumer
+// error it caused, so SSH authentication errors still reach the password
+// prompt logic.
+func streamFromCmd(cmd *exec.Cmd, consume func(io.Reader) error, log func(string)) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	tail := newLineTail(8)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sc := bufio.NewScanner(stderrPipe)
+		for sc.Scan() {
+			tail.Add(sc.Text())
+			log("  " + sc.Text())
+		}
+	}()
+
+	consumeErr := consume(stdout)
+	if consumeErr != nil {
+		_ = cmd.Process.Kill()
+	}
+	wg.Wait()
+	waitErr := cmd.Wait()
+
+	var exitErr *exec.ExitError
+	if waitErr != nil && (consumeErr == nil || errors.As(waitErr, &exitErr) && exitErr.Exited()) {
+		if lines := tail.Lines(); len(lines) > 0 {
+			return fmt.Errorf("%w\nlast output:\n%s", waitErr, strings.Join(lines, "\n"))
+		}
+		return waitErr
+	}
+	return consumeErr
+}
+
+// streamImport feeds src through decompression, every replace pair and the
+// MariaDB comment stripper into mysql.
+func streamImport(ctx context.Context, cfg *config.Config, src io.Reader, eventCh chan<- Event, step int, sendLog func(string)) error {
+	counter := &byteCounter{r: src, eventCh: eventCh, step: step, ctx: ctx}
+	var reader io.Reader = counter
+
+	// Pipe readers are closed on return so that the replace goroutines
+	// unblock if mysql exits before draining its stdin.
+	var closers []io.Closer
+	defer func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}()
+
+	if streamCompressed(cfg) {
+		gr, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("open gzip reader: %w", err)
+		}
+		defer gr.Close()
+		reader = gr
+	}
+
+	var replacer *MultiReplacer
+	if len(cfg.Replace) > 0 {
+		var err error
+		replacer, err = NewMultiReplacer(cfg.Replace)
+		if err != nil {
+			return err
+		}
+		for i, pair := range cfg.Replace {
+			sendLog("  " + describePair(i, len(cfg.Replace), pair))
+		}
+		pr := replaceThrough(replacer, reader, replaceWorkers(cfg))
+		closers = append(closers, pr)
+		reader = pr
+	}
+
+	br := bufio.NewReaderSize(reader, 64*1024)
+	reader = br
+	if head, _ := br.Peek(8192); bytes.Contains(head, []byte("/*M!")) {
+		sendLog("  detected MariaDB dump, stripping M! comments")
+		stripper := newMariaDBStripper(br, sendLog)
+		if c, ok := stripper.(io.Closer); ok {
+			closers = append(closers, c)
+		}
+		reader = stripper
+	}
+
+	bin, args, err := niceCommand(cfg.Destination.LocalNice, mysqlBin(cfg), buildMySQLArgs(cfg))
+	if err != nil {
+		return fmt.Errorf("parse local_nice: %w", err)
+	}
+	sendLog(fmt.Sprintf("  target: %s@%s → %s", cfg.Destination.DBUser, cfg.Destination.DBHostname, cfg.Destination.DBName))
+	sendLog(fmt.Sprintf("  $ %s %s", bin, redactArgs(args)))
+
+	mysql := exec.CommandContext(ctx, bin, args...)
+	mysql.Stdin = reader
+	if err := streamCmd(ctx, eventCh, step, mysql, true); err != nil {
+		return fmt.Errorf("mysql import failed: %w", err)
+	}
+	sendLog(fmt.Sprintf("  received %s", humanSize(counter.n)))
+	if replacer != nil {
+		// mysql has consumed the whole stream, so the replacer is done.
+		reportReplaceStats(ctx, eventCh, step, cfg.Replace, replacer)
+	}
+	return nil
+}
+
+// replaceThrough returns a reader yielding r with every replace pair
+// applied. The replacement runs in its own goroutine so it overlaps with
+// the download and the import.
+func replaceThrough(replacer *MultiReplacer, r io.Reader, workers int) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(replacer.ReplaceStreamParallel(r, pw, workers))
+	}()
+	return pr
+}
+
+// byteCounter wraps the raw source stream and emits EvProgress events
+// carrying the number of bytes received so far. The total size of a stream
+// is unknown, so Progress stays 0 and Message holds the human-readable count.
+type byteCounter struct {
+	r       io.Reader
+	n       int64
+	last    time.Time
+	eventCh chan<- Event
+	step    int
+	ctx     context.Context
+}
+
+func (bc *byteCounter) Read(p []byte) (int, error) {
+	n, err := bc.r.Read(p)
+	bc.n += int64(n)
+	// Throttle to a few updates per second to avoid flooding the channel.
+	if time.Since(bc.last) >= 250*time.Millisecond {
+		bc.last = time.Now()
+		sendEvent(bc.ctx, bc.eventCh, Event{Type: EvProgress, Step: bc.step,
+			Message: fmt.Sprintf("%s received", humanSize(bc.n))})
+	}
+	return n, err
+}
@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+)
+
+// fakeMySQL writes a stand-in mysql binary that copies its stdin to out.
+func fakeMySQL(t *testing.T, out string) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "mysql")
+	script := "#!/bin/sh\ncat > '" + out + "'\n"
+	if err := os.WriteFile(bin, []byte(script), 0700); err != nil {
+		t.Fatalf("write fake mysql: %v", err)
+	}
+	return bin
+}
+
+func TestStreamDumpAppliesReplacementsIntoMySQL(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "dump.sql.gz")
+	out := filepath.Join(dir, "imported.sql")
+
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte("INSERT INTO t VALUES ('s:18:\"http://example.com\";');\n/*M!999999\\- enable the sandbox mode */\n"))
+	gz.Close()
+	f.Close()
+
+	cfg := &config.Config{
+		Source: config.SourceConfig{Type: "local_file", File: src},
+		Destination: config.DestConfig{
+			DBHostname:  "localhost",
+			DBName:      "local",
+			PathToMySQL: fakeMySQL(t, out),
+		},
+		Replace: []config.ReplacePair{{Search: "http://example.com", Replace: "http://local.test"}},
+	}
+
+	eventCh := make(chan Event, 256)
+	if err := StreamDump(context.Background(), cfg, eventCh, 1); err != nil {
+		t.Fatalf("StreamDump returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO t VALUES ('s:17:\"http://local.test\";');\n"
+	if string(got) != want {
+		t.Fatalf("imported SQL = %q, want %q", got, want)
+	}
+}
+
+func TestMariaDBStripperLongLines(t *testing.T) {
+	defer func(n int) { maxLinePiece = n }(maxLinePiece)
+	maxLinePiece = 48
+
+	row := "(1,'" + strings.Repeat("x", 50) + "')"
+	in := "/*M!999999\\- enable the sandbox mode */\n" +
+		"INSERT INTO t VALUES " + row + "/*M!100101 , (2,'" + strings.Repeat("y", 40) + "') */," + row + ";\r\n" +
+		"SELECT 1 /*M!100101 x */;\n"
+	want := "INSERT INTO t VALUES " + row + "," + row + ";\n" +
+		"SELECT 1 ;\n"
+
+	var logs []string
+	got, err := io.ReadAll(newMariaDBStripper(strings.NewReader(in), func(s string) { logs = append(logs, s) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("stripped dump\ngot  %q\nwant %q", got, want)
+	}
+	if len(logs) != 1 {
+		t.Errorf("logs = %v, want one summary line", logs)
+	}
+}
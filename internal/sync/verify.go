@@ -0,0 +1,408 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SerialIssue describes one PHP serialized value whose declared length or
+// element count does not match its contents. PHP's unserialize() rejects such
+// values, and WordPress then silently drops the option or meta row.
+type SerialIssue struct {
+	Table    string // table of the enclosing INSERT, "" if unknown
+	Line     int    // 1-based line number in the dump
+	Offset   int    // 0-based byte offset of the value within the line
+	Kind     string // "string", "array", "object", "class name" or "malformed"
+	Declared int    // byte length or element count declared by the value
+	Actual   int    // byte length or element count found
+}
+
+func (si SerialIssue) String() string {
+	where := fmt.Sprintf("line %d, offset %d", si.Line, si.Offset)
+	if si.Table != "" {
+		where = si.Table + ": " + where
+	}
+	switch si.Kind {
+	case "malformed":
+		return where + ": unparseable serialized value"
+	case "array", "object":
+		return fmt.Sprintf("%s: %s declares %d element(s), found %d", where, si.Kind, si.Declared, si.Actual)
+	default:
+		return fmt.Sprintf("%s: %s declares %d byte(s), found %d", where, si.Kind, si.Declared, si.Actual)
+	}
+}
+
+// VerifySerialized walks a SQL dump and parses every PHP serialized value
+// found inside its string literals, including arrays, objects and serialized
+// data nested inside serialized strings. report is called for each value
+// whose declared length does not match its byte length.
+func VerifySerialized(r io.Reader, report func(SerialIssue)) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	var ctx insertContext
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			ctx = nextInsertContext(ctx, string(line))
+			verifyLine(line, func(si SerialIssue) {
+				si.Table, si.Line = ctx.table, lineNo
+				report(si)
+			})
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// VerifySerializedFile runs VerifySerialized on a dump file, which may be
+// gzip-compressed (*.gz).
+func VerifySerializedFile(path string, report func(SerialIssue)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("open gzip reader: %w", err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+	return VerifySerialized(r, report)
+}
+
+// verifyDump runs the serialized-data check on the dump after Step 2 and
+// fails with a summary when corrupted values are found.
+func verifyDump(ctx context.Context, dumpPath string, eventCh chan<- Event, step int) error {
+	const maxListed = 20
+	sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step,
+		Message: "  verifying serialized data"})
+
+	f, err := os.Open(dumpPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		r = &progressReader{r: f, total: fi.Size(), eventCh: eventCh, step: step, ctx: ctx}
+	}
+
+	count := 0
+	err = VerifySerialized(r, func(si SerialIssue) {
+		count++
+		if count <= maxListed {
+			sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step, Message: "  ✗ " + si.String()})
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", filepath.Base(dumpPath), err)
+	}
+	if count > maxListed {
+		sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step,
+			Message: fmt.Sprintf("  … and %d more", count-maxListed)})
+	}
+	if count > 0 {
+		return fmt.Errorf("%d corrupted serialized value(s) in %s", count, filepath.Base(dumpPath))
+	}
+	sendEvent(ctx, eventCh, Event{Type: EvLog, Step: step,
+		Message: "  serialized data OK"})
+	return nil
+}
+
+// verifyLine checks every SQL string literal on line that looks like a
+// serialized value.
+func verifyLine(line []byte, report func(SerialIssue)) {
+	for i := 0; i < len(line); i++ {
+		if line[i] != '\'' {
+			continue
+		}
+		start := i + 1
+		end := start
+		for end < len(line) {
+			c := line[end]
+			if c == '\\' {
+				end += 2
+				continue
+			}
+			if c == '\'' {
+				if end+1 < len(line) && line[end+1] == '\'' {
+					end += 2
+					continue
+				}
+				break
+			}
+			end++
+		}
+		if end > len(line) {
+			end = len(line)
+		}
+		if looksSerialized(line[start:end]) {
+			verifyLiteral(line[start:end], start, report)
+		}
+		i = end
+	}
+}
+
+// looksSerialized reports whether b starts like a serialized string, array,
+// object or enum: s:N:", a:N:{, O:N:", C:N:" or E:N:".
+func looksSerialized(b []byte) bool {
+	if len(b) < 4 || b[1] != ':' || b[2] < '0' || b[2] > '9' {
+		return false
+	}
+	return bytes.IndexByte([]byte("saOCE"), b[0]) >= 0
+}
+
+// verifyLiteral unescapes a raw SQL string literal that begins at byte base
+// of its line and parses it as a serialized value.
+func verifyLiteral(raw []byte, base int, report func(SerialIssue)) {
+	data := make([]byte, 0, len(raw))
+	pos := make([]int, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		at := base + i
+		if c == '\\' && i+1 < len(raw) {
+			i++
+			c = unescapeSQLByte(raw[i])
+		} else if c == '\'' && i+1 < len(raw) && raw[i+1] == '\'' {
+			i++
+		}
+		data = append(data, c)
+		pos = append(pos, at)
+	}
+
+	p := &serialParser{data: data}
+	next, ok := p.value(0)
+	if !ok || next != len(data) {
+		// Plain text that merely starts like a serialized value is common
+		// (e.g. "s:1:\"..." in a log); only flag structured values.
+		if (data[0] == 'a' || data[0] == 'O') && data[len(data)-1] == '}' {
+			report(SerialIssue{Offset: base, Kind: "malformed"})
+		}
+		return
+	}
+	for _, si := range p.issues {
+		si.Offset = pos[si.Offset]
+		report(si)
+	}
+}
+
+// unescapeSQLByte decodes the byte following a backslash in a mysqldump
+// string literal.
+func unescapeSQLByte(c byte) byte {
+	switch c {
+	case '0':
+		return 0
+	case 'b':
+		return '\b'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'Z':
+		return 0x1a
+	default:
+		return c
+	}
+}
+
+// serialParser is a tolerant PHP unserialize(): a string whose declared
+// length is wrong is recorded as an issue and parsing resumes at its real
+// end, so every bad value in a structure is reported rather than only the
+// first one.
+type serialParser struct {
+	data   []byte
+	issues []SerialIssue // Offset is an index into data
+}
+
+// value parses one serialized value starting at i and returns the index
+// just past it.
+func (p *serialParser) value(i int) (int, bool) {
+	d := p.data
+	if i+1 >= len(d) {
+		return 0, false
+	}
+	switch d[i] {
+	case 'N':
+		if d[i+1] != ';' {
+			return 0, false
+		}
+		return i + 2, true
+
+	case 'b', 'i', 'd', 'r', 'R':
+		if d[i+1] != ':' {
+			return 0, false
+		}
+		end := bytes.IndexByte(d[i+2:], ';')
+		if end < 0 {
+			return 0, false
+		}
+		return i + 2 + end + 1, true
+
+	case 's', 'E':
+		n, j, ok := p.length(i)
+		if !ok || j >= len(d) || d[j] != '"' {
+			return 0, false
+		}
+		start := j + 1
+		end, ok := p.stringEnd(start, n, ';')
+		if !ok {
+			return 0, false
+		}
+		if end-start != n {
+			p.issues = append(p.issues, SerialIssue{Offset: i, Kind: "string", Declared: n, Actual: end - start})
+		}
+		p.nested(start, end)
+		return end + 2, true
+
+	case 'a':
+		n, j, ok := p.length(i)
+		if !ok || j >= len(d) || d[j] != '{' {
+			return 0, false
+		}
+		return p.elements(i, j+1, n, "array")
+
+	case 'O':
+		n, j, ok := p.length(i)
+		if !ok || j >= len(d) || d[j] != '"' {
+			return 0, false
+		}
+		start := j + 1
+		end, ok := p.stringEnd(start, n, ':')
+		if !ok {
+			return 0, false
+		}
+		if end-start != n {
+			p.issues = append(p.issues, SerialIssue{Offset: i, Kind: "class name", Declared: n, Actual: end - start})
+		}
+		// After the class name: ":N:{".
+		count, k, ok := p.length(end)
+		if !ok || k >= len(d) || d[k] != '{' {
+			return 0, false
+		}
+		return p.elements(i, k+1, count, "object")
+
+	case 'C':
+		n, j, ok := p.length(i)
+		if !ok || j+n+2 >= len(d) || d[j] != '"' || d[j+1+n] != '"' {
+			return 0, false
+		}
+		size, k, ok := p.length(j + 1 + n)
+		if !ok || k >= len(d) || d[k] != '{' || k+1+size >= len(d) || d[k+1+size] != '}' {
+			return 0, false
+		}
+		return k + 1 + size + 1, true
+	}
+	return 0, false
+}
+
+// length parses "X:N:" at i (or ":N:" when d[i] is already the colon) and
+// returns N and the index just past the second colon.
+func (p *serialParser) length(i int) (int, int, bool) {
+	d := p.data
+	if d[i] != ':' {
+		i++
+	}
+	if i >= len(d) || d[i] != ':' {
+		return 0, 0, false
+	}
+	j := i + 1
+	for j < len(d) && d[j] >= '0' && d[j] <= '9' {
+		j++
+	}
+	if j == i+1 || j >= len(d) || d[j] != ':' {
+		return 0, 0, false
+	}
+	n, err := strconv.Atoi(string(d[i+1 : j]))
+	if err != nil {
+		return 0, 0, false
+	}
+	return n, j + 1, true
+}
+
+// stringEnd returns the index of the closing quote of a string starting at
+// start with declared length n, followed by term. When the declared length
+// is wrong, the first plausible closing quote is used instead.
+func (p *serialParser) stringEnd(start, n int, term byte) (int, bool) {
+	d := p.data
+	if e := start + n; e+1 < len(d) && d[e] == '"' && d[e+1] == term {
+		return e, true
+	}
+	for k := start; k+1 < len(d); k++ {
+		if d[k] == '"' && d[k+1] == term && (term != ';' || p.plausibleNext(k+2)) {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// plausibleNext reports whether a serialized value could end right before k.
+func (p *serialParser) plausibleNext(k int) bool {
+	d := p.data
+	if k >= len(d) || d[k] == '}' {
+		return true
+	}
+	if d[k] == 'N' {
+		return k+1 < len(d) && d[k+1] == ';'
+	}
+	return k+1 < len(d) && d[k+1] == ':' && bytes.IndexByte([]byte("sibdaOCrRE"), d[k]) >= 0
+}
+
+// elements parses key/value pairs from i up to the closing brace of the
+// array or object that starts at at.
+func (p *serialParser) elements(at, i, declared int, kind string) (int, bool) {
+	d := p.data
+	found := 0
+	for i < len(d) && d[i] != '}' {
+		var ok bool
+		if i, ok = p.value(i); !ok {
+			return 0, false
+		}
+		if i, ok = p.value(i); !ok {
+			return 0, false
+		}
+		found++
+	}
+	if i >= len(d) {
+		return 0, false
+	}
+	if found != declared {
+		p.issues = append(p.issues, SerialIssue{Offset: at, Kind: kind, Declared: declared, Actual: found})
+	}
+	return i + 1, true
+}
+
+// nested checks a string value that is itself serialized data. Its issues
+// are only kept when the whole string parses, so ordinary text that happens
+// to start like a serialized value is not reported.
+func (p *serialParser) nested(start, end int) {
+	content := p.data[start:end]
+	if !looksSerialized(content) {
+		return
+	}
+	sub := &serialParser{data: content}
+	if next, ok := sub.value(0); !ok || next != len(content) {
+		return
+	}
+	for _, si := range sub.issues {
+		si.Offset += start
+		p.issues = append(p.issues, si)
+	}
+}
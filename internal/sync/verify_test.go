@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifySerialized(t *testing.T) {
+	dump := strings.Join([]string{
+		"-- MySQL dump 'header'",
+		"INSERT INTO `wp_options` VALUES (1,'ok','a:2:{s:3:\\\"url\\\";s:13:\\\"http://a.test\\\";i:0;b:1;}','yes'),(2,'bad','a:1:{s:3:\\\"url\\\";s:20:\\\"http://a.test\\\";}','yes');",
+		"INSERT INTO `wp_postmeta` VALUES (3,'nested','s:23:\\\"a:1:{i:0;s:5:\\\"hello!\\\";}\\\";'),(4,'mb','s:5:\\\"héllo\\\";'),(5,'count','a:2:{i:0;N;}');",
+		"INSERT INTO `wp_posts` VALUES (6,'O:8:\\\"stdClass\\\":1:{s:1:\\\"a\\\";d:1.5;}','s:1 is not serialized','it''s fine');",
+		"UNLOCK TABLES;",
+	}, "\n") + "\n"
+
+	var got []SerialIssue
+	if err := VerifySerialized(strings.NewReader(dump), func(si SerialIssue) {
+		got = append(got, si)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SerialIssue{
+		{Table: "wp_options", Line: 2, Kind: "string", Declared: 20, Actual: 13},
+		{Table: "wp_postmeta", Line: 3, Kind: "string", Declared: 5, Actual: 6},
+		{Table: "wp_postmeta", Line: 3, Kind: "string", Declared: 5, Actual: 6},
+		{Table: "wp_postmeta", Line: 3, Kind: "array", Declared: 2, Actual: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d issue(s), want %d: %v", len(got), len(want), got)
+	}
+	lines := strings.Split(dump, "\n")
+	for i, w := range want {
+		g := got[i]
+		if g.Table != w.Table || g.Line != w.Line || g.Kind != w.Kind || g.Declared != w.Declared || g.Actual != w.Actual {
+			t.Errorf("issue %d = %+v, want %+v", i, g, w)
+		}
+		// Offset points at the value's type letter in the raw dump line.
+		if line := lines[g.Line-1]; !strings.HasPrefix(line[g.Offset:], string(w.Kind[0])+":") {
+			t.Errorf("issue %d offset %d points at %q", i, g.Offset, line[g.Offset:min(len(line), g.Offset+10)])
+		}
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"github.com/carlosrgl/sitesync/internal/config"
 	"github.com/carlosrgl/sitesync/internal/logger"
 	syncsvc "github.com/carlosrgl/sitesync/internal/sync"
+	"github.com/carlosrgl/sitesync/internal/tui/models/batch"
 	"github.com/carlosrgl/sitesync/internal/tui/models/editor"
 	"github.com/carlosrgl/sitesync/internal/tui/models/opselect"
 	"github.com/carlosrgl/sitesync/internal/tui/models/picker"
+	"github.com/carlosrgl/sitesync/internal/tui/models/preview"
 	"github.com/carlosrgl/sitesync/internal/tui/models/syncing"
 	"github.com/carlosrgl/sitesync/internal/tui/styles"
 )
@@ -21,6 +23,8 @@ const (
 	screenOpSelect
 	screenSyncing
 	screenEditor
+	screenPreview
+	screenBatch
 )
 
 // AppModel is the root Bubble Tea model. It routes all messages and renders
@@ -31,23 +35,29 @@ type AppModel struct {
 	opsel   opselect.Model
 	syncing syncing.Model
 	editor  editor.Model
+	preview preview.Model
+	batch   batch.Model
 	log     logger.Logger
 
 	// Transient state between screens
 	selectedConf string
+	batchSites   []string // sites marked in the picker, synced together
 	updateNotice string
+	jobs         int // sites a batch syncs at a time
 
 	width  int
 	height int
 }
 
 // New creates an initialised AppModel, pre-selecting confName if non-empty.
-func New(entries []config.ConfigEntry, preselect string, log logger.Logger, updateNotice string) AppModel {
+// A batch of sites marked in the picker syncs jobs of them at a time.
+func New(entries []config.ConfigEntry, preselect string, log logger.Logger, updateNotice string, jobs int) AppModel {
 	m := AppModel{
 		screen:       screenPicker,
 		picker:       picker.New(entries),
 		log:          log,
 		updateNotice: updateNotice,
+		jobs:         jobs,
 	}
 	// If a config name was passed on the CLI, skip straight to op-select.
 	if preselect != "" {
@@ -72,6 +82,10 @@ func (m AppModel) activeInit() tea.Cmd {
 		return m.syncing.Init()
 	case screenEditor:
 		return m.editor.Init()
+	case screenPreview:
+		return m.preview.Init()
+	case screenBatch:
+		return m.batch.Init()
 	}
 	return nil
 }
@@ -92,6 +106,10 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.updateSyncing(msg)
 	case screenEditor:
 		return m.updateEditor(msg)
+	case screenPreview:
+		return m.updatePreview(msg)
+	case screenBatch:
+		return m.updateBatch(msg)
 	}
 	return m, nil
 }
@@ -103,10 +121,17 @@ func (m AppModel) updatePicker(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case picker.ConfSelectedMsg:
 		name := msg.(picker.ConfSelectedMsg).Name
 		m.selectedConf = name
+		m.batchSites = nil
 		m.opsel = opselect.New(name)
 		m.screen = screenOpSelect
 		return m, m.opsel.Init()
 
+	case picker.BatchSelectedMsg:
+		m.batchSites = msg.(picker.BatchSelectedMsg).Names
+		m.opsel = opselect.NewBatch(m.batchSites)
+		m.screen = screenOpSelect
+		return m, m.opsel.Init()
+
 	case picker.NewConfMsg:
 		m.editor = editor.New("new-site", nil)
 		m.screen = screenEditor
@@ -132,20 +157,22 @@ func (m AppModel) updatePicker(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m AppModel) updateOpSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch ev := msg.(type) {
 	case opselect.OpChosenMsg:
+		if len(m.batchSites) > 0 {
+			m.batch = batch.New(m.batchSites, ev.Op, ev.Steps, m.jobs)
+			m.screen = screenBatch
+			return m, m.batch.Init()
+		}
+		return m.startSync(ev.Op, ev.Steps)
+
+	case opselect.PreviewMsg:
 		cfg, err := config.Load(m.selectedConf)
 		if err != nil {
-			// Return to picker on error
 			m.screen = screenPicker
 			return m, nil
 		}
-		logFile := config.LogFile(cfg)
-		log, err := logger.New(logFile)
-		if err != nil {
-			log = logger.Discard()
-		}
-		m.syncing = syncing.New(cfg, ev.Op, m.selectedConf, log)
-		m.screen = screenSyncing
-		return m, m.syncing.Init()
+		m.preview = preview.New(cfg, ev.Op, ev.Steps, m.selectedConf, m.width, m.height)
+		m.screen = screenPreview
+		return m, m.preview.Init()
 
 	case opselect.BackMsg:
 		m.screen = screenPicker
@@ -157,9 +184,45 @@ func (m AppModel) updateOpSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+func (m AppModel) updatePreview(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch ev := msg.(type) {
+	case preview.RunMsg:
+		return m.startSync(ev.Op, ev.Steps)
+	case preview.BackMsg:
+		m.screen = screenOpSelect
+		return m, m.opsel.Init()
+	}
+
+	sub, cmd := m.preview.Update(msg)
+	m.preview = sub.(preview.Model)
+	return m, cmd
+}
+
+// startSync loads the selected config again, so edits made since the
+// preview are honoured, and switches to the syncing screen.
+func (m AppModel) startSync(op syncsvc.Op, steps syncsvc.Steps) (tea.Model, tea.Cmd) {
+	cfg, err := config.Load(m.selectedConf)
+	if err != nil {
+		// Return to picker on error
+		m.screen = screenPicker
+		return m, nil
+	}
+	logFile := config.LogFile(cfg)
+	log, err := logger.New(logFile)
+	if err != nil {
+		log = logger.Discard()
+	}
+	m.syncing = syncing.New(cfg, op, steps, m.selectedConf, log)
+	m.screen = screenSyncing
+	return m, m.syncing.Init()
+}
+
 func (m AppModel) updateSyncing(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg.(type) {
 	case syncing.BackMsg:
+		// The run just added to the history shows as the last sync.
+		entries, _ := config.ListConfigs()
+		m.picker.Reload(entries)
 		m.screen = screenPicker
 		return m, m.picker.Init()
 	}
@@ -169,6 +232,22 @@ func (m AppModel) updateSyncing(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+func (m AppModel) updateBatch(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg.(type) {
+	case batch.BackMsg:
+		// Reloading also clears the marks of the batch.
+		entries, _ := config.ListConfigs()
+		m.picker.Reload(entries)
+		m.batchSites = nil
+		m.screen = screenPicker
+		return m, m.picker.Init()
+	}
+
+	sub, cmd := m.batch.Update(msg)
+	m.batch = sub.(batch.Model)
+	return m, cmd
+}
+
 func (m AppModel) updateEditor(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch ev := msg.(type) {
 	case editor.DoneMsg:
@@ -208,6 +287,10 @@ func (m AppModel) View() string {
 		body = m.syncing.View()
 	case screenEditor:
 		body = m.editor.View()
+	case screenPreview:
+		body = m.preview.View()
+	case screenBatch:
+		body = m.batch.View()
 	}
 
 	return lipgloss.JoinVertical(lipgloss.Left,
@@ -227,13 +310,15 @@ func (m AppModel) renderUpdateNotice() string {
 
 // ── Op helper exposed for headless use ───────────────────────────────────────
 
-// ParseOp converts a string (sql/files/"") to an Op.
+// ParseOp converts a string (sql/files/push/"") to an Op.
 func ParseOp(s string) syncsvc.Op {
 	switch s {
 	case "sql":
 		return syncsvc.OpSQL
 	case "files":
 		return syncsvc.OpFiles
+	case "push":
+		return syncsvc.OpPush
 	default:
 		return syncsvc.OpAll
 	}
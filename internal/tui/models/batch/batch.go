@@ -0,0 +1,291 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	syncsvc "github.com/carlosrgl/sitesync/internal/sync"
+	"github.com/carlosrgl/sitesync/internal/tui/styles"
+)
+
+// Messages
+type BackMsg struct{}
+
+type siteEventMsg struct {
+	site string
+	ev   syncsvc.Event
+}
+
+type doneMsg struct{ results []syncsvc.BatchResult }
+
+type rowStatus uint8
+
+const (
+	rowWaiting rowStatus = iota
+	rowRunning
+	rowOK
+	rowFailed
+	rowCancelled
+)
+
+// row is the state of one site.
+type row struct {
+	site     string
+	status   rowStatus
+	step     int
+	progress float64
+	detail   string // progress text when the total is unknown (streaming)
+	err      string
+	start    time.Time
+	took     time.Duration
+}
+
+// Model is the combined syncing view of a batch run, with one row per
+// site. The sites run unattended, like sitesync --conf=a,b,c: a failed step
+// follows the on-error policy of the site and otherwise stops it.
+type Model struct {
+	op   syncsvc.Op
+	jobs int
+	rows []row
+
+	msgCh      chan tea.Msg
+	cancelFn   context.CancelFunc
+	cancelled  bool
+	done       bool
+	spinner    spinner.Model
+	progressBr progress.Model
+	width      int
+}
+
+func New(sites []string, op syncsvc.Op, steps syncsvc.Steps, jobs int) Model {
+	sp := spinner.New()
+	sp.Spinner = spinner.Dot
+	sp.Style = styles.StepActiveStyle
+
+	pr := progress.New(
+		progress.WithDefaultGradient(),
+		progress.WithoutPercentage(),
+	)
+	pr.Width = 20
+
+	rows := make([]row, len(sites))
+	for i, site := range sites {
+		rows[i] = row{site: site}
+	}
+
+	// Every event goes through msgCh, which the view keeps reading until
+	// the batch is done, so the engine never blocks on it for long.
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan tea.Msg, 128)
+	go func() {
+		results := syncsvc.RunBatch(ctx, sites, op, syncsvc.Options{Steps: steps}, jobs, func(site string, ev syncsvc.Event) {
+			ch <- siteEventMsg{site: site, ev: ev}
+		})
+		ch <- doneMsg{results: results}
+	}()
+
+	return Model{
+		op:         op,
+		jobs:       jobs,
+		rows:       rows,
+		msgCh:      ch,
+		cancelFn:   cancel,
+		spinner:    sp,
+		progressBr: pr,
+	}
+}
+
+func (m Model) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, waitForMsg(m.msgCh))
+}
+
+func waitForMsg(ch <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg { return <-ch }
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.progressBr.Width = min(max(msg.Width-70, 10), 40)
+
+	case siteEventMsg:
+		m.applyEvent(msg.site, msg.ev)
+		return m, waitForMsg(m.msgCh)
+
+	case doneMsg:
+		m.done = true
+		for i, r := range msg.results {
+			m.rows[i].took = r.Took
+			switch r.Status {
+			case syncsvc.RunOK:
+				m.rows[i].status = rowOK
+			case syncsvc.RunCancelled:
+				m.rows[i].status = rowCancelled
+				m.rows[i].err = firstLine(r.Err)
+			default:
+				m.rows[i].status = rowFailed
+				m.rows[i].err = firstLine(r.Err)
+			}
+		}
+		return m, nil
+
+	case spinner.TickMsg:
+		if m.done {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			if m.done {
+				return m, func() tea.Msg { return BackMsg{} }
+			}
+			// Abort: the running sites stop and the waiting ones never start.
+			m.cancelFn()
+			m.cancelled = true
+		case "enter", "esc", "b":
+			if m.done {
+				return m, func() tea.Msg { return BackMsg{} }
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *Model) applyEvent(site string, ev syncsvc.Event) {
+	i := m.indexOf(site)
+	if i < 0 {
+		return
+	}
+	r := &m.rows[i]
+	switch ev.Type {
+	case syncsvc.EvStepStart, syncsvc.EvCheck:
+		if r.status == rowWaiting {
+			r.start = time.Now()
+		}
+		// A step failure the on-error policy continues past is followed
+		// by the next step, so the site runs again.
+		r.status = rowRunning
+		if ev.Type == syncsvc.EvStepStart {
+			r.step, r.progress, r.detail = ev.Step, 0, ""
+		}
+	case syncsvc.EvProgress:
+		r.progress, r.detail = ev.Progress, ev.Message
+	case syncsvc.EvStepFail:
+		// A site whose config does not load fails before any step starts.
+		if r.status == rowWaiting {
+			r.start = time.Now()
+		} else {
+			r.step = ev.Step
+		}
+		r.status, r.err = rowFailed, firstLine(ev.Message)
+		r.took = time.Since(r.start)
+	case syncsvc.EvDone:
+		r.status, r.took = rowOK, time.Since(r.start)
+	}
+}
+
+func (m Model) indexOf(site string) int {
+	for i, r := range m.rows {
+		if r.site == site {
+			return i
+		}
+	}
+	return -1
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func (m Model) View() string {
+	title := styles.Title.Render(fmt.Sprintf("⚡ Syncing %d sites (%s, %d at a time)", len(m.rows), m.op, m.jobs))
+	rows := []string{title}
+
+	width := 0
+	for _, r := range m.rows {
+		width = max(width, len(r.site))
+	}
+	var ok, failed int
+	for _, r := range m.rows {
+		rows = append(rows, m.renderRow(r, width))
+		switch r.status {
+		case rowOK:
+			ok++
+		case rowFailed, rowCancelled:
+			failed++
+		}
+	}
+	rows = append(rows, "")
+
+	var help string
+	switch {
+	case m.done:
+		summary := styles.Success.Render(fmt.Sprintf("  ✔ %d synced", ok))
+		if failed > 0 {
+			summary += styles.Error.Render(fmt.Sprintf("  ✘ %d failed", failed))
+		}
+		rows = append(rows, summary, "")
+		help = styles.RenderHelp("enter", "back", "q", "back")
+	case m.cancelled:
+		rows = append(rows, styles.Warning.Render("  Cancelling…"), "")
+		help = styles.RenderHelp("q", "cancel")
+	default:
+		help = styles.RenderHelp("q", "cancel all")
+	}
+	rows = append(rows, styles.StatusBar.Render(help))
+
+	return lipgloss.JoinVertical(lipgloss.Left, rows...)
+}
+
+// renderRow renders one site: its status, current step and elapsed time.
+func (m Model) renderRow(r row, width int) string {
+	name := fmt.Sprintf(" %-*s  ", width, r.site)
+	stepName := ""
+	if r.step >= 1 && r.step <= 7 {
+		stepName = fmt.Sprintf("[%d/7] %-16s", r.step, m.op.StepName(r.step))
+	}
+
+	switch r.status {
+	case rowWaiting:
+		return styles.StepPendingStyle.Render(styles.StepPending) + styles.Muted.Render(name+"waiting")
+	case rowRunning:
+		right := m.spinner.View()
+		if r.progress > 0 {
+			right = m.progressBr.ViewAs(r.progress) + styles.Cyan.Render(fmt.Sprintf(" %3.0f%%", r.progress*100))
+		} else if r.detail != "" {
+			right += styles.Cyan.Render(" " + r.detail)
+		}
+		return styles.StepActiveStyle.Render(styles.StepActive) + styles.Primary.Render(name) +
+			styles.NormalItem.Render(stepName) + " " + right + styles.Muted.Render("  "+elapsed(time.Since(r.start)))
+	case rowOK:
+		return styles.StepDoneStyle.Render(styles.StepDone) + styles.NormalItem.Render(name) +
+			styles.Success.Render("done") + styles.Muted.Render("  "+elapsed(r.took))
+	case rowCancelled:
+		return styles.StepSkippedStyle.Render(styles.StepSkipped) + styles.Muted.Render(name+"cancelled: "+r.err)
+	default:
+		return styles.StepFailedStyle.Render(styles.StepFailed) + styles.Error.Render(name) +
+			styles.Error.Render(strings.TrimSpace(stepName+" "+r.err)) + styles.Muted.Render("  "+elapsed(r.took))
+	}
+}
+
+// elapsed formats d to the second, e.g. 3m05s.
+func elapsed(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
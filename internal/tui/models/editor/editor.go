@@ -34,6 +34,7 @@ type Model struct {
 	syncText    string // "src==>dst" lines
 	excludeText string // one per line
 	ignoreText  string // one per line
+	tagsText    string // comma-separated
 }
 
 // New creates an editor pre-populated from an existing config.
@@ -59,6 +60,7 @@ func New(confName string, cfg *config.Config) Model {
 	m.syncText = syncPairsToText(m.cfg.Sync)
 	m.excludeText = strings.Join(m.cfg.Transport.Exclude, "\n")
 	m.ignoreText = strings.Join(m.cfg.Database.IgnoreTables, "\n")
+	m.tagsText = strings.Join(m.cfg.Site.Tags, ", ")
 
 	m.form = m.buildForm()
 	return m
@@ -77,6 +79,10 @@ func (m *Model) buildForm() *huh.Form {
 			huh.NewInput().
 				Title("Site description").
 				Value(&cfg.Site.Description),
+			huh.NewInput().
+				Title("Tags").
+				Description("Comma-separated, to sync sites together with --tag").
+				Value(&m.tagsText),
 			huh.NewInput().
 				Title("Remote server").
 				Description("SSH / rsync hostname").
@@ -140,9 +146,13 @@ func (m *Model) buildForm() *huh.Form {
 		huh.NewGroup(
 			huh.NewNote().
 				Title("Find / Replace pairs").
-				Description("One pair per line in the format:\n  search==>replace\nApplied to the SQL dump in order."),
+				Description("One pair per line in the format:\n  search==>replace\nApplied to the SQL dump in order.\n" +
+					"Append ||regex, ignore_case, only_serialized and/or skip_encoded\n(comma-separated) to set pair options, and tables=a;b or\nexclude_tables=wp_users.user_email;wp_*_log to scope the pair."),
 			huh.NewText().
 				Title("Replace pairs").
+				Validate(func(s string) error {
+					return config.ValidateReplacePairs(textToReplacePairs(s))
+				}).
 				Value(&m.replaceText),
 		),
 		// Page 5: File sync + Transport
@@ -180,6 +190,14 @@ func (m *Model) buildForm() *huh.Form {
 			huh.NewText().
 				Title("Ignored tables (one per line)").
 				Value(&m.ignoreText),
+			huh.NewConfirm().
+				Title("Stream dump into mysql").
+				Description("Skip the intermediate dump file (ignored when before hooks exist)").
+				Value(&cfg.Database.Stream),
+			huh.NewConfirm().
+				Title("Verify serialized data").
+				Description("Fail step 2 if a PHP serialized value has a wrong length").
+				Value(&cfg.Database.VerifySerialized),
 			huh.NewInput().
 				Title("Log file").
 				Value(&cfg.Logging.File),
@@ -238,6 +256,7 @@ func (m *Model) flushFields() {
 	m.cfg.Sync = textToSyncPairs(m.syncText)
 	m.cfg.Transport.Exclude = textToLines(m.excludeText)
 	m.cfg.Database.IgnoreTables = textToLines(m.ignoreText)
+	m.cfg.Site.Tags = textToLines(strings.ReplaceAll(m.tagsText, ",", "\n"))
 }
 
 func (m Model) View() string {
@@ -257,10 +276,36 @@ func (m Model) View() string {
 
 // ── text ↔ pair helpers ──────────────────────────────────────────────────────
 
+// replaceOptionsSep separates a replace pair from its options in the
+// editor text, e.g. "https?://old==>https://new||regex,ignore_case".
+const replaceOptionsSep = "||"
+
 func replacePairsToText(pairs []config.ReplacePair) string {
 	lines := make([]string, len(pairs))
 	for i, p := range pairs {
 		lines[i] = p.Search + "==>" + p.Replace
+		var opts []string
+		if p.Regex {
+			opts = append(opts, "regex")
+		}
+		if p.IgnoreCase {
+			opts = append(opts, "ignore_case")
+		}
+		if p.OnlySerialized {
+			opts = append(opts, "only_serialized")
+		}
+		if p.SkipEncoded {
+			opts = append(opts, "skip_encoded")
+		}
+		if len(p.Tables) > 0 {
+			opts = append(opts, "tables="+strings.Join(p.Tables, ";"))
+		}
+		if len(p.ExcludeTables) > 0 {
+			opts = append(opts, "exclude_tables="+strings.Join(p.ExcludeTables, ";"))
+		}
+		if len(opts) > 0 {
+			lines[i] += replaceOptionsSep + strings.Join(opts, ",")
+		}
 	}
 	return strings.Join(lines, "\n")
 }
@@ -273,15 +318,57 @@ func textToReplacePairs(text string) []config.ReplacePair {
 			continue
 		}
 		if idx := strings.Index(line, "==>"); idx >= 0 {
-			pairs = append(pairs, config.ReplacePair{
+			pair := config.ReplacePair{
 				Search:  line[:idx],
 				Replace: line[idx+3:],
-			})
+			}
+			parseReplaceOptions(&pair)
+			pairs = append(pairs, pair)
 		}
 	}
 	return pairs
 }
 
+// parseReplaceOptions moves a trailing "||opt,opt" suffix from the
+// replacement into the pair's options. The suffix is only taken as options
+// when every token is a known option name, so a replacement that happens to
+// contain "||" is left alone.
+func parseReplaceOptions(pair *config.ReplacePair) {
+	idx := strings.LastIndex(pair.Replace, replaceOptionsSep)
+	if idx < 0 {
+		return
+	}
+	opts := *pair
+	for _, tok := range strings.Split(pair.Replace[idx+len(replaceOptionsSep):], ",") {
+		tok = strings.TrimSpace(tok)
+		if key, list, ok := strings.Cut(tok, "="); ok {
+			switch key {
+			case "tables":
+				opts.Tables = strings.Split(list, ";")
+			case "exclude_tables":
+				opts.ExcludeTables = strings.Split(list, ";")
+			default:
+				return
+			}
+			continue
+		}
+		switch tok {
+		case "regex":
+			opts.Regex = true
+		case "ignore_case":
+			opts.IgnoreCase = true
+		case "only_serialized":
+			opts.OnlySerialized = true
+		case "skip_encoded":
+			opts.SkipEncoded = true
+		default:
+			return
+		}
+	}
+	opts.Replace = pair.Replace[:idx]
+	*pair = opts
+}
+
 func syncPairsToText(pairs []config.SyncPair) string {
 	lines := make([]string, len(pairs))
 	for i, p := range pairs {
@@ -1,6 +1,9 @@
 package opselect
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -10,7 +13,14 @@ import (
 )
 
 // Messages
-type OpChosenMsg struct{ Op syncsvc.Op }
+type OpChosenMsg struct {
+	Op    syncsvc.Op
+	Steps syncsvc.Steps
+}
+type PreviewMsg struct {
+	Op    syncsvc.Op
+	Steps syncsvc.Steps
+}
 type BackMsg struct{}
 
 type choice struct {
@@ -23,31 +33,67 @@ var choices = []choice{
 	{"SQL + Files", "Sync the database and all file pairs", syncsvc.OpAll},
 	{"SQL only", "Import database dump only (skip rsync/lftp)", syncsvc.OpSQL},
 	{"Files only", "Sync files only (skip database)", syncsvc.OpFiles},
+	{"Push to remote", "Overwrite the remote database and files with local ones (needs allow_push)", syncsvc.OpPush},
 }
 
 type keyMap struct {
-	Up     key.Binding
-	Down   key.Binding
-	Select key.Binding
-	Back   key.Binding
+	Up      key.Binding
+	Down    key.Binding
+	Select  key.Binding
+	Preview key.Binding
+	Steps   key.Binding
+	Toggle  key.Binding
+	All     key.Binding
+	Back    key.Binding
 }
 
 var keys = keyMap{
-	Up:     key.NewBinding(key.WithKeys("up", "k")),
-	Down:   key.NewBinding(key.WithKeys("down", "j")),
-	Select: key.NewBinding(key.WithKeys("enter")),
-	Back:   key.NewBinding(key.WithKeys("b", "esc")),
+	Up:      key.NewBinding(key.WithKeys("up", "k")),
+	Down:    key.NewBinding(key.WithKeys("down", "j")),
+	Select:  key.NewBinding(key.WithKeys("enter")),
+	Preview: key.NewBinding(key.WithKeys("p")),
+	Steps:   key.NewBinding(key.WithKeys("s")),
+	Toggle:  key.NewBinding(key.WithKeys(" ", "x")),
+	All:     key.NewBinding(key.WithKeys("a")),
+	Back:    key.NewBinding(key.WithKeys("b", "esc")),
 }
 
 type Model struct {
 	cursor   int
 	confName string
+	sites    []string // the sites of a batch run, or nil
 	width    int
 	height   int
+
+	// Steps to run, narrowed down to those of the chosen operation. The
+	// step list has the focus while editSteps is set.
+	steps      syncsvc.Steps
+	editSteps  bool
+	stepCursor int // 1–7
 }
 
 func New(confName string) Model {
-	return Model{confName: confName}
+	return Model{confName: confName, steps: syncsvc.AllSteps, stepCursor: 1}
+}
+
+// NewBatch chooses the operation of a batch run of sites. A push must be
+// confirmed site by site and a batch has no preview, so neither is offered.
+func NewBatch(sites []string) Model {
+	return Model{confName: strings.Join(sites, ", "), sites: sites, steps: syncsvc.AllSteps, stepCursor: 1}
+}
+
+// choices returns the operations offered.
+func (m Model) choices() []choice {
+	if m.sites != nil {
+		return choices[:3]
+	}
+	return choices
+}
+
+// selected returns the steps the highlighted operation would run. Unlike
+// Op.Select, an empty step set stays empty rather than meaning all steps.
+func (m Model) selected() syncsvc.Steps {
+	return m.choices()[m.cursor].op.Steps() & m.steps
 }
 
 func (m Model) Init() tea.Cmd { return nil }
@@ -58,18 +104,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.width = msg.Width
 		m.height = msg.Height
 	case tea.KeyMsg:
+		if m.editSteps {
+			return m.updateSteps(msg)
+		}
 		switch {
 		case key.Matches(msg, keys.Up):
 			if m.cursor > 0 {
 				m.cursor--
 			}
 		case key.Matches(msg, keys.Down):
-			if m.cursor < len(choices)-1 {
+			if m.cursor < len(m.choices())-1 {
 				m.cursor++
 			}
-		case key.Matches(msg, keys.Select):
-			op := choices[m.cursor].op
-			return m, func() tea.Msg { return OpChosenMsg{Op: op} }
+		case key.Matches(msg, keys.Steps):
+			m.editSteps = true
+		case key.Matches(msg, keys.Select), key.Matches(msg, keys.Preview):
+			return m, m.choose(key.Matches(msg, keys.Preview))
 		case key.Matches(msg, keys.Back):
 			return m, func() tea.Msg { return BackMsg{} }
 		}
@@ -77,14 +127,57 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// updateSteps handles the keys of the step list.
+func (m Model) updateSteps(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, keys.Up):
+		if m.stepCursor > 1 {
+			m.stepCursor--
+		}
+	case key.Matches(msg, keys.Down):
+		if m.stepCursor < 7 {
+			m.stepCursor++
+		}
+	case key.Matches(msg, keys.Toggle):
+		m.steps ^= syncsvc.StepsOf(m.stepCursor)
+	case key.Matches(msg, keys.All):
+		if m.steps == syncsvc.AllSteps {
+			m.steps = 0
+		} else {
+			m.steps = syncsvc.AllSteps
+		}
+	case key.Matches(msg, keys.Select), key.Matches(msg, keys.Preview):
+		return m, m.choose(key.Matches(msg, keys.Preview))
+	case key.Matches(msg, keys.Back), key.Matches(msg, keys.Steps):
+		m.editSteps = false
+	}
+	return m, nil
+}
+
+// choose runs or previews the highlighted operation, unless none of its
+// steps is selected.
+func (m Model) choose(preview bool) tea.Cmd {
+	op, steps := m.choices()[m.cursor].op, m.selected()
+	if steps == 0 || preview && m.sites != nil {
+		return nil
+	}
+	if preview {
+		return func() tea.Msg { return PreviewMsg{Op: op, Steps: steps} }
+	}
+	return func() tea.Msg { return OpChosenMsg{Op: op, Steps: steps} }
+}
+
 func (m Model) View() string {
 	title := styles.Title.Render("Select operation")
 	sub := styles.Subtitle.Render("Site: " + styles.Bold.Render(m.confName))
+	if m.sites != nil {
+		sub = styles.Subtitle.Render(fmt.Sprintf("%d sites: ", len(m.sites)) + styles.Bold.Render(m.confName))
+	}
 
 	var rows []string
 	rows = append(rows, title, sub, "")
 
-	for i, c := range choices {
+	for i, c := range m.choices() {
 		var indicator, label, desc string
 		if i == m.cursor {
 			indicator = styles.StepActiveStyle.Render("▶")
@@ -100,9 +193,62 @@ func (m Model) View() string {
 		rows = append(rows, "")
 	}
 
-	help := styles.RenderHelp("↑/↓", "navigate", "enter", "confirm", "b", "back")
+	rows = append(rows, m.viewSteps()...)
+
+	help := styles.RenderHelp("↑/↓", "navigate", "enter", "confirm", "p", "preview", "s", "steps", "b", "back")
+	if m.editSteps {
+		help = styles.RenderHelp("↑/↓", "navigate", "space", "toggle", "a", "all/none", "enter", "confirm", "p", "preview", "esc", "done")
+	}
+	if m.sites != nil {
+		help = styles.RenderHelp("↑/↓", "navigate", "enter", "confirm", "s", "steps", "b", "back")
+		if m.editSteps {
+			help = styles.RenderHelp("↑/↓", "navigate", "space", "toggle", "a", "all/none", "enter", "confirm", "esc", "done")
+		}
+	}
 	footer := styles.StatusBar.Render(help)
 	rows = append(rows, footer)
 
 	return lipgloss.JoinVertical(lipgloss.Left, rows...)
 }
+
+// viewSteps renders the steps of the highlighted operation: a summary line,
+// or the full checklist while it is being edited.
+func (m Model) viewSteps() []string {
+	op := m.choices()[m.cursor].op
+	sel := m.selected()
+	if !m.editSteps {
+		switch {
+		case sel == 0:
+			return []string{styles.Error.Render("  Steps: none selected (s to change)"), ""}
+		case sel == op.Steps():
+			return []string{styles.Muted.Render("  Steps: all"), ""}
+		}
+		return []string{styles.Warning.Render("  Steps: " + sel.String() + " only (s to change)"), ""}
+	}
+
+	rows := []string{styles.Muted.Render("  Steps")}
+	for step := 1; step <= 7; step++ {
+		indicator := "  "
+		if step == m.stepCursor {
+			indicator = styles.StepActiveStyle.Render("▶")
+		}
+		box := "[ ]"
+		if sel.Has(step) {
+			box = "[x]"
+		}
+		line := fmt.Sprintf("%s %d  %s", box, step, op.StepName(step))
+		switch {
+		case !op.Steps().Has(step):
+			line = styles.DimItem.Render(fmt.Sprintf("[-] %d  %s (not part of %s)", step, op.StepName(step), op))
+		case step == m.stepCursor:
+			line = styles.SelectedItem.Render(line)
+		default:
+			line = styles.NormalItem.Render(line)
+		}
+		rows = append(rows, lipgloss.JoinHorizontal(lipgloss.Top, indicator, " ", line))
+	}
+	if sel == 0 {
+		rows = append(rows, styles.Error.Render("  Select at least one step."))
+	}
+	return append(rows, "")
+}
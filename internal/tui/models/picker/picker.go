@@ -2,6 +2,7 @@ package picker
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/key"
@@ -10,6 +11,7 @@ import (
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/carlosrgl/sitesync/internal/config"
+	syncsvc "github.com/carlosrgl/sitesync/internal/sync"
 	"github.com/carlosrgl/sitesync/internal/tui/styles"
 )
 
@@ -18,17 +20,56 @@ type ConfSelectedMsg struct{ Name string }
 type NewConfMsg struct{}
 type EditConfMsg struct{ Name string }
 
+// BatchSelectedMsg asks to sync the marked sites together.
+type BatchSelectedMsg struct{ Names []string }
+
 // item implements list.Item
 type item struct {
-	entry config.ConfigEntry
+	entry  config.ConfigEntry
+	last   *syncsvc.RunRecord // most recent run, from the history
+	marked bool               // part of the next batch run
 }
 
-func (i item) Title() string { return i.entry.Name }
+func (i item) Title() string {
+	if i.marked {
+		return "● " + i.entry.Name
+	}
+	return i.entry.Name
+}
 func (i item) Description() string {
-	if i.entry.LastModified.IsZero() {
-		return "never synced"
+	desc := "never synced"
+	if i.last != nil {
+		switch i.last.Status {
+		case syncsvc.RunOK:
+			desc = fmt.Sprintf("✔ synced %s (%s)", ago(i.last.End), i.last.Op)
+		case syncsvc.RunCancelled:
+			desc = fmt.Sprintf("⊘ cancelled %s (%s)", ago(i.last.End), i.last.Op)
+		default:
+			desc = fmt.Sprintf("✘ failed %s: %s", ago(i.last.End), i.last.Reason)
+		}
+	}
+	if len(i.entry.Tags) > 0 {
+		desc = strings.Join(i.entry.Tags, ", ") + " · " + desc
 	}
-	age := time.Since(i.entry.LastModified)
+	return desc
+}
+
+// FilterValue includes the tags, so that /wordpress lists those sites.
+func (i item) FilterValue() string {
+	return strings.Join(append([]string{i.entry.Name}, i.entry.Tags...), " ")
+}
+
+func newItems(entries []config.ConfigEntry) []list.Item {
+	items := make([]list.Item, len(entries))
+	for i, e := range entries {
+		items[i] = item{entry: e, last: syncsvc.LastRun(e.Name)}
+	}
+	return items
+}
+
+// ago describes how long ago t was.
+func ago(t time.Time) string {
+	age := time.Since(t)
 	switch {
 	case age < time.Minute:
 		return "just now"
@@ -40,7 +81,6 @@ func (i item) Description() string {
 		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
 	}
 }
-func (i item) FilterValue() string { return i.entry.Name }
 
 // key bindings
 type keyMap struct {
@@ -48,6 +88,7 @@ type keyMap struct {
 	Edit   key.Binding
 	Select key.Binding
 	Search key.Binding
+	Mark   key.Binding
 	Quit   key.Binding
 }
 
@@ -68,6 +109,10 @@ var keys = keyMap{
 		key.WithKeys("/"),
 		key.WithHelp("/", "search"),
 	),
+	Mark: key.NewBinding(
+		key.WithKeys(" "),
+		key.WithHelp("space", "mark"),
+	),
 	Quit: key.NewBinding(
 		key.WithKeys("q", "ctrl+c"),
 		key.WithHelp("q", "quit"),
@@ -83,10 +128,7 @@ type Model struct {
 
 // New creates a picker populated with available configs.
 func New(entries []config.ConfigEntry) Model {
-	items := make([]list.Item, len(entries))
-	for i, e := range entries {
-		items[i] = item{entry: e}
-	}
+	items := newItems(entries)
 
 	d := list.NewDefaultDelegate()
 	d.Styles.SelectedTitle = d.Styles.SelectedTitle.
@@ -103,7 +145,7 @@ func New(entries []config.ConfigEntry) Model {
 		Bold(true).
 		Padding(0, 1)
 	l.AdditionalShortHelpKeys = func() []key.Binding {
-		return []key.Binding{keys.Search, keys.New, keys.Edit}
+		return []key.Binding{keys.Search, keys.Mark, keys.New, keys.Edit}
 	}
 	l.SetShowStatusBar(true)
 	l.SetFilteringEnabled(true)
@@ -135,7 +177,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if it, ok := m.list.SelectedItem().(item); ok {
 				return m, func() tea.Msg { return EditConfMsg{Name: it.entry.Name} }
 			}
+		case key.Matches(msg, keys.Mark):
+			if it, ok := m.list.SelectedItem().(item); ok {
+				m.toggleMark(it.entry.Name)
+			}
+			return m, nil
 		case key.Matches(msg, keys.Select):
+			if names := m.marked(); len(names) > 0 {
+				return m, func() tea.Msg { return BatchSelectedMsg{Names: names} }
+			}
 			if it, ok := m.list.SelectedItem().(item); ok {
 				return m, func() tea.Msg { return ConfSelectedMsg{Name: it.entry.Name} }
 			}
@@ -147,10 +197,37 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// toggleMark marks or unmarks the named site for a batch run.
+func (m *Model) toggleMark(name string) {
+	for i, li := range m.list.Items() {
+		if it := li.(item); it.entry.Name == name {
+			it.marked = !it.marked
+			m.list.SetItem(i, it)
+			return
+		}
+	}
+}
+
+// marked returns the names of the marked sites, in list order.
+func (m Model) marked() []string {
+	var names []string
+	for _, li := range m.list.Items() {
+		if it := li.(item); it.marked {
+			names = append(names, it.entry.Name)
+		}
+	}
+	return names
+}
+
 func (m Model) View() string {
+	enter := "sync"
+	if n := len(m.marked()); n > 0 {
+		enter = fmt.Sprintf("sync %d marked", n)
+	}
 	help := styles.RenderHelp(
 		"/", "search",
-		"enter", "sync",
+		"space", "mark",
+		"enter", enter,
 		"e", "edit",
 		"n", "new",
 		"q", "quit",
@@ -161,9 +238,5 @@ func (m Model) View() string {
 
 // Reload replaces the list items (call after creating/editing a config).
 func (m *Model) Reload(entries []config.ConfigEntry) {
-	items := make([]list.Item, len(entries))
-	for i, e := range entries {
-		items[i] = item{entry: e}
-	}
-	m.list.SetItems(items)
+	m.list.SetItems(newItems(entries))
 }
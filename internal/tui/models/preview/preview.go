@@ -0,0 +1,192 @@
+package preview
+
+import (
+	"context"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/carlosrgl/sitesync/internal/config"
+	syncsvc "github.com/carlosrgl/sitesync/internal/sync"
+	"github.com/carlosrgl/sitesync/internal/tui/styles"
+)
+
+// Messages
+type RunMsg struct {
+	Op    syncsvc.Op
+	Steps syncsvc.Steps
+}
+type BackMsg struct{}
+
+type planMsg struct {
+	plan *syncsvc.Plan
+	err  error
+}
+
+type keyMap struct {
+	Run  key.Binding
+	Back key.Binding
+}
+
+var keys = keyMap{
+	Run:  key.NewBinding(key.WithKeys("enter")),
+	Back: key.NewBinding(key.WithKeys("b", "esc", "q")),
+}
+
+// Model shows what a sync would do before running it. The plan is built in
+// the background since the rsync dry run can take a while.
+type Model struct {
+	cfg      *config.Config
+	op       syncsvc.Op
+	steps    syncsvc.Steps
+	confName string
+
+	cancelFn context.CancelFunc
+	planCh   chan planMsg
+	viewport viewport.Model
+	spinner  spinner.Model
+	loaded   bool
+	err      error
+	width    int
+	height   int
+}
+
+func New(cfg *config.Config, op syncsvc.Op, steps syncsvc.Steps, confName string, width, height int) Model {
+	sp := spinner.New()
+	sp.Spinner = spinner.Dot
+	sp.Style = styles.StepActiveStyle
+
+	vp := viewport.New(80, 20)
+	vp.Style = styles.LogPanel
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan planMsg, 1)
+	go func() {
+		plan, err := syncsvc.BuildPlan(ctx, cfg, op, steps)
+		ch <- planMsg{plan: plan, err: err}
+	}()
+
+	m := Model{
+		cfg:      cfg,
+		op:       op,
+		steps:    steps,
+		confName: confName,
+		cancelFn: cancel,
+		planCh:   ch,
+		viewport: vp,
+		spinner:  sp,
+	}
+	return m.resize(width, height)
+}
+
+func (m Model) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, waitForPlan(m.planCh))
+}
+
+func waitForPlan(ch <-chan planMsg) tea.Cmd {
+	return func() tea.Msg { return <-ch }
+}
+
+func (m Model) resize(width, height int) Model {
+	if width == 0 {
+		return m
+	}
+	m.width, m.height = width, height
+	m.viewport.Width = width - 4
+	m.viewport.Height = max(height-9, 4) // header(3) + title(2) + help(2) + padding(2)
+	return m
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m = m.resize(msg.Width, msg.Height)
+
+	case planMsg:
+		m.loaded = true
+		m.err = msg.err
+		if msg.plan != nil {
+			var sb strings.Builder
+			msg.plan.Print(&sb)
+			m.viewport.SetContent(stylePlan(sb.String()))
+		}
+		return m, nil
+
+	case spinner.TickMsg:
+		if m.loaded {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, keys.Back):
+			m.cancelFn()
+			return m, func() tea.Msg { return BackMsg{} }
+		case key.Matches(msg, keys.Run):
+			if m.loaded && m.err == nil {
+				op, steps := m.op, m.steps
+				return m, func() tea.Msg { return RunMsg{Op: op, Steps: steps} }
+			}
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+// stylePlan colours the plan printed by Plan.Print.
+func stylePlan(text string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "$ "):
+			lines[i] = styles.LogPrefixCmd.Render("  $ ") + styles.Cyan.Render(strings.TrimPrefix(trimmed, "$ "))
+		case strings.HasPrefix(line, "[") || strings.HasPrefix(line, "Files "):
+			if strings.HasSuffix(line, "(skipped)") {
+				lines[i] = styles.StepSkippedStyle.Render(line)
+			} else {
+				lines[i] = styles.Primary.Render(line)
+			}
+		case strings.HasPrefix(trimmed, "✘"):
+			lines[i] = styles.Error.Render(line)
+		case strings.HasPrefix(trimmed, "database overwritten:"):
+			lines[i] = styles.Warning.Render(line)
+		case strings.HasPrefix(line, "Plan for"):
+			lines[i] = styles.Bold.Render(line)
+		default:
+			lines[i] = styles.LogLine.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m Model) View() string {
+	title := styles.Title.Render("Preview: " + m.confName)
+	rows := []string{title}
+
+	var helpPairs []string
+	switch {
+	case !m.loaded:
+		rows = append(rows, "  "+m.spinner.View()+styles.Muted.Render(" building plan (rsync dry run)…"))
+		helpPairs = append(helpPairs, "b", "back")
+	case m.err != nil:
+		rows = append(rows, styles.Error.Render("  ✘ "+m.err.Error()))
+		helpPairs = append(helpPairs, "b", "back")
+	default:
+		rows = append(rows, m.viewport.View())
+		helpPairs = append(helpPairs, "↑/↓", "scroll", "enter", "run sync", "b", "back")
+	}
+	rows = append(rows, "", styles.StatusBar.Render(styles.RenderHelp(helpPairs...)))
+
+	return lipgloss.JoinVertical(lipgloss.Left, rows...)
+}
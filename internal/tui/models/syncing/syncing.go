@@ -37,11 +37,13 @@ const (
 type stepState struct {
 	status   stepStatus
 	progress float64
+	detail   string // progress text when the total is unknown (streaming)
 }
 
 type Model struct {
 	cfg      *config.Config
 	op       syncsvc.Op
+	selected syncsvc.Steps // zero for every step of op
 	confName string
 
 	eventCh    <-chan syncsvc.Event
@@ -65,9 +67,25 @@ type Model struct {
 	authPrompt  string
 	authInput   textinput.Model
 	authReplyCh chan<- syncsvc.AuthReply
+
+	// Preflight checklist, shown in full until step 1 starts
+	checks  []syncsvc.Check
+	started bool
+
+	// Safety override state; confirmExpect is the text to type, if any
+	confirmPrompt string
+	confirmCh     chan<- bool
+	confirmExpect string
+	confirmInput  textinput.Model
+
+	// Interrupted run offered for resuming; the engine starts once the
+	// user has answered.
+	resumeOffer *syncsvc.RunState
+	ctx         context.Context
+	log         logger.Logger
 }
 
-func New(cfg *config.Config, op syncsvc.Op, confName string, log logger.Logger) Model {
+func New(cfg *config.Config, op syncsvc.Op, steps syncsvc.Steps, confName string, log logger.Logger) Model {
 	sp := spinner.New()
 	sp.Spinner = spinner.Dot
 	sp.Style = styles.StepActiveStyle
@@ -87,26 +105,47 @@ func New(cfg *config.Config, op syncsvc.Op, confName string, log logger.Logger)
 	authInput.Width = 40
 	authInput.Prompt = ""
 
-	ctx, cancel := context.WithCancel(context.Background())
-	ch := make(chan syncsvc.Event, 128)
+	confirmInput := textinput.New()
+	confirmInput.Width = 40
+	confirmInput.Prompt = "> "
 
-	go syncsvc.Run(ctx, cfg, op, ch, log)
+	ctx, cancel := context.WithCancel(context.Background())
 
-	return Model{
-		cfg:        cfg,
-		op:         op,
-		confName:   confName,
-		eventCh:    ch,
-		cancelFn:   cancel,
-		spinner:    sp,
-		progressBr: pr,
-		viewport:   vp,
-		authInput:  authInput,
-		logVisible: true,
+	m := Model{
+		cfg:          cfg,
+		op:           op,
+		selected:     steps,
+		confName:     confName,
+		ctx:          ctx,
+		log:          log,
+		cancelFn:     cancel,
+		spinner:      sp,
+		progressBr:   pr,
+		viewport:     vp,
+		authInput:    authInput,
+		confirmInput: confirmInput,
+		logVisible:   true,
+		resumeOffer:  syncsvc.Resumable(cfg, confName, op, op.Select(steps)),
+	}
+	if m.resumeOffer == nil {
+		m = m.start(false)
 	}
+	return m
+}
+
+// start launches the engine.
+func (m Model) start(resume bool) Model {
+	ch := make(chan syncsvc.Event, 128)
+	go syncsvc.Run(m.ctx, m.cfg, m.op, syncsvc.Options{Resume: resume, Steps: m.selected}, ch, m.log)
+	m.eventCh = ch
+	m.resumeOffer = nil
+	return m
 }
 
 func (m Model) Init() tea.Cmd {
+	if m.resumeOffer != nil {
+		return m.spinner.Tick
+	}
 	return tea.Batch(
 		m.spinner.Tick,
 		waitForEvent(m.eventCh),
@@ -140,7 +179,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case syncsvc.Event:
 		m = m.applyEvent(msg)
-		if !m.done && !m.failed && m.authReplyCh == nil {
+		if !m.done && !m.failed && m.authReplyCh == nil && m.confirmCh == nil {
 			cmds = append(cmds, waitForEvent(m.eventCh))
 		}
 
@@ -155,6 +194,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, cmd)
 
 	case tea.KeyMsg:
+		if m.resumeOffer != nil {
+			switch msg.String() {
+			case "r", "y", "enter":
+				m = m.start(true)
+				cmds = append(cmds, waitForEvent(m.eventCh))
+			case "s", "n":
+				m = m.start(false)
+				cmds = append(cmds, waitForEvent(m.eventCh))
+			case "q", "esc", "ctrl+c":
+				m.cancelFn()
+				return m, func() tea.Msg { return BackMsg{} }
+			}
+			break
+		}
+
 		if m.authReplyCh != nil {
 			switch msg.String() {
 			case "enter":
@@ -171,6 +225,34 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			break
 		}
 
+		if m.confirmCh != nil && m.confirmExpect != "" {
+			switch msg.String() {
+			case "enter":
+				m.sendConfirm(m.confirmInput.Value() == m.confirmExpect)
+				cmds = append(cmds, waitForEvent(m.eventCh))
+			case "esc", "ctrl+c":
+				m.sendConfirm(false)
+				cmds = append(cmds, waitForEvent(m.eventCh))
+			default:
+				var cmd tea.Cmd
+				m.confirmInput, cmd = m.confirmInput.Update(msg)
+				cmds = append(cmds, cmd)
+			}
+			break
+		}
+
+		if m.confirmCh != nil {
+			switch msg.String() {
+			case "y":
+				m.sendConfirm(true)
+				cmds = append(cmds, waitForEvent(m.eventCh))
+			case "n", "esc", "enter", "q", "ctrl+c":
+				m.sendConfirm(false)
+				cmds = append(cmds, waitForEvent(m.eventCh))
+			}
+			break
+		}
+
 		// Error recovery mode: arrow keys + enter to choose
 		if m.failed && m.replyCh != nil {
 			switch msg.String() {
@@ -226,6 +308,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m Model) applyEvent(ev syncsvc.Event) Model {
 	switch ev.Type {
 	case syncsvc.EvStepStart:
+		m.started = true
 		if ev.Step >= 1 && ev.Step <= 7 {
 			m.steps[ev.Step].status = statusActive
 		}
@@ -234,6 +317,10 @@ func (m Model) applyEvent(ev syncsvc.Event) Model {
 			m.steps[ev.Step].status = statusDone
 			m.steps[ev.Step].progress = 1.0
 		}
+	case syncsvc.EvStepSkip:
+		if ev.Step >= 1 && ev.Step <= 7 {
+			m.steps[ev.Step].status = statusSkipped
+		}
 	case syncsvc.EvStepFail:
 		if ev.Step >= 1 && ev.Step <= 7 {
 			m.steps[ev.Step].status = statusFailed
@@ -250,9 +337,20 @@ func (m Model) applyEvent(ev syncsvc.Event) Model {
 		m.authReplyCh = ev.AuthReplyCh
 		m.authInput.SetValue("")
 		m.authInput.Focus()
+	case syncsvc.EvCheck:
+		m.checks = append(m.checks, ev.Check)
+	case syncsvc.EvConfirm:
+		m.confirmPrompt = ev.Message
+		m.confirmCh = ev.ConfirmCh
+		m.confirmExpect = ev.Expect
+		if ev.Expect != "" {
+			m.confirmInput.SetValue("")
+			m.confirmInput.Focus()
+		}
 	case syncsvc.EvProgress:
 		if ev.Step >= 1 && ev.Step <= 7 {
 			m.steps[ev.Step].progress = ev.Progress
+			m.steps[ev.Step].detail = ev.Message
 		}
 	case syncsvc.EvLog:
 		styled := styleLogLine(ev.Message)
@@ -333,6 +431,9 @@ func (m *Model) sendErrorAction() {
 		if m.errorChoice == 0 { // retry — reset step
 			m.steps[m.failedStep].status = statusActive
 			m.steps[m.failedStep].progress = 0
+			if !m.started { // preflight runs again from scratch
+				m.checks = nil
+			}
 		}
 	}
 	m.replyCh = nil
@@ -353,13 +454,33 @@ func (m *Model) sendAuthReply(cancel bool) {
 	m.authInput.Blur()
 }
 
+func (m *Model) sendConfirm(ok bool) {
+	if m.confirmCh == nil {
+		return
+	}
+	m.confirmCh <- ok
+	m.confirmCh = nil
+	m.confirmPrompt = ""
+	m.confirmExpect = ""
+	m.confirmInput.Blur()
+}
+
 func (m Model) View() string {
 	var rows []string
 
 	// ── Header ──────────────────────────────────────────
-	title := styles.Title.Render(fmt.Sprintf("⚡ Syncing: %s", m.confName))
+	verb := "Syncing"
+	if m.op == syncsvc.OpPush {
+		verb = "Pushing"
+	}
+	title := styles.Title.Render(fmt.Sprintf("⚡ %s: %s", verb, m.confName))
 	rows = append(rows, title)
 
+	// ── Preflight ───────────────────────────────────────
+	if len(m.checks) > 0 {
+		rows = append(rows, m.renderChecks()...)
+	}
+
 	// ── Steps ───────────────────────────────────────────
 	for i := 1; i <= 7; i++ {
 		rows = append(rows, m.renderStep(i))
@@ -368,6 +489,14 @@ func (m Model) View() string {
 	rows = append(rows, "")
 
 	// ── Status ──────────────────────────────────────────
+	if rs := m.resumeOffer; rs != nil {
+		next := rs.NextStep()
+		rows = append(rows, styles.Warning.Render(fmt.Sprintf("  ⏸ The run of %s stopped at step %d (%s).",
+			rs.Updated.Format("2006-01-02 15:04"), next, m.op.StepName(next))))
+		rows = append(rows, styles.Muted.Render(fmt.Sprintf("  Press r to resume from step %d, s to start over.", next)))
+		rows = append(rows, "")
+	}
+
 	if m.authReplyCh != nil {
 		rows = append(rows, styles.Warning.Render("  🔐 "+m.authPrompt))
 		rows = append(rows, "  "+m.authInput.View())
@@ -375,6 +504,22 @@ func (m Model) View() string {
 		rows = append(rows, "")
 	}
 
+	if m.confirmCh != nil {
+		lines := strings.Split(m.confirmPrompt, "\n")
+		rows = append(rows, styles.Warning.Render("  🛡 "+lines[0]))
+		for _, l := range lines[1:] {
+			rows = append(rows, styles.Error.Render("  "+l))
+		}
+		rows = append(rows, "")
+		if m.confirmExpect != "" {
+			rows = append(rows, "  "+m.confirmInput.View())
+			rows = append(rows, styles.Muted.Render("  Type "+m.confirmExpect+" and press enter to go ahead, esc to abort."))
+		} else {
+			rows = append(rows, styles.Muted.Render("  Press y to sync anyway, n to abort."))
+		}
+		rows = append(rows, "")
+	}
+
 	if m.failed {
 		rows = append(rows, styles.Error.Render("  ✘ "+m.failMsg))
 		if m.replyCh != nil {
@@ -416,8 +561,14 @@ func (m Model) View() string {
 
 	// ── Help ────────────────────────────────────────────
 	var helpPairs []string
-	if m.authReplyCh != nil {
+	if m.resumeOffer != nil {
+		helpPairs = append(helpPairs, "r", "resume", "s", "start over", "q", "back")
+	} else if m.authReplyCh != nil {
 		helpPairs = append(helpPairs, "enter", "submit", "esc", "cancel")
+	} else if m.confirmCh != nil && m.confirmExpect != "" {
+		helpPairs = append(helpPairs, "enter", "confirm", "esc", "abort")
+	} else if m.confirmCh != nil {
+		helpPairs = append(helpPairs, "y", "sync anyway", "n", "abort")
 	} else if m.failed && m.replyCh != nil {
 		helpPairs = append(helpPairs, "←/→", "select", "enter", "confirm", "r", "retry", "c", "continue", "q", "quit")
 	} else {
@@ -433,6 +584,47 @@ func (m Model) View() string {
 	return lipgloss.JoinVertical(lipgloss.Left, rows...)
 }
 
+// renderChecks lists every preflight check until step 1 starts, then folds
+// them into a single summary line.
+func (m Model) renderChecks() []string {
+	if !m.started {
+		rows := []string{styles.Muted.Render("  Preflight")}
+		for _, c := range m.checks {
+			rows = append(rows, renderCheck(c))
+		}
+		return append(rows, "")
+	}
+	var warn, fail int
+	for _, c := range m.checks {
+		switch c.Status {
+		case syncsvc.CheckWarn:
+			warn++
+		case syncsvc.CheckFail:
+			fail++
+		}
+	}
+	summary := fmt.Sprintf("  Preflight: %d passed", len(m.checks)-warn-fail)
+	if warn > 0 {
+		summary += fmt.Sprintf(", %d warning(s)", warn)
+	}
+	if fail > 0 {
+		summary += fmt.Sprintf(", %d ignored failure(s)", fail)
+	}
+	return []string{styles.Muted.Render(summary), ""}
+}
+
+func renderCheck(c syncsvc.Check) string {
+	name := fmt.Sprintf(" %-16s ", c.Name)
+	switch c.Status {
+	case syncsvc.CheckPass:
+		return styles.StepDoneStyle.Render(styles.StepDone) + styles.NormalItem.Render(name) + styles.Muted.Render(c.Detail)
+	case syncsvc.CheckWarn:
+		return styles.Warning.Render("  ⚠") + styles.NormalItem.Render(name) + styles.Warning.Render(c.Detail)
+	default:
+		return styles.StepFailedStyle.Render(styles.StepFailed) + styles.Error.Render(name) + styles.Error.Render(c.Detail)
+	}
+}
+
 func countSteps(steps []stepState, status stepStatus) int {
 	n := 0
 	for _, s := range steps {
@@ -445,7 +637,7 @@ func countSteps(steps []stepState, status stepStatus) int {
 
 func (m Model) renderStep(i int) string {
 	st := m.steps[i]
-	name := syncsvc.StepName(i)
+	name := m.op.StepName(i)
 	num := fmt.Sprintf("%d", i)
 
 	var indicator, styledName, right string
@@ -470,6 +662,8 @@ func (m Model) renderStep(i int) string {
 			pct := st.progress * 100
 			right = m.progressBr.ViewAs(st.progress) +
 				styles.Cyan.Render(fmt.Sprintf(" %3.0f%%", pct))
+		} else if st.detail != "" {
+			right = m.spinner.View() + styles.Cyan.Render(" "+st.detail)
 		} else {
 			right = m.spinner.View()
 		}